@@ -63,6 +63,15 @@ func (b *body) readLocked(p []byte) (int, error) {
 		}
 	}
 
+	// The connection is closed after this request, so anything received
+	// past the declared length belongs to the body. This runs before
+	// onHitEOF, which may start reading the connection in the background.
+	if err == io.EOF && b.extraBytes != nil && (b.bufReader.Buffered() > 0 || b.extraBytes()) {
+		err = ErrContentLengthExceeded
+		b.hasSawEOF = false
+		b.isClosed = true
+	}
+
 	if b.hasSawEOF && b.onHitEOF != nil {
 		b.onHitEOF()
 	}
@@ -92,7 +101,11 @@ func (b *body) readTrailer() error {
 	// this bufio.Reader. Instead, a hack: we iteratively Peek up
 	// to the bufio.Reader's max size, looking for a double CRLF.
 	// This limits the trailer to the underlying buffer size, typically 4kB.
-	if !seeUpcomingDoubleCRLF(b.bufReader) {
+	n := upcomingDoubleCRLF(b.bufReader)
+	if b.maxTrailerBytes > 0 && (n < 0 || int64(n) > b.maxTrailerBytes) {
+		return ErrTrailerTooLarge
+	}
+	if n < 0 {
 		return errors.New("http: suspiciously long trailer after chunked body")
 	}
 
@@ -108,6 +121,8 @@ func (b *body) readTrailer() error {
 		mergeSetHeader(&rr.Trailer, hdr.Header(header))
 	case *Response:
 		mergeSetHeader(&rr.Trailer, hdr.Header(header))
+	case *hdr.Header:
+		mergeSetHeader(rr, hdr.Header(header))
 	}
 	return nil
 }
@@ -10,7 +10,6 @@ import (
 	"io"
 	"io/ioutil"
 	"strconv" // TODO : get rid of it
-	"time"
 
 	"github.com/badu/http/hdr"
 	"github.com/badu/http/sniff"
@@ -56,7 +55,7 @@ func (w *chunkWriter) close() {
 		bw := w.res.conn.bufWriter // conn's bufio writer
 		// zero chunk to mark EOF
 		bw.WriteString("0\r\n")
-		if trailers := w.res.finalTrailers(); trailers != nil {
+		if trailers := w.res.finalTrailers(); trailers != nil && !w.res.omitTrailers {
 			trailers.Write(bw) // the writer handles noting errors
 		}
 		// final blank line after the trailers (whether
@@ -82,7 +81,7 @@ func (w *chunkWriter) writeHeader(p []byte) {
 
 	res := w.res
 	srv := res.ctx.Value(SrvCtxtKey).(*Server)
-	keepAlivesEnabled := srv.doKeepAlives()
+	keepAlivesEnabled := res.conn.doKeepAlives(srv)
 	isHEAD := res.req.Method == HEAD
 
 	// header is written out to w.conn.buf below. Depending on the
@@ -123,9 +122,16 @@ func (w *chunkWriter) writeHeader(p []byte) {
 			trailers = true
 		}
 	}
-	for _, v := range w.header[hdr.Trailer] {
-		trailers = true
-		foreachHeaderElement(v, w.res.declareTrailer)
+	if srv.StrictTE && !acceptsTrailers(res.req.Header) {
+		// The client didn't ask for trailers, don't announce nor send them.
+		res.omitTrailers = true
+		trailers = false
+		delHeader(hdr.Trailer)
+	} else {
+		for _, v := range w.header[hdr.Trailer] {
+			trailers = true
+			foreachHeaderElement(v, w.res.declareTrailer)
+		}
 	}
 
 	te := header.Get(hdr.TransferEncoding)
@@ -267,7 +273,7 @@ func (w *chunkWriter) writeHeader(p []byte) {
 	}
 
 	if _, ok := header[hdr.Date]; !ok {
-		setHeader.date = appendTime(w.res.dateBuf[:0], time.Now())
+		setHeader.date = appendTime(w.res.dateBuf[:0], srv.now())
 	}
 
 	if hasCL && hasTE && te != DoIdentity {
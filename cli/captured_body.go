@@ -0,0 +1,12 @@
+/*
+ * Copyright (c) 2018 The Go Authors. All rights reserved.
+ * Use of this source code is governed by a BSD-style license that can be found in the LICENSE file.
+ */
+
+package cli
+
+// Reusable reports whether the original body gives its connection back
+// to the Transport's idle pool, see Response.Reusable.
+func (b capturedBody) Reusable() bool {
+	return bodyReusable(b.Closer)
+}
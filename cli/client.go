@@ -6,6 +6,7 @@
 package cli
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -13,6 +14,7 @@ import (
 	"io/ioutil"
 	"sort"
 	"strings"
+	"time"
 
 	. "github.com/badu/http"
 	"github.com/badu/http/hdr"
@@ -33,8 +35,14 @@ func (c *Client) send(req *Request) (resp *Response, err error) {
 	if c.Jar != nil {
 		if rc := RespCookies(resp); len(rc) > 0 {
 			c.Jar.SetCookies(req.URL, rc)
+			if c.OnCookie != nil {
+				c.OnCookie(req.URL, rc)
+			}
 		}
 	}
+	if c.MaxResponseBodyBytes > 0 && resp.Body != nil {
+		resp.Body = &limitedBody{rc: resp.Body, n: c.MaxResponseBodyBytes}
+	}
 	return resp, nil
 }
 
@@ -77,18 +85,36 @@ func (c *Client) GetWithContext(url string, ctx context.Context) (resp *Response
 	if err != nil {
 		return nil, err
 	}
-	req.WithContext(ctx)
+	req = req.WithContext(ctx)
 	return c.Do(req)
 }
 
-// checkRedirect calls either the user's configured CheckRedirect
-// function, or the default.
+// GetIfModifiedSince issues a conditional GET to the specified URL, sending
+// modTime in an If-Modified-Since header. Redirects are followed as with Get,
+// the header being forwarded to the redirect target.
+//
+// When the resource wasn't modified since modTime, the server's
+// 304 (Not Modified) response is returned as is, with an empty Body and
+// a nil error.
+func (c *Client) GetIfModifiedSince(url string, modTime time.Time) (resp *Response, err error) {
+	req, err := NewRequest(GET, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(hdr.IfModifiedSince, modTime.UTC().Format(hdr.TimeFormat))
+	return c.Do(req)
+}
+
+// checkRedirect calls the user's configured CheckRedirect function, if
+// any, then enforces the redirect limit. A CheckRedirect function replaces
+// that limit unless MaxRedirects is set.
 func (c *Client) checkRedirect(req *Request, via []*Request) error {
-	fn := c.CheckRedirect
-	if fn == nil {
-		fn = defaultCheckRedirect
+	if fn := c.CheckRedirect; fn != nil {
+		if err := fn(req, via); err != nil || c.MaxRedirects == 0 {
+			return err
+		}
 	}
-	return fn(req, via)
+	return checkRedirectLimit(c.MaxRedirects, via)
 }
 
 // Do sends an HTTP request and returns an HTTP response, following
@@ -125,6 +151,27 @@ func (c *Client) checkRedirect(req *Request, via []*Request) error {
 // The NewRequest function automatically sets GetBody for common
 // standard library body types.
 func (c *Client) Do(req *Request) (*Response, error) {
+	if c.BaseContext != nil && req.Context() == context.Background() {
+		req = req.WithContext(c.BaseContext)
+	}
+	if c.Timeout <= 0 {
+		return c.do(req)
+	}
+	// the deadline is set once, for all the redirect hops
+	ctx, cancel := context.WithTimeout(req.Context(), c.Timeout)
+	resp, err := c.do(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		if ue, ok := err.(*url.Error); ok && ctx.Err() == context.DeadlineExceeded {
+			ue.Err = &timeoutError{err: ue.Err, what: " (Client.Timeout exceeded)"}
+		}
+		return resp, err
+	}
+	resp.Body = &timeoutBody{rc: resp.Body, ctx: ctx, cancel: cancel}
+	return resp, nil
+}
+
+func (c *Client) do(req *Request) (*Response, error) {
 	if req.URL == nil {
 		req.CloseBody()
 		return nil, errors.New("http: nil Request.URL")
@@ -139,6 +186,9 @@ func (c *Client) Do(req *Request) (*Response, error) {
 		// Redirect behavior:
 		redirectMethod string
 		includeBody    bool
+
+		// timings of the redirect hops followed so far
+		redirectTimings []time.Duration
 	)
 	uerr := func(err error) error {
 		// the body may have been closed already by c.send()
@@ -198,7 +248,9 @@ func (c *Client) Do(req *Request) (*Response, error) {
 					if resp.Body != nil {
 						resp.Body.Close()
 					}
-					return nil, uerr(err)
+					ue := uerr(err)
+					ue.(*url.Error).URL = req.URL.String()
+					return nil, ue
 				}
 				req.ContentLength = ireq.ContentLength
 			}
@@ -220,6 +272,11 @@ func (c *Client) Do(req *Request) (*Response, error) {
 			// previous response, without closing its
 			// body. See Issue 10069.
 			if err == ErrUseLastResponse {
+				// this last redirect was not followed
+				resp.RedirectTimings = redirectTimings[:len(redirectTimings)-1]
+				if len(reqs) > 1 {
+					resp.Via = reqs[:len(reqs)-1]
+				}
 				return resp, nil
 			}
 
@@ -239,8 +296,9 @@ func (c *Client) Do(req *Request) (*Response, error) {
 				// and an error if the CheckRedirect function failed.
 				// See https://golang.org/issue/3795
 				// The resp.Body has already been closed.
+				// The error carries the URL of the hop that wasn't followed.
 				ue := uerr(err)
-				ue.(*url.Error).URL = loc
+				ue.(*url.Error).URL = req.URL.String()
 				return resp, ue
 			}
 		}
@@ -248,6 +306,7 @@ func (c *Client) Do(req *Request) (*Response, error) {
 		reqs = append(reqs, req)
 		var err error
 
+		sentAt := time.Now()
 		if resp, err = c.send(req); err != nil {
 			reqBodyClosed = true
 			return nil, uerr(err)
@@ -256,12 +315,42 @@ func (c *Client) Do(req *Request) (*Response, error) {
 		var shouldRedirect bool
 		redirectMethod, shouldRedirect, includeBody = redirectBehavior(req.Method, resp, reqs[0])
 		if !shouldRedirect {
+			resp.RedirectTimings = redirectTimings
+			if len(reqs) > 1 {
+				resp.Via = reqs[:len(reqs)-1]
+			}
 			return resp, nil
 		}
+		redirectTimings = append(redirectTimings, time.Since(sentAt))
 		req.CloseBody()
 	}
 }
 
+// DoCapture is like Do, but also returns a copy of the first bytes of the
+// response body (at most MaxCaptureBytes of them), for logging or replay.
+// The returned Response's Body still yields the whole body, starting with
+// the captured bytes, and must be closed by the caller as usual.
+func (c *Client) DoCapture(req *Request) (*Response, []byte, error) {
+	resp, err := c.Do(req)
+	if err != nil {
+		return resp, nil, err
+	}
+	limit := c.MaxCaptureBytes
+	if limit <= 0 {
+		limit = DefaultMaxCaptureBytes
+	}
+	captured, err := ioutil.ReadAll(io.LimitReader(resp.Body, limit))
+	if err != nil {
+		resp.Body.Close()
+		return nil, nil, err
+	}
+	resp.Body = capturedBody{
+		Reader: io.MultiReader(bytes.NewReader(captured), resp.Body),
+		Closer: resp.Body,
+	}
+	return resp, captured, nil
+}
+
 // makeHeadersCopier makes a function that copies headers from the
 // initial Request, ireq. For every redirect, this function must be called
 // so that it can copy headers into the upcoming Request.
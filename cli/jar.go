@@ -247,15 +247,19 @@ func (j *Jar) domainAndType(host, domain string) (string, bool, error) {
 	}
 
 	// See RFC 6265 section 5.3 #5.
+	// Without a public suffix list, the top-level domain is taken as
+	// the public suffix, so at least "Domain=com" is rejected.
+	ps := domain[strings.LastIndexByte(domain, '.')+1:]
 	if j.psList != nil {
-		if ps := j.psList.PublicSuffix(domain); ps != "" && !hasDotSuffix(domain, ps) {
-			if host == domain {
-				// This is the one exception in which a cookie
-				// with a domain attribute is a host cookie.
-				return host, true, nil
-			}
-			return "", false, errIllegalDomain
+		ps = j.psList.PublicSuffix(domain)
+	}
+	if ps != "" && !hasDotSuffix(domain, ps) {
+		if host == domain {
+			// This is the one exception in which a cookie
+			// with a domain attribute is a host cookie.
+			return host, true, nil
 		}
+		return "", false, errIllegalDomain
 	}
 
 	// The domain must domain-match host: www.mycompany.com cannot
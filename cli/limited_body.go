@@ -0,0 +1,35 @@
+/*
+ * Copyright (c) 2018 The Go Authors. All rights reserved.
+ * Use of this source code is governed by a BSD-style license that can be found in the LICENSE file.
+ */
+
+package cli
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	// Ask for one byte more than allowed, to tell a body ending right
+	// at the limit from one going past it.
+	if int64(len(p)) > b.n+1 {
+		p = p[:b.n+1]
+	}
+	n, err := b.rc.Read(p)
+	if int64(n) <= b.n {
+		b.n -= int64(n)
+		b.err = err
+		return n, err
+	}
+	n = int(b.n)
+	b.n = 0
+	b.err = ErrResponseBodyTooLarge
+	return n, b.err
+}
+
+func (b *limitedBody) Close() error {
+	return b.rc.Close()
+}
+
+func (b *limitedBody) Reusable() bool {
+	return bodyReusable(b.rc)
+}
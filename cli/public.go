@@ -8,6 +8,7 @@ package cli
 import (
 	"fmt"
 	"io"
+	"io/ioutil"
 
 	. "github.com/badu/http"
 	"github.com/badu/http/hdr"
@@ -95,6 +96,25 @@ func Head(url string) (resp *Response, err error) {
 	return DefaultClient.Head(url)
 }
 
+// DrainResponse reads and discards up to max bytes of res.Body, then
+// closes it. Draining a body to EOF before closing lets the Transport
+// reuse the connection, while max bounds the work spent on it.
+// If the body holds more than max bytes, DrainResponse returns
+// ErrDrainTruncated.
+func DrainResponse(res *Response, max int64) error {
+	if res.Body == nil {
+		return nil
+	}
+	n, err := io.CopyN(ioutil.Discard, res.Body, max+1)
+	if closeErr := res.Body.Close(); err == nil || err == io.EOF {
+		err = closeErr
+	}
+	if err == nil && n > max {
+		err = ErrDrainTruncated
+	}
+	return err
+}
+
 //TODO : @badu - exported for tests
 func ShouldCopyHeaderOnRedirect(headerKey string, initial, dest *url.URL) bool {
 	return shouldCopyHeaderOnRedirect(headerKey, initial, dest)
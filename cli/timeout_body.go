@@ -0,0 +1,29 @@
+/*
+ * Copyright (c) 2018 The Go Authors. All rights reserved.
+ * Use of this source code is governed by a BSD-style license that can be found in the LICENSE file.
+ */
+
+package cli
+
+import (
+	"context"
+	"io"
+)
+
+func (b *timeoutBody) Read(p []byte) (int, error) {
+	n, err := b.rc.Read(p)
+	if err != nil && err != io.EOF && b.ctx.Err() == context.DeadlineExceeded {
+		err = &timeoutError{err: err, what: " (Client.Timeout exceeded while reading body)"}
+	}
+	return n, err
+}
+
+func (b *timeoutBody) Close() error {
+	err := b.rc.Close()
+	b.cancel()
+	return err
+}
+
+func (b *timeoutBody) Reusable() bool {
+	return bodyReusable(b.rc)
+}
@@ -0,0 +1,17 @@
+/*
+ * Copyright (c) 2018 The Go Authors. All rights reserved.
+ * Use of this source code is governed by a BSD-style license that can be found in the LICENSE file.
+ */
+
+package cli
+
+import "context"
+
+func (e *timeoutError) Error() string   { return e.err.Error() + e.what }
+func (e *timeoutError) Timeout() bool   { return true }
+func (e *timeoutError) Temporary() bool { return true }
+func (e *timeoutError) Unwrap() error   { return e.err }
+
+// Is reports the error as a context.DeadlineExceeded even when the
+// wrapped error, such as a canceled read, does not say so.
+func (e *timeoutError) Is(target error) bool { return target == context.DeadlineExceeded }
@@ -6,7 +6,9 @@
 package cli
 
 import (
+	"context"
 	"errors"
+	"io"
 	"sync"
 	"time"
 
@@ -64,9 +66,15 @@ type Client struct {
 	// unclosed, along with a nil error.
 	//
 	// If CheckRedirect is nil, the Client uses its default policy,
-	// which is to stop after 10 consecutive requests.
+	// which is to stop after MaxRedirects consecutive requests.
 	CheckRedirect func(req *Request, via []*Request) error
 
+	// MaxRedirects is the number of consecutive requests after which
+	// the default redirect policy stops. If zero, DefaultMaxRedirects
+	// is used. When CheckRedirect is set, it is consulted first, and
+	// MaxRedirects is only enforced on top of it if non-zero.
+	MaxRedirects int
+
 	// Jar specifies the cookie jar.
 	//
 	// The Jar is used to insert relevant cookies into every
@@ -77,6 +85,78 @@ type Client struct {
 	// If Jar is nil, cookies are only sent if they are explicitly
 	// set on the Request.
 	Jar CookieJar
+
+	// OnCookie, if non-nil, is called right after the Client hands
+	// the cookies received in a response to Jar.SetCookies, with the
+	// same arguments, including for the responses of followed redirects.
+	// It lets callers audit what gets stored (for instance unexpected
+	// third party cookies) without replacing the Jar. It is not called
+	// when Jar is nil.
+	OnCookie func(u *url.URL, set []*Cookie)
+
+	// MaxCaptureBytes limits how many bytes of the response body
+	// DoCapture keeps a copy of. If zero, DefaultMaxCaptureBytes is used.
+	MaxCaptureBytes int64
+
+	// MaxResponseBodyBytes, if positive, limits how many bytes can be
+	// read from a response Body. Reading past the limit fails with
+	// ErrResponseBodyTooLarge. When the Transport transparently
+	// decompresses a response, the decompressed bytes are counted.
+	// The limit is enforced lazily, as the Body is read, so streamed
+	// responses aren't penalized until they actually exceed it.
+	// Zero means no limit.
+	MaxResponseBodyBytes int64
+
+	// BaseContext, if non-nil, is the context of the requests sent
+	// with context.Background(), including the requests built by Get,
+	// Head and Post. Canceling it aborts all of them at once. Requests
+	// with a context of their own are left untouched.
+	BaseContext context.Context
+
+	// Timeout, if positive, limits the time taken by a request made by
+	// this Client, from the moment Do is called until the response
+	// Body is read. It covers connecting, following redirects and
+	// reading the response headers and body: the time limit is not
+	// reset by redirects. Once it is over, the request is canceled
+	// and the errors returned, including by reads of the Body, report
+	// a timeout through their Timeout method.
+	// Zero means no timeout.
+	Timeout time.Duration
+}
+
+// DefaultMaxCaptureBytes is the default value of Client's MaxCaptureBytes.
+const DefaultMaxCaptureBytes = 1 << 20 // 1 MB
+
+// DefaultMaxRedirects is the default value of Client's MaxRedirects.
+const DefaultMaxRedirects = 10
+
+// capturedBody is the response Body set by DoCapture: the captured bytes
+// followed by the rest of the original body, which it closes.
+type capturedBody struct {
+	io.Reader
+	io.Closer
+}
+
+// timeoutBody is the response Body set when Client.Timeout is positive. It
+// releases the request context when closed, and reports the reads failing
+// because the time is over as timeouts.
+type timeoutBody struct {
+	rc     io.ReadCloser
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// timeoutError is an error caused by Client.Timeout being over.
+type timeoutError struct {
+	err  error  // the error the Client.Timeout deadline caused
+	what string // appended to the message of err
+}
+
+// limitedBody is the response Body set when Client.MaxResponseBodyBytes is positive.
+type limitedBody struct {
+	rc  io.ReadCloser
+	n   int64 // bytes still allowed
+	err error // sticky error
 }
 
 // DefaultClient is the default Client and is used by Get, Head, and Post.
@@ -88,6 +168,15 @@ var DefaultClient = &Client{}
 // unclosed.
 var ErrUseLastResponse = errors.New("github.com/badu/http/cli: use last response")
 
+// ErrResponseBodyTooLarge is returned by reads of a response Body going
+// past the Client's MaxResponseBodyBytes.
+var ErrResponseBodyTooLarge = errors.New("github.com/badu/http/cli: response body too large")
+
+// ErrDrainTruncated is returned by DrainResponse when the response body
+// had more than the allowed number of bytes left. The connection is then
+// closed rather than reused.
+var ErrDrainTruncated = errors.New("github.com/badu/http/cli: response body exceeds drain limit")
+
 // A CookieJar manages storage and use of cookies in HTTP requests.
 //
 // Implementations of CookieJar must be safe for concurrent use by multiple
@@ -144,8 +233,9 @@ type Options struct {
 	// an HTTP server can set a cookie for a domain.
 	//
 	// A nil value is valid and may be useful for testing but it is not
-	// secure: it means that the HTTP server for foo.co.uk can set a cookie
-	// for bar.co.uk.
+	// secure: only top-level domains are then treated as public suffixes,
+	// so the HTTP server for foo.com can't set a cookie for all of com,
+	// but the HTTP server for foo.co.uk can set a cookie for bar.co.uk.
 	PublicSuffixList PublicSuffixList
 }
 
@@ -28,6 +28,28 @@ type Cookie struct {
 	MaxAge   int
 	Secure   bool
 	HttpOnly bool
+	SameSite SameSite // zero means no 'SameSite' attribute
 	Raw      string
 	Unparsed []string // Raw text of unparsed attribute-value pairs
 }
+
+// SameSite allows a server to define a cookie attribute making it impossible
+// for the browser to send this cookie along with cross-site requests. The
+// main goal is to mitigate the risk of cross-origin information leakage, and
+// provide some protection against cross-site request forgery attacks.
+//
+// See https://tools.ietf.org/html/draft-ietf-httpbis-cookie-same-site-00 for details.
+type SameSite int
+
+const (
+	// SameSiteDefault is set by RespCookies for a SameSite attribute
+	// without a known value. It is not written by SetCookie: the browser
+	// default is obtained by leaving the attribute out.
+	SameSiteDefault SameSite = iota + 1
+	SameSiteLax
+	SameSiteStrict
+	// SameSiteNone lets the cookie be sent along with cross-site requests.
+	// Browsers only accept it on cookies that are also Secure; SetCookie
+	// writes it regardless.
+	SameSiteNone
+)
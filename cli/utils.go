@@ -10,6 +10,7 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"strconv"
@@ -121,6 +122,16 @@ func send(ireq *Request, rt RoundTripper) (resp *Response, err error) {
 // encoded string in the credentials."
 // It is not meant to be urlencoded.
 // TODO :@badu - WAS MOVED TO public_request.go and it's public
+// bodyReusable reports whether the response body rc, wrapped by one of
+// the Client's bodies, gives its connection back to the idle pool. A body
+// that can't tell is assumed not to.
+func bodyReusable(rc io.Closer) bool {
+	if rb, ok := rc.(interface{ Reusable() bool }); ok {
+		return rb.Reusable()
+	}
+	return false
+}
+
 func basicAuth(username, password string) string {
 	auth := username + ":" + password
 	return base64.StdEncoding.EncodeToString([]byte(auth))
@@ -169,16 +180,21 @@ func redirectBehavior(reqMethod string, resp *Response, ireq *Request) (redirect
 	return redirectMethod, shouldRedirect, includeBody
 }
 
-func defaultCheckRedirect(req *Request, via []*Request) error {
-	if len(via) >= 10 {
-		return errors.New("stopped after 10 redirects")
+// checkRedirectLimit is the default redirect policy: it stops after max
+// consecutive requests, or DefaultMaxRedirects if max is zero.
+func checkRedirectLimit(max int, via []*Request) error {
+	if max <= 0 {
+		max = DefaultMaxRedirects
+	}
+	if len(via) >= max {
+		return fmt.Errorf("stopped after %d redirects", max)
 	}
 	return nil
 }
 
 func shouldCopyHeaderOnRedirect(headerKey string, initial, dest *url.URL) bool {
 	switch hdr.CanonicalHeaderKey(headerKey) {
-	case hdr.Authorization, "Www-Authenticate", hdr.CookieHeader, "Cookie2":
+	case hdr.Authorization, hdr.WWWAuthenticate, hdr.CookieHeader, "Cookie2":
 		// Permit sending auth/cookie headers from "foo.com"
 		// to "sub.foo.com".
 
@@ -545,6 +561,18 @@ func readSetCookies(h hdr.Header) []*Cookie {
 			case "httponly":
 				c.HttpOnly = true
 				continue
+			case "samesite":
+				switch strings.ToLower(val) {
+				case "lax":
+					c.SameSite = SameSiteLax
+				case "strict":
+					c.SameSite = SameSiteStrict
+				case "none":
+					c.SameSite = SameSiteNone
+				default:
+					c.SameSite = SameSiteDefault
+				}
+				continue
 			case "domain":
 				c.Domain = val
 				continue
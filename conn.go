@@ -10,12 +10,15 @@ import (
 	"context"
 	"crypto/tls"
 	"fmt"
+	"io"
 	"net"
 	"runtime"
+	"sync/atomic"
 	"time"
 
 	"github.com/badu/http/hdr"
 	"github.com/badu/http/url"
+	"golang.org/x/net/http2"
 )
 
 func (c *conn) hijacked() bool {
@@ -78,6 +81,15 @@ func (c *conn) readRequest(ctx context.Context) (*response, error) {
 
 	c.reader.setReadLimit(srv.initialReadLimitSize())
 
+	if srv.RejectLog != nil {
+		// the bytes already buffered are the start of this request
+		buffered, _ := c.bufReader.Peek(c.bufReader.Buffered())
+		c.rawHead = c.rawHead[:0]
+		c.capturing = true
+		c.captureRaw(buffered)
+		defer func() { c.capturing = false }()
+	}
+
 	// RFC 2616 section 4.1 tolerance for old buggy clients.
 	if c.lastMethod == POST {
 		peek, _ := c.bufReader.Peek(4) // ReadRequest will get err below
@@ -85,11 +97,14 @@ func (c *conn) readRequest(ctx context.Context) (*response, error) {
 	}
 
 	// @comment : reads info from the request (using textproto.Reader transforms bytes into textproto.MIMEHeader and other usefull info)
-	req, err := readRequest(c.bufReader, false)
+	req, err := readRequest(c.bufReader, false, srv.RejectBareLF, srv.KeepRawHeaders, 0)
 	if err != nil {
 		if c.reader.hitReadLimit() {
 			return nil, errTooLarge
 		}
+		if err == hdr.ErrBareLF {
+			return nil, badRequestError("bare LF in request header")
+		}
 		return nil, err
 	}
 
@@ -100,6 +115,9 @@ func (c *conn) readRequest(ctx context.Context) (*response, error) {
 
 	c.lastMethod = req.Method
 	c.reader.setInfiniteReadLimit()
+	if srv.MaxTrailerBytes > 0 {
+		limitTrailer(req.Body, srv.MaxTrailerBytes)
+	}
 
 	hosts, haveHost := req.Header[hdr.Host]
 	if req.ProtoAtLeast(1, 1) && (!haveHost || len(hosts) == 0) && req.Method != CONNECT {
@@ -134,6 +152,16 @@ func (c *conn) readRequest(ctx context.Context) (*response, error) {
 	req.TLS = c.tlsState
 	if body, ok := req.Body.(*body); ok {
 		body.doEarlyClose = true
+		if srv.VerifyContentLength && req.Close && body.bufReader == nil {
+			body.bufReader = c.bufReader
+			body.extraBytes = func() bool {
+				// @comment : read the conn itself, so that a timeout doesn't cancel the request like in connReader
+				c.netConIface.SetReadDeadline(time.Now().Add(verifyContentLengthWait))
+				n, _ := c.netConIface.Read(make([]byte, 1))
+				c.netConIface.SetReadDeadline(wholeReqDeadline)
+				return n > 0
+			}
+		}
 	}
 
 	// Adjust the read deadline if necessary.
@@ -199,6 +227,98 @@ func (c *conn) closeWriteAndWait() {
 	time.Sleep(rstAvoidanceDelay)
 }
 
+// serveH2C switches the connection to HTTP/2, as asked by the h2c upgrade
+// request of resp, and serves that request as stream 1. The connection
+// is to be closed once it returns.
+func (c *conn) serveH2C(srv *Server, resp *response, settings []http2.Setting) {
+	c.bufWriter.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: h2c\r\n\r\n")
+	if c.bufWriter.Flush() != nil {
+		return
+	}
+
+	sc := newH2CConn(c, resp.cancelCtx)
+	for _, s := range settings {
+		sc.applySetting(s)
+	}
+	// The server connection preface, then a GOAWAY telling the client
+	// that no stream but the upgraded one will be processed.
+	if sc.framer.WriteSettings() != nil || sc.framer.WriteGoAway(1, http2.ErrCodeNo, nil) != nil {
+		return
+	}
+	preface := make([]byte, len(http2.ClientPreface))
+	if _, err := io.ReadFull(c.bufReader, preface); err != nil || string(preface) != http2.ClientPreface {
+		return
+	}
+
+	readDone := make(chan struct{})
+	go sc.readFrames(readDone)
+	w := &h2cResponseWriter{sc: sc, srv: srv, header: make(hdr.Header), isHEAD: resp.req.Method == HEAD}
+	defer func() {
+		if !w.finished {
+			// the handler panicked
+			sc.writeFrame(func(fr *http2.Framer) error { return fr.WriteRSTStream(1, http2.ErrCodeInternal) })
+		}
+		// Let the client read the response before the connection is
+		// closed, then stop the frames reader, which uses c.bufReader.
+		if tcp, ok := c.netConIface.(closeWriter); ok {
+			tcp.CloseWrite()
+		}
+		select {
+		case <-readDone:
+		case <-time.After(rstAvoidanceDelay):
+		}
+		c.netConIface.SetReadDeadline(aLongTimeAgo)
+		<-readDone
+	}()
+
+	req := resp.req
+	req.Proto, req.ProtoMajor, req.ProtoMinor = "HTTP/2.0", 2, 0
+	req.Header.Del(hdr.Connection)
+	req.Header.Del(hdr.UpgradeHeader)
+	req.Header.Del(hdr.Http2Settings)
+	serverHandler{srv}.ServeHTTP(w, req)
+	w.finish()
+	resp.cancelCtx()
+}
+
+// captureRaw keeps p, up to maxRejectLogBytes in all, while the head of
+// a request is read for Server.RejectLog.
+func (c *conn) captureRaw(p []byte) {
+	if !c.capturing {
+		return
+	}
+	if room := maxRejectLogBytes - len(c.rawHead); room < len(p) {
+		p = p[:room]
+	}
+	c.rawHead = append(c.rawHead, p...)
+}
+
+// logReject reports the rejection of the request being read to
+// Server.RejectLog, if set.
+func (c *conn) logReject(srv *Server, reason string) {
+	if srv.RejectLog != nil {
+		srv.RejectLog(c.netConIface.RemoteAddr().String(), reason, c.rawHead)
+	}
+}
+
+// tlsConn returns the TLS connection c was accepted on, if any, looking
+// through the countingConn wrapping it.
+func (c *conn) tlsConn() (*tls.Conn, bool) {
+	nc := c.netConIface
+	if cc, ok := nc.(*countingConn); ok {
+		nc = cc.Conn
+	}
+	tlsConn, ok := nc.(*tls.Conn)
+	return tlsConn, ok
+}
+
+// doKeepAlives reports whether c may serve another request after the
+// current one: srv allows keep-alives and ShutdownListener isn't
+// draining the listener of c.
+func (c *conn) doKeepAlives(srv *Server) bool {
+	return srv.doKeepAlives() && atomic.LoadInt32(&c.draining) == 0
+}
+
 // Serve a new connection.
 //TODO : @badu - maybe this should return error???
 func (c *conn) serve(ctx context.Context) {
@@ -206,6 +326,9 @@ func (c *conn) serve(ctx context.Context) {
 	// TODO : @badu - what if nil?
 	srv := ctx.Value(SrvCtxtKey).(*Server)
 	ctx = context.WithValue(ctx, LocalAddrContextKey, c.netConIface.LocalAddr())
+	if c.bytes != nil {
+		ctx = context.WithValue(ctx, ConnBytesContextKey, c.bytes)
+	}
 	defer func() {
 		// @comment : recovering from panic
 		if err := recover(); err != nil && err != ErrAbortHandler {
@@ -222,7 +345,7 @@ func (c *conn) serve(ctx context.Context) {
 	}()
 
 	// TODO : @badu - we should know earlier to handle tls.Conn
-	if tlsConn, ok := c.netConIface.(*tls.Conn); ok {
+	if tlsConn, ok := c.tlsConn(); ok {
 		if d := srv.ReadTimeout; d != 0 {
 			c.netConIface.SetReadDeadline(time.Now().Add(d))
 		}
@@ -268,6 +391,7 @@ func (c *conn) serve(ctx context.Context) {
 				// responding to them and hanging up
 				// while they're still writing their
 				// request. Undefined behavior.
+				c.logReject(srv, "request header too large")
 				fmt.Fprintf(c.netConIface, "HTTP/1.1 431 Request Header Fields Too Large"+errorHeaders+"431 Request Header Fields Too Large")
 				c.closeWriteAndWait()
 				return
@@ -277,12 +401,15 @@ func (c *conn) serve(ctx context.Context) {
 			}
 
 			publicErr := "400 Bad Request"
+			reason := err.Error()
 
 			//TODO : @badu -Don’t assert errors for type, assert for behaviour.
 			if v, ok := err.(badRequestError); ok {
 				// //TODO : @badu - document - if conn.readRequest returned an error, it's typed badRequestError
 				publicErr = publicErr + ": " + string(v)
+				reason = string(v)
 			}
+			c.logReject(srv, reason)
 
 			fmt.Fprintf(c.netConIface, "HTTP/1.1 "+publicErr+errorHeaders+publicErr)
 			return
@@ -299,6 +426,14 @@ func (c *conn) serve(ctx context.Context) {
 			resp.sendExpectationFailed()
 			return
 		}
+		if srv.EnableH2C {
+			if settings, ok := h2cUpgradeSettings(req); ok {
+				c.curReq.Store(resp)
+				c.serveH2C(srv, resp, settings)
+				return
+			}
+		}
+
 		// @comment : store it in atomic.Value
 		c.curReq.Store(resp)
 
@@ -344,7 +479,7 @@ func (c *conn) serve(ctx context.Context) {
 		c.curReq.Store((*response)(nil))
 
 		//if !resp.conn.server.doKeepAlives() {
-		if !srv.doKeepAlives() {
+		if !c.doKeepAlives(srv) {
 			// We're in shutdown mode. We might've replied
 			// to the user without "Connection: close" and
 			// they might think they can send another
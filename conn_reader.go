@@ -133,11 +133,13 @@ func (c *connReader) Read(p []byte) (int, error) {
 		p[0] = c.byteBuf[0]
 		c.hasByte = false
 		c.unlock()
+		c.conn.captureRaw(p[:1])
 		return 1, nil
 	}
 	c.inRead = true
 	c.unlock()
 	n, err := c.conn.netConIface.Read(p)
+	c.conn.captureRaw(p[:n])
 
 	c.lock()
 	c.inRead = false
@@ -0,0 +1,45 @@
+/*
+ * Copyright (c) 2018 The Go Authors. All rights reserved.
+ * Use of this source code is governed by a BSD-style license that can be found in the LICENSE file.
+ */
+
+package http
+
+import (
+	"io"
+	"sync/atomic"
+)
+
+func (c *countingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	atomic.AddInt64(&c.bytes.Read, int64(n))
+	return n, err
+}
+
+func (c *countingConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	atomic.AddInt64(&c.bytes.Written, int64(n))
+	return n, err
+}
+
+// ReadFrom keeps the sendfile path of the wrapped connection available.
+func (c *countingConn) ReadFrom(r io.Reader) (int64, error) {
+	var n int64
+	var err error
+	if rf, ok := c.Conn.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(r)
+	} else {
+		n, err = io.Copy(writerOnly{c.Conn}, r)
+	}
+	atomic.AddInt64(&c.bytes.Written, n)
+	return n, err
+}
+
+// CloseWrite shuts down the writing side of the wrapped connection, if
+// it supports it.
+func (c *countingConn) CloseWrite() error {
+	if cw, ok := c.Conn.(closeWriter); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
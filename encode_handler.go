@@ -0,0 +1,30 @@
+/*
+ * Copyright (c) 2018 The Go Authors. All rights reserved.
+ * Use of this source code is governed by a BSD-style license that can be found in the LICENSE file.
+ */
+
+package http
+
+import "github.com/badu/http/hdr"
+
+func (h *encodeHandler) ServeHTTP(w ResponseWriter, r *Request) {
+	srv, _ := r.Context().Value(SrvCtxtKey).(*Server)
+	if srv == nil || r.Method == HEAD {
+		h.handler.ServeHTTP(w, r)
+		return
+	}
+	encoding := negotiateEncoding(r.Header.Get(hdr.AcceptEncoding), func(encoding string) bool {
+		return srv.encoder(encoding) != nil
+	})
+	if encoding == "" {
+		h.handler.ServeHTTP(w, r)
+		return
+	}
+	ew := &encodeWriter{
+		respWriter: w,
+		encoding:   encoding,
+		newWriter:  srv.encoder(encoding),
+	}
+	defer ew.close()
+	h.handler.ServeHTTP(ew, r)
+}
@@ -0,0 +1,68 @@
+/*
+ * Copyright (c) 2018 The Go Authors. All rights reserved.
+ * Use of this source code is governed by a BSD-style license that can be found in the LICENSE file.
+ */
+
+package http
+
+import (
+	"github.com/badu/http/hdr"
+	"github.com/badu/http/sniff"
+)
+
+func (w *encodeWriter) Header() hdr.Header { return w.respWriter.Header() }
+
+func (w *encodeWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		// sniff the content type now, the server would see the encoded bytes
+		if h := w.Header(); h.Get(hdr.ContentType) == "" && h.Get(hdr.ContentEncoding) == "" && len(p) > 0 {
+			h.Set(hdr.ContentType, sniff.DetectContentType(p))
+		}
+		w.WriteHeader(StatusOK)
+	}
+	if w.enc == nil {
+		return w.respWriter.Write(p)
+	}
+	return w.enc.Write(p)
+}
+
+func (w *encodeWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	if code >= 100 && code <= 199 {
+		w.respWriter.WriteHeader(code)
+		return
+	}
+	w.wroteHeader = true
+	h := w.Header()
+	if h.Get(hdr.ContentEncoding) == "" && bodyAllowedForStatus(code) &&
+		!(w.skipCompressed && isCompressedContentType(h.Get(hdr.ContentType))) {
+		h.Del(hdr.ContentLength)
+		h.Set(hdr.ContentEncoding, w.encoding)
+		h.Add("Vary", hdr.AcceptEncoding)
+		w.enc = w.newWriter(w.respWriter)
+	}
+	w.respWriter.WriteHeader(code)
+}
+
+// Flush flushes the encoder, if it can be, then the response.
+func (w *encodeWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(StatusOK)
+	}
+	if f, ok := w.enc.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	if f, ok := w.respWriter.(Flusher); ok {
+		f.Flush()
+	}
+}
+
+// close finishes the encoded body, once the handler has returned.
+func (w *encodeWriter) close() error {
+	if w.enc == nil {
+		return nil
+	}
+	return w.enc.Close()
+}
@@ -0,0 +1,43 @@
+/*
+ * Copyright (c) 2018 The Go Authors. All rights reserved.
+ * Use of this source code is governed by a BSD-style license that can be found in the LICENSE file.
+ */
+
+package http
+
+import (
+	"bytes"
+	"strings"
+)
+
+// Send sends an event named event, or an unnamed one if event is empty,
+// carrying data. Each line of data goes in its own "data:" field, so the
+// client gets data back with its line breaks normalized to "\n".
+func (w *EventStreamWriter) Send(event, data string) error {
+	if strings.ContainsAny(event, "\r\n") {
+		return errEventName
+	}
+	var buf bytes.Buffer
+	if event != "" {
+		buf.WriteString("event: " + event + "\n")
+	}
+	writeEventLines(&buf, "data: ", data)
+	buf.WriteByte('\n')
+	return w.write(buf.Bytes())
+}
+
+// SendComment sends a comment, which clients ignore. Comments are
+// commonly sent to keep the connection alive when no event happens.
+func (w *EventStreamWriter) SendComment(comment string) error {
+	var buf bytes.Buffer
+	writeEventLines(&buf, ": ", comment)
+	return w.write(buf.Bytes())
+}
+
+func (w *EventStreamWriter) write(p []byte) error {
+	if _, err := w.respWriter.Write(p); err != nil {
+		return err
+	}
+	w.flusher.Flush()
+	return nil
+}
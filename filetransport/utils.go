@@ -117,6 +117,18 @@ func ServeContent(w ResponseWriter, r *Request, name string, modtime time.Time,
 	serveContent(w, r, name, modtime, sizeFunc, content)
 }
 
+// ServeContentRange is like ServeContent for content that has no file name:
+// unless the response's Content-Type header is set, the type is sniffed
+// from the first block of the content.
+//
+// A Range request gets a 206 Partial Content reply, with a Content-Range
+// header for a single range, or a multipart/byteranges body for several
+// ones. A Range that can't be satisfied gets a 416 Requested Range Not
+// Satisfiable reply.
+func ServeContentRange(w ResponseWriter, r *Request, modtime time.Time, content io.ReadSeeker) {
+	ServeContent(w, r, "", modtime, content)
+}
+
 // if name is empty, filename is unknown. (used for mime type, before sniffing)
 // if modtime.IsZero(), modtime is unknown.
 // content must be seeked to the beginning of the file.
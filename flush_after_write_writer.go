@@ -0,0 +1,15 @@
+/*
+ * Copyright (c) 2018 The Go Authors. All rights reserved.
+ * Use of this source code is governed by a BSD-style license that can be found in the LICENSE file.
+ */
+
+package http
+
+// Write writes p to the buffer and flushes it out to the network.
+func (fw *FlushAfterWriteWriter) Write(p []byte) (int, error) {
+	n, err := fw.Writer.Write(p)
+	if err != nil {
+		return n, err
+	}
+	return n, fw.Writer.Flush()
+}
@@ -0,0 +1,12 @@
+/*
+ * Copyright (c) 2018 The Go Authors. All rights reserved.
+ * Use of this source code is governed by a BSD-style license that can be found in the LICENSE file.
+ */
+
+package http
+
+// Close finishes the gzip stream. It does not close the underlying
+// ResponseWriter.
+func (w *GzipResponseWriter) Close() error {
+	return w.close()
+}
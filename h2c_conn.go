@@ -0,0 +1,222 @@
+/*
+ * Copyright (c) 2018 The Go Authors. All rights reserved.
+ * Use of this source code is governed by a BSD-style license that can be found in the LICENSE file.
+ */
+
+package http
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/badu/http/hdr"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+func newH2CConn(c *conn, cancel func()) *h2cConn {
+	sc := &h2cConn{
+		conn:          c,
+		cancel:        cancel,
+		framer:        http2.NewFramer(checkConnErrorWriter{c}, c.bufReader),
+		connWindow:    h2cInitialWindowSize,
+		streamWindow:  h2cInitialWindowSize,
+		initialWindow: h2cInitialWindowSize,
+		maxFrameSize:  h2cDefaultMaxFrameSize,
+	}
+	sc.henc = hpack.NewEncoder(&sc.hbuf)
+	sc.cond = sync.NewCond(&sc.mu)
+	return sc
+}
+
+// applySetting applies a setting of the client, which must be valid.
+// sc.mu must be held.
+func (sc *h2cConn) applySetting(s http2.Setting) {
+	switch s.ID {
+	case http2.SettingInitialWindowSize:
+		sc.streamWindow += int64(s.Val) - sc.initialWindow
+		sc.initialWindow = int64(s.Val)
+	case http2.SettingMaxFrameSize:
+		sc.maxFrameSize = s.Val
+	}
+}
+
+// abort makes the pending and future writes to the stream fail with err,
+// and cancels the request.
+func (sc *h2cConn) abort(err error) {
+	sc.mu.Lock()
+	if sc.err == nil {
+		sc.err = err
+	}
+	sc.cond.Broadcast()
+	sc.mu.Unlock()
+	sc.cancel()
+}
+
+// frameSizeLocked returns the largest frame payload the client accepts,
+// never less than the HTTP/2 minimum so that writes always progress.
+// sc.mu must be held.
+func (sc *h2cConn) frameSizeLocked() int {
+	if sc.maxFrameSize < h2cDefaultMaxFrameSize {
+		return h2cDefaultMaxFrameSize
+	}
+	return int(sc.maxFrameSize)
+}
+
+func (sc *h2cConn) writeFrame(fn func(*http2.Framer) error) error {
+	sc.wmu.Lock()
+	defer sc.wmu.Unlock()
+	return fn(sc.framer)
+}
+
+// readFrames reads the frames of the client until the connection fails
+// or is closed, then closes done.
+func (sc *h2cConn) readFrames(done chan struct{}) {
+	defer close(done)
+	for {
+		f, err := sc.framer.ReadFrame()
+		if err != nil {
+			sc.abort(err)
+			return
+		}
+		switch f := f.(type) {
+		case *http2.SettingsFrame:
+			if f.IsAck() {
+				continue
+			}
+			if err := f.ForeachSetting(func(s http2.Setting) error { return s.Valid() }); err != nil {
+				code := http2.ErrCodeProtocol
+				if ce, ok := err.(http2.ConnectionError); ok {
+					code = http2.ErrCode(ce)
+				}
+				sc.writeFrame(func(fr *http2.Framer) error { return fr.WriteGoAway(1, code, nil) })
+				sc.abort(err)
+				return
+			}
+			sc.mu.Lock()
+			f.ForeachSetting(func(s http2.Setting) error {
+				sc.applySetting(s)
+				return nil
+			})
+			sc.cond.Broadcast()
+			sc.mu.Unlock()
+			sc.writeFrame(func(fr *http2.Framer) error { return fr.WriteSettingsAck() })
+		case *http2.WindowUpdateFrame:
+			sc.mu.Lock()
+			switch f.StreamID {
+			case 0:
+				sc.connWindow += int64(f.Increment)
+			case 1:
+				sc.streamWindow += int64(f.Increment)
+			}
+			sc.cond.Broadcast()
+			sc.mu.Unlock()
+		case *http2.PingFrame:
+			if !f.IsAck() {
+				sc.writeFrame(func(fr *http2.Framer) error { return fr.WritePing(true, f.Data) })
+			}
+		case *http2.RSTStreamFrame:
+			if f.StreamID == 1 {
+				sc.abort(errH2CStreamReset)
+			}
+		case *http2.HeadersFrame:
+			// only the upgraded stream is served, see the GOAWAY sent by serveH2C
+			if f.StreamID != 1 {
+				sc.writeFrame(func(fr *http2.Framer) error { return fr.WriteRSTStream(f.StreamID, http2.ErrCodeRefusedStream) })
+			}
+		case *http2.DataFrame:
+			// give back the connection window taken by data we don't read
+			if n := f.Header().Length; n > 0 {
+				sc.writeFrame(func(fr *http2.Framer) error { return fr.WriteWindowUpdate(0, n) })
+			}
+		}
+	}
+}
+
+// writeHeaders sends the HEADERS frame, followed by CONTINUATION frames
+// if needed, of a response to the stream.
+func (sc *h2cConn) writeHeaders(status int, header hdr.Header, endStream bool) error {
+	sc.mu.Lock()
+	err, maxFrameSize := sc.err, sc.frameSizeLocked()
+	sc.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	sc.wmu.Lock()
+	defer sc.wmu.Unlock()
+	sc.hbuf.Reset()
+	sc.henc.WriteField(hpack.HeaderField{Name: ":status", Value: strconv.Itoa(status)})
+	for k, vv := range header {
+		switch k {
+		case hdr.Connection, "Keep-Alive", "Proxy-Connection", hdr.TransferEncoding, hdr.UpgradeHeader:
+			// connection-specific, not allowed in HTTP/2
+			continue
+		}
+		name := strings.ToLower(k)
+		for _, v := range vv {
+			sc.henc.WriteField(hpack.HeaderField{Name: name, Value: v})
+		}
+	}
+	block := sc.hbuf.Bytes()
+	first := block
+	if len(first) > maxFrameSize {
+		first = first[:maxFrameSize]
+	}
+	block = block[len(first):]
+	err = sc.framer.WriteHeaders(http2.HeadersFrameParam{
+		StreamID:      1,
+		BlockFragment: first,
+		EndStream:     endStream,
+		EndHeaders:    len(block) == 0,
+	})
+	for err == nil && len(block) > 0 {
+		frag := block
+		if len(frag) > maxFrameSize {
+			frag = frag[:maxFrameSize]
+		}
+		block = block[len(frag):]
+		err = sc.framer.WriteContinuation(1, len(block) == 0, frag)
+	}
+	return err
+}
+
+// writeData sends p to the stream in DATA frames, as the flow control
+// windows allow. If endStream is set, the last frame ends the stream.
+func (sc *h2cConn) writeData(p []byte, endStream bool) error {
+	for len(p) > 0 || endStream {
+		sc.mu.Lock()
+		for sc.err == nil && len(p) > 0 && (sc.connWindow <= 0 || sc.streamWindow <= 0) {
+			sc.cond.Wait()
+		}
+		if err := sc.err; err != nil {
+			sc.mu.Unlock()
+			return err
+		}
+		n := int64(len(p))
+		if max := int64(sc.frameSizeLocked()); n > max {
+			n = max
+		}
+		if n > sc.connWindow {
+			n = sc.connWindow
+		}
+		if n > sc.streamWindow {
+			n = sc.streamWindow
+		}
+		sc.connWindow -= n
+		sc.streamWindow -= n
+		sc.mu.Unlock()
+
+		chunk := p[:n]
+		p = p[n:]
+		end := endStream && len(p) == 0
+		if err := sc.writeFrame(func(fr *http2.Framer) error { return fr.WriteData(1, end, chunk) }); err != nil {
+			return err
+		}
+		if end {
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+/*
+ * Copyright (c) 2018 The Go Authors. All rights reserved.
+ * Use of this source code is governed by a BSD-style license that can be found in the LICENSE file.
+ */
+
+package http
+
+import (
+	"strconv"
+
+	"github.com/badu/http/hdr"
+	"github.com/badu/http/sniff"
+)
+
+func (w *h2cResponseWriter) Header() hdr.Header { return w.header }
+
+func (w *h2cResponseWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.status = code
+}
+
+func (w *h2cResponseWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		if w.header.Get(hdr.ContentType) == "" && len(p) > 0 {
+			w.header.Set(hdr.ContentType, sniff.DetectContentType(p))
+		}
+		w.WriteHeader(StatusOK)
+	}
+	if !bodyAllowedForStatus(w.status) {
+		return 0, ErrBodyNotAllowed
+	}
+	w.written += int64(len(p))
+	if w.isHEAD {
+		// The response to a HEAD has no body; the HEADERS frame is
+		// sent, ending the stream, by finish.
+		return len(p), nil
+	}
+	if err := w.sendHeader(false); err != nil {
+		return 0, err
+	}
+	if err := w.sc.writeData(p, false); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush sends the response header, if it wasn't yet. The body isn't
+// buffered, so there is nothing else to flush. For a HEAD, the header
+// is held back until finish, to end the stream with it.
+func (w *h2cResponseWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(StatusOK)
+	}
+	if w.isHEAD {
+		return
+	}
+	w.sendHeader(false)
+}
+
+// sendHeader sends the HEADERS frame of the response, once.
+func (w *h2cResponseWriter) sendHeader(endStream bool) error {
+	if w.sentHeader {
+		return nil
+	}
+	w.sentHeader = true
+	if _, ok := w.header[hdr.Date]; !ok {
+		w.header.Set(hdr.Date, w.srv.now().UTC().Format(TimeFormat))
+	}
+	return w.sc.writeHeaders(w.status, w.header, endStream)
+}
+
+// finish ends the stream, once the handler has returned.
+func (w *h2cResponseWriter) finish() {
+	if !w.wroteHeader {
+		w.WriteHeader(StatusOK)
+	}
+	if w.sentHeader {
+		w.sc.writeData(nil, true)
+	} else {
+		if bodyAllowedForStatus(w.status) && w.header.Get(hdr.ContentLength) == "" {
+			// For a HEAD, the length of the body the handler wrote,
+			// as the HTTP/1 response does.
+			w.header.Set(hdr.ContentLength, strconv.FormatInt(w.written, 10))
+		}
+		w.sendHeader(true)
+	}
+	w.finished = true
+}
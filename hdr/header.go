@@ -6,6 +6,7 @@
 package hdr
 
 import (
+	"bytes"
 	"io"
 	"sort"
 )
@@ -28,8 +29,8 @@ func (h Header) Set(key, value string) {
 // It is case insensitive; CanonicalHeaderKey is used
 // to canonicalize the provided key.
 // If there are no values associated with the key, Get returns "".
-// To access multiple values of a key, or to use non-canonical keys,
-// access the map directly.
+// To access multiple values of a key, use Values. To use non-canonical
+// keys, use GetRaw.
 func (h Header) Get(key string) string {
 	if h == nil {
 		return ""
@@ -41,6 +42,21 @@ func (h Header) Get(key string) string {
 	return v[0]
 }
 
+// Values returns all values associated with the given key.
+// Like Get, it is case insensitive; CanonicalHeaderKey is used
+// to canonicalize the provided key. The returned slice is not a copy.
+func (h Header) Values(key string) []string {
+	return h[CanonicalHeaderKey(key)]
+}
+
+// GetRaw returns all values associated with exactly the given key,
+// without canonicalizing it, so that headers stored under non-canonical
+// keys, like "WWW-Authenticate", can be retrieved. The returned slice is
+// not a copy.
+func (h Header) GetRaw(key string) []string {
+	return h[key]
+}
+
 // get is like Get, but key must already be in CanonicalHeaderKey form.
 func (h Header) get(key string) string {
 	if v := h[key]; len(v) > 0 {
@@ -80,6 +96,41 @@ func (h Header) CopyFromHeader(src Header) {
 	}
 }
 
+// CanonicalBytes returns a deterministic representation of the headers
+// named by keys, suitable for signing a request or computing a digest.
+// Each header is written on its own "Key: value\r\n" line, in sorted
+// order of the canonicalized keys, with its multiple values joined by
+// ", " in the order they appear in h. Values are trimmed and cleaned of
+// newlines like Write does. Duplicate keys are written once and keys
+// without values in h are left out.
+func (h Header) CanonicalBytes(keys []string) []byte {
+	names := make([]string, 0, len(keys))
+	seen := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		k = CanonicalHeaderKey(k)
+		if seen[k] || len(h[k]) == 0 {
+			continue
+		}
+		seen[k] = true
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	for _, k := range names {
+		buf.WriteString(k)
+		buf.WriteString(": ")
+		for i, v := range h[k] {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			buf.WriteString(TrimString(HeaderNewlineToSpace.Replace(v)))
+		}
+		buf.WriteString("\r\n")
+	}
+	return buf.Bytes()
+}
+
 // sortedKeyValues returns h's keys sorted in the returned kvs
 // slice. The headerSorter used to sort is also returned, for possible
 // return to headerSorterCache.
@@ -108,16 +159,48 @@ func (h Header) WriteSubset(w io.Writer, exclude map[string]bool) error {
 	}
 	kvs, sorter := h.sortedKeyValues(exclude)
 	for _, kv := range kvs {
-		for _, v := range kv.values {
-			v = HeaderNewlineToSpace.Replace(v)
-			v = TrimString(v)
-			for _, s := range []string{kv.key, ": ", v, "\r\n"} {
-				if _, err := ws.WriteString(s); err != nil {
-					return err
-				}
-			}
+		if err := writeKeyValues(ws, kv.key, kv.values); err != nil {
+			return err
 		}
 	}
 	headerSorterPool.Put(sorter)
 	return nil
 }
+
+// WriteSorted writes a header in wire format like Write, except that the
+// keys listed in order are written first, in that order. The other keys
+// follow, sorted as Write does. Listed keys are canonicalized, and those
+// missing from the header or listed twice are skipped.
+func (h Header) WriteSorted(w io.Writer, order []string) error {
+	ws, ok := w.(writeStringer)
+	if !ok {
+		ws = stringWriter{w}
+	}
+	written := make(map[string]bool, len(order))
+	for _, k := range order {
+		k = CanonicalHeaderKey(k)
+		vv, ok := h[k]
+		if !ok || written[k] {
+			continue
+		}
+		written[k] = true
+		if err := writeKeyValues(ws, k, vv); err != nil {
+			return err
+		}
+	}
+	return h.WriteSubset(w, written)
+}
+
+// writeKeyValues writes a "key: value" line for each of the values.
+func writeKeyValues(ws writeStringer, key string, values []string) error {
+	for _, v := range values {
+		v = HeaderNewlineToSpace.Replace(v)
+		v = TrimString(v)
+		for _, s := range []string{key, ": ", v, "\r\n"} {
+			if _, err := ws.WriteString(s); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
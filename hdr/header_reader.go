@@ -6,10 +6,20 @@
 package hdr
 
 import (
+	"bufio"
 	"bytes"
 	"errors"
 )
 
+// Reset makes r read from br, clearing its settings and the bytes it
+// counted, so a HeaderReader can be reused.
+func (r *HeaderReader) Reset(br *bufio.Reader) {
+	r.R = br
+	r.RejectBareLF = false
+	r.MaxBytes = 0
+	r.read = 0
+}
+
 // ReadLine reads a single line from r,
 // eliding the final \n or \r\n from the returned string.
 func (r *HeaderReader) ReadLine() (string, error) {
@@ -19,12 +29,23 @@ func (r *HeaderReader) ReadLine() (string, error) {
 
 func (r *HeaderReader) readLineSlice() ([]byte, error) {
 	r.closeDot()
+	if r.RejectBareLF {
+		return r.readStrictLineSlice()
+	}
 	var line []byte
 	for {
 		l, more, err := r.R.ReadLine()
 		if err != nil {
 			return nil, err
 		}
+		// ReadLine drops the line terminator, count it as a single \n
+		n := len(l)
+		if !more {
+			n++
+		}
+		if err := r.count(n); err != nil {
+			return nil, err
+		}
 		// Avoid the copy if the first call produced a full line.
 		if line == nil && !more {
 			return l, nil
@@ -37,6 +58,48 @@ func (r *HeaderReader) readLineSlice() ([]byte, error) {
 	return line, nil
 }
 
+// readStrictLineSlice is like readLineSlice, but requires the line to end in \r\n.
+func (r *HeaderReader) readStrictLineSlice() ([]byte, error) {
+	var line []byte
+	for {
+		l, err := r.R.ReadSlice('\n')
+		if cerr := r.count(len(l)); cerr != nil {
+			return nil, cerr
+		}
+		if err == bufio.ErrBufferFull {
+			line = append(line, l...)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		// Avoid the copy if the first call produced a full line.
+		if line == nil {
+			line = l
+		} else {
+			line = append(line, l...)
+		}
+		break
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return nil, ErrBareLF
+	}
+	return line[:len(line)-2], nil
+}
+
+// count adds n bytes to the bytes read, failing with ErrHeaderTooLarge
+// past MaxBytes.
+func (r *HeaderReader) count(n int) error {
+	if r.MaxBytes <= 0 {
+		return nil
+	}
+	r.read += int64(n)
+	if r.read > r.MaxBytes {
+		return ErrHeaderTooLarge
+	}
+	return nil
+}
+
 func (r *HeaderReader) readContinuedLineSlice() ([]byte, error) {
 	// Read the first line.
 	line, err := r.readLineSlice()
@@ -127,6 +190,19 @@ func (r *HeaderReader) closeDot() {
 //	}
 //
 func (r *HeaderReader) ReadHeader() (Header, error) {
+	return r.readHeader(nil)
+}
+
+// ReadHeaderRaw is like ReadHeader, but also returns the header fields
+// in the order they were read, with their keys in their original casing.
+func (r *HeaderReader) ReadHeaderRaw() (Header, []KV, error) {
+	var raw []KV
+	m, err := r.readHeader(&raw)
+	return m, raw, err
+}
+
+// readHeader implements ReadHeader, also appending every field to raw if non-nil.
+func (r *HeaderReader) readHeader(raw *[]KV) (Header, error) {
 	// Avoid lots of small slice allocations later by allocating one
 	// large one ahead of time which we'll cut up into smaller
 	// slices. If this isn't big enough later, we allocate small ones.
@@ -164,6 +240,11 @@ func (r *HeaderReader) ReadHeader() (Header, error) {
 		for endKey > 0 && kv[endKey-1] == ' ' {
 			endKey--
 		}
+		var rawKey string
+		if raw != nil {
+			// before canonicalMIMEHeaderKey, which works in place
+			rawKey = string(kv[:endKey])
+		}
 		key := canonicalMIMEHeaderKey(kv[:endKey])
 
 		// As per RFC 7230 field-name is a token, tokens consist of one or more chars.
@@ -179,6 +260,9 @@ func (r *HeaderReader) ReadHeader() (Header, error) {
 			i++
 		}
 		value := string(kv[i:])
+		if raw != nil {
+			*raw = append(*raw, KV{Key: rawKey, Value: value})
+		}
 
 		vv := m[key]
 		if vv == nil && len(strs) > 0 {
@@ -7,6 +7,8 @@ package hdr
 
 import (
 	"bufio"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -25,6 +27,61 @@ func ParseTime(text string) (time.Time, error) {
 	return t, err
 }
 
+// ParseAltSvc returns the alternative services advertised by the Alt-Svc
+// values of h, in the order they appear. Malformed alternatives are
+// skipped, as are malformed parameters of an otherwise valid one.
+// A "clear" value is returned as an AltSvc with only Clear set.
+func ParseAltSvc(h Header) []AltSvc {
+	var alts []AltSvc
+	for _, v := range h[AltSvcHeader] {
+		if TrimString(v) == "clear" {
+			alts = append(alts, AltSvc{Clear: true})
+			continue
+		}
+		for v != "" {
+			var (
+				key, value string
+				sep        byte
+				ok         bool
+			)
+			key, value, sep, v, ok = altSvcPair(v)
+			alt := AltSvc{MaxAge: 24 * time.Hour}
+			if ok {
+				alt.Protocol, ok = percentDecode(key)
+			}
+			if ok {
+				alt.Host, alt.Port, ok = splitAltAuthority(value)
+			}
+			for sep == ';' {
+				var pok bool
+				key, value, sep, v, pok = altSvcPair(v)
+				if !pok {
+					continue
+				}
+				key = strings.ToLower(key)
+				switch key {
+				case "ma":
+					secs, err := strconv.ParseInt(value, 10, 64)
+					if err != nil || secs < 0 {
+						continue
+					}
+					alt.MaxAge = time.Duration(secs) * time.Second
+				case "persist":
+					alt.Persist = value == "1"
+				}
+				if alt.Params == nil {
+					alt.Params = make(map[string]string)
+				}
+				alt.Params[key] = value
+			}
+			if ok {
+				alts = append(alts, alt)
+			}
+		}
+	}
+	return alts
+}
+
 // TrimString returns s without leading and trailing ASCII space.
 func TrimString(s string) string {
 	for len(s) > 0 && isASCIISpace(s[0]) {
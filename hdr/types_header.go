@@ -7,6 +7,7 @@ package hdr
 
 import (
 	"bufio"
+	"errors"
 	"io"
 	"strings"
 	"sync"
@@ -22,6 +23,7 @@ const (
 	AcceptEncoding          = "Accept-Encoding"
 	AcceptLanguage          = "Accept-Language"
 	AcceptRanges            = "Accept-Ranges"
+	AltSvcHeader            = "Alt-Svc"
 	Authorization           = "Authorization"
 	CacheControl            = "Cache-Control"
 	Cc                      = "Cc"
@@ -41,10 +43,13 @@ const (
 	Expect                  = "Expect"
 	From                    = "From"
 	Host                    = "Host"
+	Http2Settings           = "Http2-Settings"
+	IdempotencyKey          = "Idempotency-Key"
 	IfModifiedSince         = "If-Modified-Since"
 	IfNoneMatch             = "If-None-Match"
 	InReplyTo               = "In-Reply-To"
 	LastModified            = "Last-Modified"
+	Link                    = "Link"
 	Location                = "Location"
 	MessageId               = "Message-Id"
 	MimeVersion             = "Mime-Version"
@@ -52,15 +57,20 @@ const (
 	Received                = "Received"
 	Referer                 = "Referer"
 	ReturnPath              = "Return-Path"
+	SecWebSocketAccept      = "Sec-Websocket-Accept"
+	SecWebSocketKey         = "Sec-Websocket-Key"
+	SecWebSocketVersion     = "Sec-Websocket-Version"
 	ServerHeader            = "Server"
 	SetCookieHeader         = "Set-Cookie"
 	Subject                 = "Subject"
+	TEHeader                = "Te"
 	TransferEncoding        = "Transfer-Encoding"
 	To                      = "To"
 	Trailer                 = "Trailer"
 	UpgradeHeader           = "Upgrade"
 	UserAgent               = "User-Agent"
 	Via                     = "Via"
+	WWWAuthenticate         = "Www-Authenticate"
 	XForwardedFor           = "X-Forwarded-For"
 	XImforwards             = "X-Imforwards"
 	XPoweredBy              = "X-Powered-By"
@@ -77,6 +87,14 @@ var (
 
 	HeaderNewlineToSpace = strings.NewReplacer("\n", " ", "\r", " ")
 
+	// ErrBareLF is returned by a HeaderReader with RejectBareLF set
+	// when a line is terminated by a bare \n instead of \r\n.
+	ErrBareLF = errors.New("malformed MIME header: line terminated by bare LF")
+
+	// ErrHeaderTooLarge is returned by a HeaderReader with MaxBytes set
+	// when the lines it reads exceed MaxBytes.
+	ErrHeaderTooLarge = errors.New("http: header too large")
+
 	headerSorterPool = sync.Pool{
 		New: func() interface{} {
 			return new(headerSorter)
@@ -127,6 +145,16 @@ type (
 		R   *bufio.Reader
 		dot *headerDotReader
 		buf []byte // a re-usable buffer for readContinuedLineSlice
+
+		// RejectBareLF makes the reader fail with ErrBareLF on lines
+		// that are not terminated by \r\n.
+		RejectBareLF bool
+
+		// MaxBytes, if positive, limits how many bytes the reader reads,
+		// line terminators included; reading past it fails with
+		// ErrHeaderTooLarge.
+		MaxBytes int64
+		read     int64 // bytes read so far, counted when MaxBytes is set
 	}
 
 	headerDotReader struct {
@@ -136,6 +164,32 @@ type (
 
 	// A Header represents the key-value pairs in an HTTP header.
 	Header map[string][]string
+
+	// KV is a single header field, in the form it was written on the wire.
+	KV struct {
+		Key   string
+		Value string
+	}
+
+	// AltSvc is one alternative service advertised by a server in an
+	// Alt-Svc response header (RFC 7838).
+	AltSvc struct {
+		// Clear is set when the header was "clear": the server asks the
+		// client to forget all the alternatives it advertised before.
+		// The other fields are then empty.
+		Clear bool
+
+		Protocol string        // ALPN protocol ID, such as "h2"
+		Host     string        // empty means the host of the origin
+		Port     string        // port of the alternative
+		MaxAge   time.Duration // "ma" parameter; 24 hours if absent
+		Persist  bool          // "persist=1" parameter
+
+		// Params holds every parameter of the alternative, including
+		// ma and persist, keyed by lower-cased name.
+		Params map[string]string
+	}
+
 	// @comment : in "strings" package there is the same thing called stringWriterIface
 	writeStringer interface {
 		WriteString(string) (int, error)
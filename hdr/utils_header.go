@@ -5,6 +5,12 @@
 
 package hdr
 
+import (
+	"net"
+	"strconv"
+	"strings"
+)
+
 func isASCIISpace(b byte) bool {
 	return b == ' ' || b == '\t' || b == '\n' || b == '\r'
 }
@@ -138,3 +144,89 @@ func init() {
 		commonHeader[v] = v
 	}
 }
+
+// altSvcPair scans one key=value pair of an Alt-Svc header value from s,
+// where value is either a token or a quoted-string. It returns the byte
+// that ended the pair (';', ',' or 0 at the end of s) and what follows
+// it. ok is false if the pair is malformed.
+func altSvcPair(s string) (key, value string, sep byte, rest string, ok bool) {
+	i := 0
+	for i < len(s) && s[i] != '=' && s[i] != ';' && s[i] != ',' {
+		i++
+	}
+	key = TrimString(s[:i])
+	ok = key != "" && i < len(s) && s[i] == '='
+	if ok {
+		s = strings.TrimLeft(s[i+1:], " \t")
+		if len(s) > 0 && s[0] == '"' {
+			var buf []byte
+			j := 1
+			for ; j < len(s) && s[j] != '"'; j++ {
+				if s[j] == '\\' && j+1 < len(s) {
+					j++
+				}
+				buf = append(buf, s[j])
+			}
+			if j == len(s) {
+				// Unterminated quoted-string.
+				return key, "", 0, "", false
+			}
+			value = string(buf)
+			s = s[j+1:]
+			i = 0
+		} else {
+			i = 0
+			for i < len(s) && s[i] != ';' && s[i] != ',' {
+				i++
+			}
+			value = TrimString(s[:i])
+			ok = value != ""
+		}
+	}
+	// Skip to the separator; anything but whitespace on the way is junk.
+	j := i
+	for j < len(s) && s[j] != ';' && s[j] != ',' {
+		j++
+	}
+	if TrimString(s[i:j]) != "" {
+		ok = false
+	}
+	if j == len(s) {
+		return key, value, 0, "", ok
+	}
+	return key, value, s[j], s[j+1:], ok
+}
+
+// percentDecode decodes the %XX escapes of an Alt-Svc protocol-id.
+func percentDecode(s string) (string, bool) {
+	if strings.IndexByte(s, '%') < 0 {
+		return s, true
+	}
+	buf := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' {
+			buf = append(buf, s[i])
+			continue
+		}
+		if i+2 >= len(s) {
+			return "", false
+		}
+		b, err := strconv.ParseUint(s[i+1:i+3], 16, 8)
+		if err != nil {
+			return "", false
+		}
+		buf = append(buf, byte(b))
+		i += 2
+	}
+	return string(buf), true
+}
+
+// splitAltAuthority splits an Alt-Svc alt-authority, "[host]:port",
+// into its host, which may be empty, and port.
+func splitAltAuthority(authority string) (host, port string, ok bool) {
+	host, port, err := net.SplitHostPort(authority)
+	if err != nil || port == "" {
+		return "", "", false
+	}
+	return host, port, true
+}
@@ -0,0 +1,39 @@
+/*
+ * Copyright (c) 2018 The Go Authors. All rights reserved.
+ * Use of this source code is governed by a BSD-style license that can be found in the LICENSE file.
+ */
+
+package http
+
+func (h *idempotencyHandler) ServeHTTP(w ResponseWriter, r *Request) {
+	key := r.DedupKey()
+	if key == "" {
+		h.handler.ServeHTTP(w, r)
+		return
+	}
+
+	if rec, ok := h.store.Get(key); ok {
+		dst := w.Header()
+		for k, vv := range rec.Header {
+			dst[k] = vv
+		}
+		w.WriteHeader(rec.StatusCode)
+		w.Write(rec.Body)
+		return
+	}
+
+	iw := &idempotencyWriter{respWriter: w}
+	h.handler.ServeHTTP(iw, r)
+	if !iw.wroteHeader {
+		iw.writeHeader(StatusOK)
+	}
+	// server errors are not recorded, so the client can retry
+	if iw.code >= 500 {
+		return
+	}
+	h.store.Put(key, &RecordedResponse{
+		StatusCode: iw.code,
+		Header:     iw.header,
+		Body:       iw.wbuf.Bytes(),
+	})
+}
@@ -0,0 +1,32 @@
+/*
+ * Copyright (c) 2018 The Go Authors. All rights reserved.
+ * Use of this source code is governed by a BSD-style license that can be found in the LICENSE file.
+ */
+
+package http
+
+import "github.com/badu/http/hdr"
+
+func (w *idempotencyWriter) Header() hdr.Header { return w.respWriter.Header() }
+
+func (w *idempotencyWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(StatusOK)
+	}
+	w.wbuf.Write(p)
+	return w.respWriter.Write(p)
+}
+
+func (w *idempotencyWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.writeHeader(code)
+	w.respWriter.WriteHeader(code)
+}
+
+func (w *idempotencyWriter) writeHeader(code int) {
+	w.wroteHeader = true
+	w.code = code
+	w.header = w.respWriter.Header().Clone()
+}
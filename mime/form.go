@@ -2,6 +2,10 @@ package mime
 
 import "os"
 
+// TotalBytes returns the size of all the values and files of a Form
+// read by ReadForm, whether they are kept in memory or on disk.
+func (f *Form) TotalBytes() int64 { return f.totalBytes }
+
 // RemoveAll removes any temporary files associated with a Form.
 func (f *Form) RemoveAll() error {
 	var err error
@@ -23,11 +23,23 @@ import (
 // It returns ErrMessageTooLarge if all non-file parts can't be stored in
 // memory.
 func (r *MultipartReader) ReadForm(maxMemory int64) (*Form, error) {
-	return r.readForm(maxMemory)
+	return r.readForm(maxMemory, -1)
 }
 
-func (r *MultipartReader) readForm(maxMemory int64) (_ *Form, err error) {
-	form := &Form{make(map[string][]string), make(map[string][]*FileHeader)}
+// ReadFormCapped is like ReadForm, but it also returns ErrFilesTooLarge,
+// removing the temporary files already written, once the file parts
+// add up to more than maxTotalFileBytes, no matter how small each of them is.
+func (r *MultipartReader) ReadFormCapped(maxMemory, maxTotalFileBytes int64) (*Form, error) {
+	if maxTotalFileBytes < 0 {
+		maxTotalFileBytes = 0
+	}
+	return r.readForm(maxMemory, maxTotalFileBytes)
+}
+
+// readForm implements ReadForm and ReadFormCapped. A negative maxFileBytes
+// means the file parts are not capped.
+func (r *MultipartReader) readForm(maxMemory, maxFileBytes int64) (_ *Form, err error) {
+	form := &Form{Value: make(map[string][]string), File: make(map[string][]*FileHeader)}
 	defer func() {
 		if err != nil {
 			form.RemoveAll()
@@ -65,6 +77,7 @@ func (r *MultipartReader) readForm(maxMemory int64) (_ *Form, err error) {
 				return nil, ErrMessageTooLarge
 			}
 			form.Value[name] = append(form.Value[name], b.String())
+			form.totalBytes += n
 			continue
 		}
 
@@ -73,7 +86,12 @@ func (r *MultipartReader) readForm(maxMemory int64) (_ *Form, err error) {
 			Filename: filename,
 			Header:   p.Header,
 		}
-		n, err := io.CopyN(&b, p, maxMemory+1)
+		var fp io.Reader = p
+		if maxFileBytes >= 0 {
+			// read a byte past the cap at most, to see it's exceeded
+			fp = io.LimitReader(p, maxFileBytes+1)
+		}
+		n, err := io.CopyN(&b, fp, maxMemory+1)
 		if err != nil && err != io.EOF {
 			return nil, err
 		}
@@ -83,7 +101,7 @@ func (r *MultipartReader) readForm(maxMemory int64) (_ *Form, err error) {
 			if err != nil {
 				return nil, err
 			}
-			size, err := io.Copy(file, io.MultiReader(&b, p))
+			size, err := io.Copy(file, io.MultiReader(&b, fp))
 			if cerr := file.Close(); err == nil {
 				err = cerr
 			}
@@ -100,11 +118,35 @@ func (r *MultipartReader) readForm(maxMemory int64) (_ *Form, err error) {
 			maxValueBytes -= n
 		}
 		form.File[name] = append(form.File[name], fh)
+		form.totalBytes += fh.Size
+		if maxFileBytes >= 0 {
+			maxFileBytes -= fh.Size
+			if maxFileBytes < 0 {
+				return nil, ErrFilesTooLarge
+			}
+		}
 	}
 
 	return form, nil
 }
 
+// NextPartLimited is like NextPart, but the Read method of the returned
+// part fails with ErrPartTooLarge, after returning the first maxBytes
+// bytes, if the part body is larger than that. Nothing is buffered,
+// so oversized parts can be rejected while streaming.
+func (r *MultipartReader) NextPartLimited(maxBytes int64) (*SinglePart, error) {
+	p, err := r.NextPart()
+	if err != nil {
+		return nil, err
+	}
+	if maxBytes < 0 {
+		maxBytes = 0
+	}
+	p.limited = true
+	p.limit = maxBytes
+	return p, nil
+}
+
 // NextPart returns the next part in the multipart or an error.
 // When there are no more parts, the error io.EOF is returned.
 func (r *MultipartReader) NextPart() (*SinglePart, error) {
@@ -101,10 +101,16 @@ func (w *MultipartWriter) CreatePart(header Header) (io.Writer, error) {
 // CreateFormFile is a convenience wrapper around CreatePart. It creates
 // a new form-data header with the provided field name and file name.
 func (w *MultipartWriter) CreateFormFile(fieldname, filename string) (io.Writer, error) {
+	return w.CreateFormFileWithContentType(fieldname, filename, "application/octet-stream")
+}
+
+// CreateFormFileWithContentType is like CreateFormFile, but the part
+// has the provided content type instead of application/octet-stream.
+func (w *MultipartWriter) CreateFormFileWithContentType(fieldname, filename, contentType string) (io.Writer, error) {
 	h := make(Header)
 	h.Set(ContentDisposition,
 		fmt.Sprintf(`form-data; name="%s"; filename="%s"`, escapeQuotes(fieldname), escapeQuotes(filename)))
-	h.Set(ContentType, "application/octet-stream")
+	h.Set(ContentType, contentType)
 	return w.CreatePart(h)
 }
 
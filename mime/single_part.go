@@ -55,10 +55,30 @@ func (bp *SinglePart) populateHeaders() error {
 // Read reads the body of a part, after its headers and before the
 // next part (if any) begins.
 func (p *SinglePart) Read(d []byte) (n int, err error) {
-	return p.r.Read(d)
+	if p.limited {
+		// read a byte past the limit at most, to see it's exceeded
+		if max := p.limit - p.bytesRead + 1; int64(len(d)) > max {
+			d = d[:max]
+		}
+	}
+	n, err = p.r.Read(d)
+	if p.limited && p.bytesRead+int64(n) > p.limit {
+		n = int(p.limit - p.bytesRead)
+		err = ErrPartTooLarge
+	}
+	p.bytesRead += int64(n)
+	return n, err
+}
+
+// BytesRead returns the number of body bytes read from the part so far.
+// Streaming handlers can use it to enforce per-part limits while reading.
+func (p *SinglePart) BytesRead() int64 {
+	return p.bytesRead
 }
 
 func (p *SinglePart) Close() error {
-	io.Copy(ioutil.Discard, p)
+	// not through Read, which fails past the limit of NextPartLimited
+	// or for an unknown Content-Transfer-Encoding
+	io.Copy(ioutil.Discard, partReader{p})
 	return nil
 }
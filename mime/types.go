@@ -28,6 +28,8 @@ type (
 	Form struct {
 		Value map[string][]string
 		File  map[string][]*FileHeader
+
+		totalBytes int64 // see TotalBytes
 	}
 
 	// A FileHeader describes a file part of a multipart request.
@@ -85,6 +87,9 @@ type (
 		r                 io.Reader // r is either a reader directly reading from reader, or it's a wrapper around such a reader, decoding the Content-Transfer-Encoding
 		n                 int       // known data bytes waiting in reader.bufReader
 		total             int64     // total data bytes read already
+		bytesRead         int64     // bytes returned to the caller by Read, after any decoding
+		limited           bool      // whether Read is capped to limit bytes, see NextPartLimited
+		limit             int64     // max body bytes Read returns, if limited
 		err               error     // error to return when n == 0
 		readErr           error     // read error observed from reader.bufReader
 	}
@@ -92,6 +97,12 @@ type (
 	// Reader's underlying parser consumes its input as needed. Seeking
 	// isn't supported.
 	MultipartReader struct {
+		// AutoDecodeTransferEncoding makes the parts decode the base64 and
+		// quoted-printable Content-Transfer-Encoding of their body, and
+		// fail to Read a body in an unknown encoding. Otherwise, only
+		// quoted-printable is decoded.
+		AutoDecodeTransferEncoding bool
+
 		bufReader        *bufio.Reader
 		currentPart      *SinglePart
 		partsRead        int
@@ -126,6 +137,14 @@ var (
 	// data is too large to be processed.
 	ErrMessageTooLarge = errors.New("multipart: message too large")
 
+	// ErrFilesTooLarge is returned by ReadFormCapped if the file parts of
+	// the message are too large altogether.
+	ErrFilesTooLarge = errors.New("multipart: files too large")
+
+	// ErrPartTooLarge is returned by the Read method of a part returned by
+	// NextPartLimited once the part is found to exceed its limit.
+	ErrPartTooLarge = errors.New("multipart: part too large")
+
 	crlf       = []byte("\r\n")
 	lf         = []byte("\n")
 	softSuffix = []byte("=")
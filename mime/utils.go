@@ -7,8 +7,10 @@ package mime
 
 import (
 	"bytes"
+	"encoding/base64"
 	"fmt"
 	"io"
+	"strings"
 
 	. "github.com/badu/http/hdr"
 )
@@ -26,13 +28,33 @@ func newPart(mr *MultipartReader) (*SinglePart, error) {
 		return nil, err
 	}
 	bp.r = partReader{bp}
-	if bp.Header.Get(ContentTransferEncoding) == "quoted-printable" {
+	if mr.AutoDecodeTransferEncoding {
+		bp.r = decodeTransferEncoding(bp)
+	} else if bp.Header.Get(ContentTransferEncoding) == "quoted-printable" {
 		bp.Header.Del(ContentTransferEncoding)
 		bp.r = NewQuotedReader(bp.r)
 	}
 	return bp, nil
 }
 
+// decodeTransferEncoding returns the reader of the body of bp, decoding
+// its Content-Transfer-Encoding. The reader of a body in an unknown
+// encoding fails.
+func decodeTransferEncoding(bp *SinglePart) io.Reader {
+	switch cte := strings.ToLower(strings.TrimSpace(bp.Header.Get(ContentTransferEncoding))); cte {
+	case "", "7bit", "8bit", "binary":
+		return bp.r
+	case "quoted-printable":
+		bp.Header.Del(ContentTransferEncoding)
+		return NewQuotedReader(bp.r)
+	case "base64":
+		bp.Header.Del(ContentTransferEncoding)
+		return base64.NewDecoder(base64.StdEncoding, bp.r)
+	default:
+		return &stickyErrorReader{err: fmt.Errorf("multipart: unknown Content-Transfer-Encoding %q", cte)}
+	}
+}
+
 // scanUntilBoundary scans buf to identify how much of it can be safely
 // returned as part of the Part body.
 // dashBoundary is "--boundary".
@@ -6,30 +6,47 @@
 package mux
 
 import (
+	"context"
+	"reflect"
+	"sort"
+
 	. "github.com/badu/http"
 	"github.com/badu/http/hdr"
 	"github.com/badu/http/url"
 )
 
 // Find a handler on a handler map given a path string.
-// Most-specific (longest) pattern wins.
-func (mux *ServeMux) match(path string) (h Handler, pattern string) {
+// Most-specific pattern wins, see moreSpecific. For patterns with {name}
+// segments, the matched values are returned in params.
+func (mux *ServeMux) match(path string) (h Handler, pattern string, params map[string]string) {
 	// Check for exact match first.
 	v, ok := mux.m[path]
-	if ok {
-		return v.h, v.pattern
+	if ok && v.segments == nil {
+		return v.h, v.pattern, nil
 	}
 
-	// Check for longest valid match.
-	var n = 0
+	// Check for most specific valid match.
+	var best muxEntry
+	var pathSegs []string
 	for k, v := range mux.m {
-		if !pathMatch(k, path) {
-			continue
+		var p map[string]string
+		if v.segments == nil {
+			if !pathMatch(k, path) {
+				continue
+			}
+		} else {
+			if pathSegs == nil {
+				pathSegs = splitSegments(path)
+			}
+			if p, ok = matchSegments(v.segments, pathSegs); !ok {
+				continue
+			}
 		}
-		if h == nil || len(k) > n {
-			n = len(k)
+		if h == nil || moreSpecific(v, best) {
+			best = v
 			h = v.h
 			pattern = v.pattern
+			params = p
 		}
 	}
 	return
@@ -51,7 +68,13 @@ func (mux *ServeMux) match(path string) (h Handler, pattern string) {
 // If there is no registered handler that applies to the request,
 // Handler returns a ``page not found'' handler and an empty pattern.
 func (mux *ServeMux) Handler(r *Request) (h Handler, pattern string) {
+	h, pattern, _ = mux.find(r)
+	return
+}
 
+// find is the main implementation of Handler, also returning the values
+// of the {name} segments of the matched pattern.
+func (mux *ServeMux) find(r *Request) (h Handler, pattern string, params map[string]string) {
 	// CONNECT requests are not canonicalized.
 	if r.Method == CONNECT {
 		return mux.handler(r.Host, r.URL.Path)
@@ -62,10 +85,10 @@ func (mux *ServeMux) Handler(r *Request) (h Handler, pattern string) {
 	host := stripHostPort(r.Host)
 	path := cleanPath(r.URL.Path)
 	if path != r.URL.Path {
-		_, pattern = mux.handler(host, path)
+		_, pattern, _ = mux.handler(host, path)
 		reqUrl := *r.URL
 		reqUrl.Path = path
-		return RedirectHandler(reqUrl.String(), StatusMovedPermanently), pattern
+		return RedirectHandler(reqUrl.String(), StatusMovedPermanently), pattern, nil
 	}
 
 	return mux.handler(host, r.URL.Path)
@@ -73,16 +96,16 @@ func (mux *ServeMux) Handler(r *Request) (h Handler, pattern string) {
 
 // handler is the main implementation of Handler.
 // The path is known to be in canonical form, except for CONNECT methods.
-func (mux *ServeMux) handler(host, path string) (h Handler, pattern string) {
+func (mux *ServeMux) handler(host, path string) (h Handler, pattern string, params map[string]string) {
 	mux.mu.RLock()
 	defer mux.mu.RUnlock()
 
 	// Host-specific pattern takes precedence over generic ones
 	if mux.hosts {
-		h, pattern = mux.match(host + path)
+		h, pattern, params = mux.match(host + path)
 	}
 	if h == nil {
-		h, pattern = mux.match(path)
+		h, pattern, params = mux.match(path)
 	}
 	if h == nil {
 		h, pattern = NotFoundHandler(), ""
@@ -100,10 +123,44 @@ func (mux *ServeMux) ServeHTTP(w ResponseWriter, r *Request) {
 		w.WriteHeader(StatusBadRequest)
 		return
 	}
-	h, _ := mux.Handler(r)
+	h, pattern, params := mux.find(r)
+	if pattern != "" {
+		ctx := context.WithValue(r.Context(), matchedPatternKey{}, pattern)
+		if params != nil {
+			ctx = context.WithValue(ctx, paramsKey{}, params)
+		}
+		r = r.WithContext(ctx)
+		mux.mu.RLock()
+		mws := mux.mw[pattern]
+		mux.mu.RUnlock()
+		for i := len(mws) - 1; i >= 0; i-- {
+			h = mws[i](h)
+		}
+	}
 	h.ServeHTTP(w, r)
 }
 
+// UseForPattern registers middleware that wraps the handler only for
+// requests matched by pattern, so that things like CORS or rate
+// limiting can be scoped to a single route. Middleware registered
+// first runs outermost. It may be called before or after the pattern
+// itself is registered with Handle.
+func (mux *ServeMux) UseForPattern(pattern string, mw func(Handler) Handler) {
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+
+	if pattern == "" {
+		panic("http: invalid pattern " + pattern)
+	}
+	if mw == nil {
+		panic("http: nil middleware")
+	}
+	if mux.mw == nil {
+		mux.mw = make(map[string][]func(Handler) Handler)
+	}
+	mux.mw[pattern] = append(mux.mw[pattern], mw)
+}
+
 // Handle registers the handler for the given pattern.
 // If a handler already exists for pattern, Handle panics.
 func (mux *ServeMux) Handle(pattern string, handler Handler) {
@@ -123,7 +180,8 @@ func (mux *ServeMux) Handle(pattern string, handler Handler) {
 	if mux.m == nil {
 		mux.m = make(map[string]muxEntry)
 	}
-	mux.m[pattern] = muxEntry{explicit: true, h: handler, pattern: pattern}
+	e := newMuxEntry(pattern, pattern, handler, true)
+	mux.m[pattern] = e
 
 	if pattern[0] != '/' {
 		mux.hosts = true
@@ -142,9 +200,40 @@ func (mux *ServeMux) Handle(pattern string, handler Handler) {
 			// strings.Index can't be -1.
 			path = pattern[byteIndex(pattern, '/'):] // @comment : was strings.Index
 		}
-		pathUrl := &url.URL{Path: path}
-		mux.m[pattern[0:n-1]] = muxEntry{h: RedirectHandler(pathUrl.String(), StatusMovedPermanently), pattern: pattern}
+		var h Handler
+		if e.segments != nil {
+			// The subtree root depends on the values of the wildcards.
+			h = HandlerFunc(func(w ResponseWriter, r *Request) {
+				pathUrl := &url.URL{Path: r.URL.Path + "/"}
+				Redirect(w, r, pathUrl.String(), StatusMovedPermanently)
+			})
+		} else {
+			pathUrl := &url.URL{Path: path}
+			h = RedirectHandler(pathUrl.String(), StatusMovedPermanently)
+		}
+		mux.m[pattern[0:n-1]] = newMuxEntry(pattern[0:n-1], pattern, h, false)
+	}
+}
+
+// Routes returns the patterns registered with Handle, sorted by pattern.
+// The redirects ServeMux adds for subtree roots are not included.
+func (mux *ServeMux) Routes() []RouteInfo {
+	mux.mu.RLock()
+	defer mux.mu.RUnlock()
+
+	routes := make([]RouteInfo, 0, len(mux.m))
+	for k, v := range mux.m {
+		if !v.explicit {
+			continue
+		}
+		routes = append(routes, RouteInfo{
+			Pattern: k,
+			Subtree: k[len(k)-1] == '/',
+			Handler: reflect.TypeOf(v.h).String(),
+		})
 	}
+	sort.Slice(routes, func(i, j int) bool { return routes[i].Pattern < routes[j].Pattern })
+	return routes
 }
 
 // HandleFunc registers the handler function for the given pattern.
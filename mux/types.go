@@ -43,6 +43,12 @@ type (
 	// "/codesearch" and "codesearch.google.com/" without also taking over
 	// requests for "http://www.google.com/".
 	//
+	// A path segment of a pattern written as {name} is a wildcard, matching
+	// any single non-empty segment of the request path, as in
+	// "/users/{id}/posts/{slug}". The matched values are retrieved with Param.
+	// Static segments take precedence over wildcards, so that a handler
+	// registered for "/users/new" is not shadowed by one for "/users/{id}".
+	//
 	// ServeMux also takes care of sanitizing the URL request path,
 	// redirecting any request containing . or .. elements or repeated slashes
 	// to an equivalent, cleaner URL.
@@ -50,13 +56,36 @@ type (
 		mu    sync.RWMutex
 		m     map[string]muxEntry
 		hosts bool // whether any patterns contain hostnames
+
+		// mw holds the route-scoped middleware, by pattern. See UseForPattern.
+		mw map[string][]func(Handler) Handler
 	}
 
 	muxEntry struct {
 		explicit bool
 		h        Handler
 		pattern  string
+		key      string   // the key of the entry in ServeMux.m, pattern or its subtree root
+		segments []string // key split at '/', if it has {name} segments
+		nsegs    int      // number of segments of key
+		wilds    []bool   // for each segment of key, whether it is a {name}; nil if there are none
+		subtree  bool     // whether key ends in a slash
+	}
+
+	// RouteInfo describes a pattern registered with a ServeMux. See Routes.
+	RouteInfo struct {
+		Pattern string
+		Subtree bool   // whether the pattern matches a rooted subtree, i.e. ends in a slash
+		Handler string // the type name of the handler, like "http.HandlerFunc"
 	}
+
+	// matchedPatternKey is the context key under which ServeMux stores
+	// the pattern that matched the request. See MatchedPattern.
+	matchedPatternKey struct{}
+
+	// paramsKey is the context key under which ServeMux stores the values
+	// of the {name} segments of the matched pattern. See Param.
+	paramsKey struct{}
 )
 
 // DefaultServeMux is the default ServeMux used by Serve.
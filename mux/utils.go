@@ -27,6 +27,23 @@ func HandleFunc(pattern string, handler func(ResponseWriter, *Request)) {
 	DefaultServeMux.HandleFunc(pattern, handler)
 }
 
+// MatchedPattern returns the registered pattern that the ServeMux
+// dispatching r matched, so that handlers and middleware can refer
+// to the route template instead of the raw request path.
+// The boolean is false if r was not dispatched by a ServeMux.
+func MatchedPattern(r *Request) (string, bool) {
+	pattern, ok := r.Context().Value(matchedPatternKey{}).(string)
+	return pattern, ok
+}
+
+// Param returns the value of the {name} segment of the pattern that the
+// ServeMux dispatching r matched, or the empty string if there is no
+// such segment.
+func Param(r *Request, name string) string {
+	params, _ := r.Context().Value(paramsKey{}).(map[string]string)
+	return params[name]
+}
+
 // Does path match pattern?
 func pathMatch(pattern, path string) bool {
 	if len(pattern) == 0 {
@@ -40,6 +57,127 @@ func pathMatch(pattern, path string) bool {
 	return len(path) >= n && path[0:n] == pattern
 }
 
+// parsePattern returns the segments of pattern if it has {name} segments,
+// or nil if it is a static pattern. It panics on empty or repeated names.
+func parsePattern(pattern string) []string {
+	segments := splitSegments(pattern)
+	wild := false
+	for i, seg := range segments {
+		name, ok := paramName(seg)
+		if !ok {
+			continue
+		}
+		if name == "" {
+			panic("http: empty wildcard name in pattern " + pattern)
+		}
+		for _, prev := range segments[:i] {
+			if prevName, ok := paramName(prev); ok && prevName == name {
+				panic("http: duplicate wildcard " + name + " in pattern " + pattern)
+			}
+		}
+		wild = true
+	}
+	if !wild {
+		return nil
+	}
+	return segments
+}
+
+// paramName returns the name of seg if it is a {name} segment.
+func paramName(seg string) (string, bool) {
+	n := len(seg)
+	if n < 2 || seg[0] != '{' || seg[n-1] != '}' {
+		return "", false
+	}
+	return seg[1 : n-1], true
+}
+
+// splitSegments splits p at each '/'.
+func splitSegments(p string) []string {
+	var segments []string
+	for {
+		i := byteIndex(p, '/')
+		if i < 0 {
+			return append(segments, p)
+		}
+		segments = append(segments, p[:i])
+		p = p[i+1:]
+	}
+}
+
+// matchSegments reports whether the path split in pathSegs matches the
+// pattern split in segments, and returns the values of its wildcards.
+// A pattern ending in a slash matches the subtree below it.
+func matchSegments(segments, pathSegs []string) (map[string]string, bool) {
+	n := len(segments)
+	if segments[n-1] == "" {
+		if len(pathSegs) < n {
+			return nil, false
+		}
+		n--
+	} else if len(pathSegs) != n {
+		return nil, false
+	}
+	params := make(map[string]string)
+	for i, seg := range segments[:n] {
+		if name, ok := paramName(seg); ok {
+			if pathSegs[i] == "" {
+				return nil, false
+			}
+			params[name] = pathSegs[i]
+			continue
+		}
+		if seg != pathSegs[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// newMuxEntry returns the entry of pattern stored under key, with what
+// moreSpecific compares computed once, at registration.
+func newMuxEntry(key, pattern string, h Handler, explicit bool) muxEntry {
+	e := muxEntry{explicit: explicit, h: h, pattern: pattern, key: key}
+	e.segments = parsePattern(key)
+	e.nsegs = 1
+	for i := 0; i < len(key); i++ {
+		if key[i] == '/' {
+			e.nsegs++
+		}
+	}
+	if e.segments != nil {
+		e.wilds = make([]bool, len(e.segments))
+		for i, seg := range e.segments {
+			_, e.wilds[i] = paramName(seg)
+		}
+	}
+	e.subtree = key != "" && key[len(key)-1] == '/'
+	return e
+}
+
+// moreSpecific reports whether entry a is more specific than entry b,
+// both matching the same path. The pattern with more segments wins, then
+// a fixed path over a subtree, then the pattern with a static segment
+// where the other has a wildcard. Other ties are broken by pattern order.
+func moreSpecific(a, b muxEntry) bool {
+	if a.nsegs != b.nsegs {
+		return a.nsegs > b.nsegs
+	}
+	if a.subtree != b.subtree {
+		return b.subtree
+	}
+	if a.wilds != nil || b.wilds != nil {
+		for i := 0; i < a.nsegs; i++ {
+			wildA := a.wilds != nil && a.wilds[i]
+			wildB := b.wilds != nil && b.wilds[i]
+			if wildA != wildB {
+				return wildB
+			}
+		}
+	}
+	return a.key < b.key
+}
+
 // stripHostPort returns h without any trailing ":<port>".
 func stripHostPort(h string) string {
 	// If no port on host, return unchanged
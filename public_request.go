@@ -8,6 +8,7 @@ package http
 import (
 	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -178,9 +179,111 @@ func NewRequest(method, toURL string, body io.Reader) (*Request, error) {
 	return req, nil
 }
 
+// NewRequestFromCurl returns a new Request built from a curl command line,
+// such as one copied from a bug report or a browser's developer tools.
+// Only a subset of curl's syntax is understood: the URL, given as an
+// argument or with --url, and the flags -X/--request, -H/--header and
+// -d/--data/--data-raw/--data-binary. Several data flags are joined
+// with '&', and imply a POST with a form Content-Type unless the method
+// and Content-Type are given. Arguments can be quoted as in a POSIX shell.
+func NewRequestFromCurl(cmd string) (*Request, error) {
+	args, err := splitCurlArgs(cmd)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 0 || args[0] != "curl" {
+		return nil, errors.New("http: curl command must start with curl")
+	}
+
+	var (
+		method, toURL string
+		headers       []string
+		data          []string
+		hasData       bool
+	)
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+		if arg == "" || arg[0] != '-' {
+			if toURL != "" {
+				return nil, &badStringError{"curl command with more than one URL", arg}
+			}
+			toURL = arg
+			continue
+		}
+		name, value, attached := arg, "", false
+		// short flags can be glued to their value, as in -XPOST
+		if len(arg) > 2 && arg[1] != '-' {
+			name, value, attached = arg[:2], arg[2:], true
+		}
+		switch name {
+		case "-X", "--request", "-H", "--header", "-d", "--data", "--data-raw", "--data-binary", "--url":
+		default:
+			return nil, &badStringError{"unsupported curl option", arg}
+		}
+		if !attached {
+			if i+1 == len(args) {
+				return nil, &badStringError{"missing value for curl option", arg}
+			}
+			i++
+			value = args[i]
+		}
+		switch name {
+		case "-X", "--request":
+			method = value
+		case "-H", "--header":
+			headers = append(headers, value)
+		case "--url":
+			if toURL != "" {
+				return nil, &badStringError{"curl command with more than one URL", value}
+			}
+			toURL = value
+		default:
+			data = append(data, value)
+			hasData = true
+		}
+	}
+	if toURL == "" {
+		return nil, errors.New("http: curl command without URL")
+	}
+	if method == "" && hasData {
+		method = POST
+	}
+
+	var body io.Reader
+	if hasData {
+		body = strings.NewReader(strings.Join(data, "&"))
+	}
+	req, err := NewRequest(method, toURL, body)
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range headers {
+		i := strings.IndexByte(h, ':')
+		if i <= 0 {
+			return nil, &badStringError{"malformed curl header", h}
+		}
+		req.Header.Add(hdr.TrimString(h[:i]), hdr.TrimString(h[i+1:]))
+	}
+	if hasData && req.Header.Get(hdr.ContentType) == "" {
+		req.Header.Set(hdr.ContentType, "application/x-www-form-urlencoded")
+	}
+	return req, nil
+}
+
 // ReadRequest reads and parses an incoming request from b.
 func ReadRequest(b *bufio.Reader) (*Request, error) {
-	return readRequest(b, true)
+	return readRequest(b, true, false, true, 0)
+}
+
+// ReadRequestLimited is like ReadRequest but fails with hdr.ErrHeaderTooLarge
+// once the request line and header exceed maxHeaderBytes, as a Server does
+// with its MaxHeaderBytes. If maxHeaderBytes is zero or negative,
+// DefaultMaxHeaderBytes is used.
+func ReadRequestLimited(b *bufio.Reader, maxHeaderBytes int) (*Request, error) {
+	if maxHeaderBytes <= 0 {
+		maxHeaderBytes = DefaultMaxHeaderBytes
+	}
+	return readRequest(b, true, false, true, int64(maxHeaderBytes))
 }
 
 // MaxBytesReader is similar to io.LimitReader but is intended for
@@ -14,6 +14,14 @@ import (
 	"github.com/badu/http/hdr"
 )
 
+// LimitTrailer makes reads of the chunked body rc, as returned in the
+// Body of ReadResponse or ReadRequest, fail with ErrTrailerTooLarge
+// when the trailer following the body is larger than n bytes.
+// It does nothing for other bodies.
+func LimitTrailer(rc io.ReadCloser, n int64) {
+	limitTrailer(rc, n)
+}
+
 // ReadResponse reads and returns an HTTP response from r.
 // The req parameter optionally specifies the Request that corresponds
 // to this Response. If nil, a GET request is assumed.
@@ -6,6 +6,8 @@
 package http
 
 import (
+	"bufio"
+	"encoding/base64"
 	"fmt"
 	"io"
 	"net"
@@ -40,6 +42,14 @@ func Error(w ResponseWriter, error string, code int) {
 // NotFound replies to the request with an HTTP 404 not found error.
 func NotFound(w ResponseWriter, r *Request) { Error(w, "404 page not found", StatusNotFound) }
 
+// RequireBasicAuth replies to the request with an HTTP 401 unauthorized
+// error, challenging the client to authenticate to realm with HTTP Basic
+// Authentication. The credentials are then read with Request.BasicAuth.
+func RequireBasicAuth(w ResponseWriter, realm string) {
+	w.Header().Set(hdr.WWWAuthenticate, `Basic realm="`+quoteEscaper.Replace(realm)+`"`)
+	Error(w, "401 unauthorized", StatusUnauthorized)
+}
+
 // NotFoundHandler returns a simple request handler
 // that replies to each request with a ``404 page not found'' reply.
 func NotFoundHandler() Handler { return HandlerFunc(NotFound) }
@@ -254,6 +264,151 @@ func TimeoutHandler(h Handler, dt time.Duration, msg string) Handler {
 	}
 }
 
+// ContextTimeoutHandler is like TimeoutHandler, but h also runs with a
+// request context that has the time limit as deadline. When the limit is
+// reached, the context is canceled as the 503 Service Unavailable response
+// is written, so h and the calls it makes with the context can give up
+// instead of running on in the background.
+func ContextTimeoutHandler(h Handler, dt time.Duration, msg string) Handler {
+	return &timeoutHandler{
+		handler:     h,
+		body:        msg,
+		dt:          dt,
+		withContext: true,
+	}
+}
+
+// EncodeHandler returns a Handler that runs h, encoding the response
+// body with one of the encoders registered with the serving Server's
+// RegisterEncoder, as negotiated with the request's Accept-Encoding
+// header. The encoding with the highest quality value wins, ties going
+// to the first one listed by the client. Responses h gives a
+// Content-Encoding of its own, HEAD requests and responses without a
+// body are passed through untouched.
+//
+// The Server is found through the request context, so EncodeHandler
+// only encodes requests served by a Server that has encoders registered.
+func EncodeHandler(h Handler) Handler {
+	return &encodeHandler{handler: h}
+}
+
+// WrapGzip returns a ResponseWriter compressing the response body written
+// through it with gzip, if r's Accept-Encoding header allows gzip. Otherwise,
+// or for HEAD requests, w is returned as is.
+//
+// The body is left uncompressed if the handler sets a Content-Encoding of
+// its own or if the Content-Type, set or sniffed, is already compressed,
+// like images, audio, video and archives. The returned writer is a
+// *GzipResponseWriter, that the handler must Close once done writing.
+// Its Flush sends what was written so far, so the client can decode it
+// right away.
+func WrapGzip(w ResponseWriter, r *Request) ResponseWriter {
+	if r.Method == HEAD {
+		return w
+	}
+	encoding := negotiateEncoding(r.Header.Get(hdr.AcceptEncoding), func(encoding string) bool {
+		return encoding == "gzip"
+	})
+	if encoding == "" {
+		return w
+	}
+	return &GzipResponseWriter{encodeWriter{
+		respWriter:     w,
+		encoding:       encoding,
+		newWriter:      newGzipWriter,
+		skipCompressed: true,
+	}}
+}
+
+// Upgrade completes the server side of a WebSocket opening handshake, as
+// described by RFC 6455 section 4.2, and hijacks the connection.
+//
+// The request must be a GET with the Connection: Upgrade and Upgrade:
+// websocket headers, and a valid Sec-WebSocket-Key header. Otherwise
+// Upgrade replies 400 Bad Request and returns ErrBadHandshake. A
+// Sec-WebSocket-Version other than 13 gets a 426 Upgrade Required reply.
+// Headers set on w, like Sec-WebSocket-Protocol, are sent along with the
+// 101 Switching Protocols response.
+//
+// Upgrade doesn't deal with WebSocket frames: the caller reads and writes
+// them through the returned connection and buffers, which it must close.
+func Upgrade(w ResponseWriter, r *Request) (net.Conn, *bufio.ReadWriter, error) {
+	if r.Method != GET || !r.ProtoAtLeast(1, 1) {
+		Error(w, "websocket: the handshake must be a GET request", StatusBadRequest)
+		return nil, nil, ErrBadHandshake
+	}
+	if !hasToken(r.Header.Get(hdr.Connection), "upgrade") || !hasToken(r.Header.Get(hdr.UpgradeHeader), "websocket") {
+		Error(w, "websocket: missing Connection: Upgrade or Upgrade: websocket header", StatusBadRequest)
+		return nil, nil, ErrBadHandshake
+	}
+	if r.Header.Get(hdr.SecWebSocketVersion) != "13" {
+		w.Header().Set(hdr.SecWebSocketVersion, "13")
+		Error(w, "websocket: unsupported version", StatusUpgradeRequired)
+		return nil, nil, ErrBadHandshake
+	}
+	key := r.Header.Get(hdr.SecWebSocketKey)
+	if nonce, err := base64.StdEncoding.DecodeString(key); err != nil || len(nonce) != 16 {
+		Error(w, "websocket: missing or invalid Sec-WebSocket-Key header", StatusBadRequest)
+		return nil, nil, ErrBadHandshake
+	}
+	hj, ok := w.(Hijacker)
+	if !ok {
+		Error(w, "websocket: the connection can't be hijacked", StatusInternalServerError)
+		return nil, nil, ErrNotHijacker
+	}
+	h := w.Header().Clone()
+	conn, brw, err := hj.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	h.Set(hdr.UpgradeHeader, "websocket")
+	h.Set(hdr.Connection, "Upgrade")
+	h.Set(hdr.SecWebSocketAccept, websocketAccept(key))
+	brw.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	h.Write(brw)
+	brw.WriteString("\r\n")
+	if err := brw.Flush(); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	return conn, brw, nil
+}
+
+// NewEventStreamWriter returns an EventStreamWriter sending events through
+// w. It sets the Content-Type header to text/event-stream and the
+// Cache-Control header to no-cache, which take effect with the first event
+// sent. It returns ErrNotFlusher if w doesn't implement Flusher.
+func NewEventStreamWriter(w ResponseWriter) (*EventStreamWriter, error) {
+	flusher, ok := w.(Flusher)
+	if !ok {
+		return nil, ErrNotFlusher
+	}
+	h := w.Header()
+	h.Set(hdr.ContentType, "text/event-stream")
+	h.Set(hdr.CacheControl, "no-cache")
+	return &EventStreamWriter{respWriter: w, flusher: flusher}, nil
+}
+
+// NewIdempotencyMiddleware returns a middleware that deduplicates
+// repeated submissions carrying the same Idempotency-Key header.
+//
+// The first response to a given Request.DedupKey is recorded in store
+// and replayed, without calling the wrapped Handler, for every later
+// request with the same key. Requests without an Idempotency-Key header
+// are passed through untouched, and 5xx responses are not recorded so
+// that failed submissions can be retried.
+//
+// Concurrent duplicates that arrive before the first response has been
+// recorded are all passed to the wrapped Handler.
+func NewIdempotencyMiddleware(store IdempotencyStore) func(Handler) Handler {
+	return func(h Handler) Handler {
+		return &idempotencyHandler{
+			handler: h,
+			store:   store,
+		}
+	}
+}
+
 // NewChunkedWriter returns a new chunkedWriter that translates writes into HTTP
 // "chunked" format before writing them to w. Closing the returned chunkedWriter
 // sends the final 0-length chunk that marks the end of the stream.
@@ -266,3 +421,23 @@ func TimeoutHandler(h Handler, dt time.Duration, msg string) Handler {
 func NewChunkedWriter(w io.Writer) io.WriteCloser {
 	return &chunkedWriter{w}
 }
+
+// ReadChunkedWithTrailer returns a reader that decodes the HTTP "chunked" body
+// read from r, together with a function returning the trailer that follows
+// the final 0-length chunk.
+//
+// The trailer is only available after body has been read up to io.EOF;
+// before that (or if the body carried no trailer) the function returns nil.
+// This is mostly useful to proxies which need to forward trailers.
+func ReadChunkedWithTrailer(r *bufio.Reader) (io.Reader, func() hdr.Header) {
+	var trailer hdr.Header
+	b := &body{reader: &chunkedReader{r: r}, responseOrRequestIntf: &trailer, bufReader: r}
+	return b, func() hdr.Header {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if !b.hasSawEOF {
+			return nil
+		}
+		return trailer
+	}
+}
@@ -7,10 +7,13 @@ package http
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
+	"time"
 
 	"github.com/badu/http/hdr"
 	"github.com/badu/http/mime"
@@ -59,6 +62,77 @@ func (r *Request) WithContext(ctx context.Context) *Request {
 	return r2
 }
 
+// WithDeadline returns a shallow copy of r whose context is a copy of r's
+// context with the deadline adjusted to be no later than d, along with the
+// cancel func releasing it. Once the deadline passes, sending the request
+// fails with the context error, like with a canceled context.
+func (r *Request) WithDeadline(d time.Time) (*Request, context.CancelFunc) {
+	ctx, cancel := context.WithDeadline(r.Context(), d)
+	return r.WithContext(ctx), cancel
+}
+
+// WithTimeout returns WithDeadline(time.Now().Add(timeout)).
+func (r *Request) WithTimeout(timeout time.Duration) (*Request, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	return r.WithContext(ctx), cancel
+}
+
+// Clone returns a deep copy of r with its context changed to ctx. The
+// Header, Trailer, URL, TransferEncoding, RawHeaders and the parsed
+// forms of the copy can be mutated without affecting r.
+// The Body is shared: reading it from either request consumes it for
+// both. The provided ctx must be non-nil.
+func (r *Request) Clone(ctx context.Context) *Request {
+	if ctx == nil {
+		panic("nil context")
+	}
+	r2 := new(Request)
+	*r2 = *r
+	r2.ctx = ctx
+
+	if r.URL != nil {
+		r2URL := new(url.URL)
+		*r2URL = *r.URL
+		r2.URL = r2URL
+	}
+	if r.Header != nil {
+		r2.Header = r.Header.Clone()
+	}
+	if r.Trailer != nil {
+		r2.Trailer = r.Trailer.Clone()
+	}
+	if r.TransferEncoding != nil {
+		r2.TransferEncoding = append([]string(nil), r.TransferEncoding...)
+	}
+	if r.RawHeaders != nil {
+		r2.RawHeaders = append([]hdr.KV(nil), r.RawHeaders...)
+	}
+	r2.Form = cloneURLValues(r.Form)
+	r2.PostForm = cloneURLValues(r.PostForm)
+	return r2
+}
+
+// WithBodyHash returns a shallow copy of r which updates h with the body
+// bytes as they are written by Write or the Transport, so the body doesn't
+// have to be read upfront to compute its digest. Once the request has been
+// sent, the digest is available via BodyHashSum. The hash is reset before
+// every write, so a retried request hashes the body only once.
+func (r *Request) WithBodyHash(h hash.Hash) *Request {
+	r2 := new(Request)
+	*r2 = *r
+	r2.bodyHash = h
+	return r2
+}
+
+// BodyHashSum returns the digest of the body bytes written so far to the
+// hash set by WithBodyHash, or nil if the request has no body hash.
+func (r *Request) BodyHashSum() []byte {
+	if r.bodyHash == nil {
+		return nil
+	}
+	return r.bodyHash.Sum(nil)
+}
+
 // ProtoAtLeast reports whether the HTTP protocol used
 // in the request is at least major.minor.
 func (r *Request) ProtoAtLeast(major, minor int) bool {
@@ -83,6 +157,25 @@ func (r *Request) Referer() string {
 	return r.Header.Get(hdr.Referer)
 }
 
+// ForceConnectionClose marks the request so that the Transport sends
+// "Connection: close" and does not return the connection to its idle
+// pool once the response has been read. It is the same as setting Close.
+func (r *Request) ForceConnectionClose() {
+	r.Close = true
+}
+
+// DedupKey returns a key identifying repeated submissions of the
+// same request, made of the method, the URL and the Idempotency-Key
+// header. It returns the empty string if the request carries no
+// Idempotency-Key header.
+func (r *Request) DedupKey() string {
+	key := r.Header.Get(hdr.IdempotencyKey)
+	if key == "" {
+		return ""
+	}
+	return ValueOrDefault(r.Method, GET) + " " + r.URL.String() + " " + key
+}
+
 // MultipartReader returns a MIME mime reader if this is a
 // mime/form-data POST request, else returns nil and an error.
 // Use this function instead of ParseMultipartForm to
@@ -128,7 +221,7 @@ func (r *Request) multipartReader() (*mime.MultipartReader, error) {
 // hasn't been set to "identity", Write adds "Transfer-Encoding:
 // chunked" to the header. Body is closed after it is sent.
 func (r *Request) Write(w io.Writer) error {
-	return r.write(w, false, nil, nil)
+	return r.write(w, false, nil, nil, nil)
 }
 
 // WriteProxy is like Write but writes the request in the form
@@ -138,21 +231,40 @@ func (r *Request) Write(w io.Writer) error {
 // In either case, WriteProxy also writes a Host header, using
 // either r.Host or r.URL.Host.
 func (r *Request) WriteProxy(w io.Writer) error {
-	return r.write(w, true, nil, nil)
+	return r.write(w, true, nil, nil, nil)
 }
 
 // @comment : used only in persist_conn.go of the transport
-func (r *Request) IWrite(w io.Writer, usingProxy bool, extraHeaders hdr.Header, waitForContinue func() bool) error {
-	return r.write(w, usingProxy, extraHeaders, waitForContinue)
+// If the request has a WroteRequest trace hook, wrote receives the
+// information to call it with, for the transport to report it once the
+// request is flushed to the connection.
+func (r *Request) IWrite(w io.Writer, usingProxy bool, extraHeaders hdr.Header, waitForContinue func() bool, wrote *trc.WroteRequestInfo) error {
+	return r.write(w, usingProxy, extraHeaders, waitForContinue, wrote)
 }
 
 // extraHeaders may be nil
 // waitForContinue may be nil
-func (r *Request) write(w io.Writer, usingProxy bool, extraHeaders hdr.Header, waitForContinue func() bool) error {
+// wrote may be nil, in which case the WroteRequest hook is called here
+func (r *Request) write(w io.Writer, usingProxy bool, extraHeaders hdr.Header, waitForContinue func() bool, wrote *trc.WroteRequestInfo) (err error) {
+	var (
+		transfWriter *transferWriter
+		counter      *countingWriter // counts the header bytes, if the tracer wants them
+	)
 	tracer := trc.ContextClientTrace(r.Context())
 	if tracer != nil && tracer.WroteRequest != nil {
 		defer func() {
-			tracer.WroteRequest(trc.WroteRequestInfo{})
+			info := trc.WroteRequestInfo{Err: err}
+			if counter != nil {
+				info.HeaderBytes = counter.n
+			}
+			if transfWriter != nil {
+				info.BodyBytes = transfWriter.bodyBytes
+			}
+			if wrote != nil {
+				*wrote = info
+				return
+			}
+			tracer.WroteRequest(info)
 		}()
 	}
 
@@ -187,19 +299,34 @@ func (r *Request) write(w io.Writer, usingProxy bool, extraHeaders hdr.Header, w
 	// and other small bufio Writers to have a minimum 4k buffer
 	// size.
 	var bw *bufio.Writer
-	if _, ok := w.(io.ByteWriter); !ok {
+	fw, flushWrites := w.(*FlushAfterWriteWriter)
+	if flushWrites {
+		w = fw.Writer
+	} else if _, ok := w.(io.ByteWriter); !ok {
 		bw = bufio.NewWriter(w)
 		w = bw
 	}
 
-	var err error
-	_, err = fmt.Fprintf(w, "%s %s HTTP/1.1\r\n", ValueOrDefault(r.Method, GET), ruri)
+	// @comment : cw is w, counting the written bytes when the tracer wants them
+	cw := w
+	if tracer != nil && tracer.WroteRequest != nil {
+		counter = &countingWriter{Writer: w}
+		cw = counter
+	}
+	_, err = fmt.Fprintf(cw, "%s %s HTTP/1.1\r\n", ValueOrDefault(r.Method, GET), ruri)
 	if err != nil {
 		return err
 	}
 
 	// Header lines
-	_, err = fmt.Fprintf(w, "Host: %s\r\n", host)
+	// @comment : hw is cw, teed into hbuf when the tracer wants the header fields
+	hw := cw
+	var hbuf *bytes.Buffer
+	if tracer != nil && tracer.WroteHeaderFields != nil {
+		hbuf = new(bytes.Buffer)
+		hw = io.MultiWriter(cw, hbuf)
+	}
+	_, err = fmt.Fprintf(hw, "Host: %s\r\n", host)
 	if err != nil {
 		return err
 	}
@@ -211,41 +338,44 @@ func (r *Request) write(w io.Writer, usingProxy bool, extraHeaders hdr.Header, w
 		userAgent = r.Header.Get(hdr.UserAgent)
 	}
 	if userAgent != "" {
-		_, err = fmt.Fprintf(w, "User-Agent: %s\r\n", userAgent)
+		_, err = fmt.Fprintf(hw, "User-Agent: %s\r\n", userAgent)
 		if err != nil {
 			return err
 		}
 	}
 
 	// Process Body,ContentLength,Close,Trailer
-	transfWriter, err := r.createWriter()
+	transfWriter, err = r.createWriter()
 	if err != nil {
 		return err
 	}
 
 	//TODO : @badu - maybe move code below into createWriter()
-	err = transfWriter.WriteHeader(w)
+	err = transfWriter.WriteHeader(hw)
 	if err != nil {
 		return err
 	}
 
-	err = r.Header.WriteSubset(w, reqWriteExcludeHeader)
+	err = r.Header.WriteSubset(hw, reqWriteExcludeHeader)
 	if err != nil {
 		return err
 	}
 
 	if extraHeaders != nil {
-		err = extraHeaders.Write(w)
+		err = extraHeaders.Write(hw)
 		if err != nil {
 			return err
 		}
 	}
-	_, err = io.WriteString(w, "\r\n") //TODO : maybe ? w.Write(CrLf) - If w implements a WriteString method, it is invoked directly. Otherwise, w.Write is called exactly once.
+	_, err = io.WriteString(cw, "\r\n") //TODO : maybe ? w.Write(CrLf) - If w implements a WriteString method, it is invoked directly. Otherwise, w.Write is called exactly once.
 
 	if err != nil {
 		return err
 	}
 
+	if hbuf != nil {
+		tracer.WroteHeaderFields(parseHeaderFields(hbuf.Bytes()))
+	}
 	if tracer != nil && tracer.WroteHeaders != nil {
 		tracer.WroteHeaders()
 	}
@@ -267,14 +397,19 @@ func (r *Request) write(w io.Writer, usingProxy bool, extraHeaders hdr.Header, w
 		}
 	}
 
-	if bw, ok := w.(*bufio.Writer); ok && transfWriter.FlushHeaders {
+	if bw, ok := w.(*bufio.Writer); ok && (transfWriter.FlushHeaders || flushWrites) {
 		if err := bw.Flush(); err != nil {
 			return err
 		}
 	}
 
 	// Write body and trailer
-	err = transfWriter.WriteBody(w)
+	if flushWrites && !chunked(transfWriter.TransferEncoding) {
+		// hide bufio.Writer's ReadFrom, so every read of the body gets its own Write
+		err = transfWriter.WriteBody(writerOnly{fw})
+	} else {
+		err = transfWriter.WriteBody(w)
+	}
 	if err != nil {
 		if transfWriter.bodyReadError == err {
 			err = RequestBodyReadError{err}
@@ -302,6 +437,7 @@ func (r *Request) createWriter() (*transferWriter, error) {
 		Body:             r.Body,
 		BodyCloser:       r.Body,
 		ContentLength:    r.OutgoingLength(),
+		bodyHash:         r.bodyHash,
 	}
 
 	if t.ContentLength < 0 && len(t.TransferEncoding) == 0 && t.shouldSendChunkedRequestBody() {
@@ -353,6 +489,26 @@ func (r *Request) SetBasicAuth(username, password string) {
 	r.Header.Set(hdr.Authorization, "Basic "+url.BasicAuth(username, password))
 }
 
+// BearerAuth returns the token provided in the request's Authorization
+// header, if the request uses Bearer token authentication (RFC 6750).
+// The scheme is matched case-insensitively; an empty token is rejected.
+func (r *Request) BearerAuth() (string, bool) {
+	auth := r.Header.Get(hdr.Authorization)
+	if auth == "" {
+		return "", false
+	}
+	return parseBearerAuth(auth)
+}
+
+// SetBearerAuth sets the request's Authorization header to use Bearer
+// token authentication with the provided token.
+//
+// Like Basic credentials, the token is sent in the clear unless the
+// request goes over TLS.
+func (r *Request) SetBearerAuth(token string) {
+	r.Header.Set(hdr.Authorization, "Bearer "+token)
+}
+
 // ParseForm populates r.Form and r.PostForm.
 //
 // For all requests, ParseForm parses the raw query from the URL and updates
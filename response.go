@@ -9,8 +9,11 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"os"
 	"strconv" // TODO : get rid of it
 	"strings"
+	"time"
 
 	"github.com/badu/http/hdr"
 	"github.com/badu/http/url"
@@ -29,6 +32,122 @@ func (r *Response) Location() (*url.URL, error) {
 	return url.Parse(lv)
 }
 
+// ForceConnectionClose makes Write emit a "Connection: close" header,
+// whatever the keep-alive decision made from the Header would have been.
+// It is the same as setting Close.
+func (r *Response) ForceConnectionClose() {
+	r.Close = true
+}
+
+// WillCloseConnection reports whether the connection the response was read
+// from is closed, instead of being kept alive for reuse, once the Body has
+// been consumed: either the server asked for it, or the Request did.
+func (r *Response) WillCloseConnection() bool {
+	return r.Close || r.Request != nil && r.Request.Close
+}
+
+// Reusable reports whether the Transport will put the connection the
+// response was read from back into its idle pool once the Body is read
+// to EOF and closed. It is false when the connection will be closed
+// (see WillCloseConnection), for informational (1xx) responses, when
+// keep-alives are disabled, and once the Body was closed early or
+// failed to read. It is also false for a Body that can't tell, i.e. one
+// not set by the Transport nor wrapped by the Client.
+func (r *Response) Reusable() bool {
+	if r.WillCloseConnection() || r.StatusCode < 200 {
+		return false
+	}
+	if r.Body == nil || r.Body == NoBody {
+		return true
+	}
+	if rb, ok := r.Body.(reusableBody); ok {
+		return rb.Reusable()
+	}
+	return false
+}
+
+// RedirectChain returns the URLs of the redirect hops the Client followed
+// to obtain the response, from the original request's URL to the final one.
+// It is empty when no redirect was followed.
+func (r *Response) RedirectChain() []*url.URL {
+	if len(r.Via) == 0 {
+		return nil
+	}
+	chain := make([]*url.URL, 0, len(r.Via)+1)
+	for _, req := range r.Via {
+		chain = append(chain, req.URL)
+	}
+	if r.Request != nil {
+		chain = append(chain, r.Request.URL)
+	}
+	return chain
+}
+
+// TrailerInt returns the value of the trailer key parsed as a decimal integer.
+// Trailers are only populated after the Body has been read to EOF; before that,
+// or when the trailer is missing, ErrNoTrailer is returned.
+func (r *Response) TrailerInt(key string) (int, error) {
+	v := r.Trailer.Get(key)
+	if v == "" {
+		return 0, ErrNoTrailer
+	}
+	return strconv.Atoi(hdr.TrimString(v))
+}
+
+// TrailerTime returns the value of the trailer key parsed as an HTTP date,
+// in any of the formats accepted by hdr.ParseTime.
+// Trailers are only populated after the Body has been read to EOF; before that,
+// or when the trailer is missing, ErrNoTrailer is returned.
+func (r *Response) TrailerTime(key string) (time.Time, error) {
+	v := r.Trailer.Get(key)
+	if v == "" {
+		return time.Time{}, ErrNoTrailer
+	}
+	return hdr.ParseTime(hdr.TrimString(v))
+}
+
+// BufferToDisk reads the Body to EOF and closes it, returning a seekable
+// reader over its content along with a cleanup func to call once the
+// reader is no longer needed. Up to memLimit bytes are kept in memory;
+// a larger body is spilled to a temporary file, removed by cleanup.
+func (r *Response) BufferToDisk(memLimit int64) (io.ReadSeeker, func() error, error) {
+	noCleanup := func() error { return nil }
+	if r.Body == nil {
+		return bytes.NewReader(nil), noCleanup, nil
+	}
+	defer r.Body.Close()
+
+	var b bytes.Buffer
+	n, err := io.CopyN(&b, r.Body, memLimit+1)
+	if err != nil && err != io.EOF {
+		return nil, nil, err
+	}
+	if n <= memLimit {
+		return bytes.NewReader(b.Bytes()), noCleanup, nil
+	}
+
+	// too big, write to disk and flush buffer
+	file, err := ioutil.TempFile("", "response-")
+	if err != nil {
+		return nil, nil, err
+	}
+	cleanup := func() error {
+		err := file.Close()
+		if rerr := os.Remove(file.Name()); err == nil {
+			err = rerr
+		}
+		return err
+	}
+	if _, err = io.Copy(file, io.MultiReader(&b, r.Body)); err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	return file, cleanup, nil
+}
+
 // ProtoAtLeast reports whether the HTTP protocol used in the response is at least major.minor.
 func (r *Response) ProtoAtLeast(major, minor int) bool {
 	return r.ProtoMajor > major ||
@@ -52,6 +171,39 @@ func (r *Response) ProtoAtLeast(major, minor int) bool {
 //
 // The Response Body is closed after it is sent.
 func (r *Response) Write(w io.Writer) error {
+	_, tw, err := r.writeHeader(w)
+	if err != nil {
+		return err
+	}
+
+	// Write body and trailer
+	err = tw.WriteBody(w)
+	if err != nil {
+		return err
+	}
+
+	// Success
+	return nil
+}
+
+// WriteHeaderOnly is like Write but stops after the status line and the
+// header, which carry the same Content-Length or Transfer-Encoding framing
+// Write would have used. The Body is left open, so it can be written
+// later in the announced framing: chunked if the header says so.
+// When ContentLength is 0, the Body is probed for content, as Write does,
+// and r.Body is replaced by a reader yielding the same bytes.
+func (r *Response) WriteHeaderOnly(w io.Writer) error {
+	r1, _, err := r.writeHeader(w)
+	if r1 != nil && r.ContentLength == 0 && r1.ContentLength == -1 {
+		// the probe consumed the first byte of the body
+		r.Body = r1.Body
+	}
+	return err
+}
+
+// writeHeader writes the status line and the header of r to w, returning
+// the adjusted copy of r and the transferWriter to write the body with.
+func (r *Response) writeHeader(w io.Writer) (*Response, *transferWriter, error) {
 	// Status line
 	text := r.Status
 	if text == "" {
@@ -67,7 +219,7 @@ func (r *Response) Write(w io.Writer) error {
 	}
 
 	if _, err := fmt.Fprintf(w, "HTTP/%d.%d %03d %s\r\n", r.ProtoMajor, r.ProtoMinor, r.StatusCode, text); err != nil {
-		return err
+		return nil, nil, err
 	}
 
 	// Clone it, so we can modify r1 as needed.
@@ -79,7 +231,7 @@ func (r *Response) Write(w io.Writer) error {
 		var buf [1]byte
 		n, err := r1.Body.Read(buf[:])
 		if err != nil && err != io.EOF {
-			return err
+			return nil, nil, err
 		}
 		if n == 0 {
 			// Reset it to a known zero reader, in case underlying one
@@ -107,19 +259,19 @@ func (r *Response) Write(w io.Writer) error {
 	// Process Body,ContentLength,Close,Trailer
 	tw, err := r1.createWriter()
 	if err != nil {
-		return err
+		return r1, nil, err
 	}
 
 	//TODO : @badu - maybe move code below into createWriter()
 	err = tw.WriteHeader(w)
 	if err != nil {
-		return err
+		return r1, nil, err
 	}
 
 	// Rest of header
 	err = r.Header.WriteSubset(w, respExcludeHeader)
 	if err != nil {
-		return err
+		return r1, nil, err
 	}
 
 	// contentLengthAlreadySent may have been already sent for
@@ -127,25 +279,18 @@ func (r *Response) Write(w io.Writer) error {
 	contentLengthAlreadySent := tw.shouldSendContentLength()
 	if r1.ContentLength == 0 && !chunked(r1.TransferEncoding) && !contentLengthAlreadySent && bodyAllowedForStatus(r.StatusCode) {
 		if _, err := io.WriteString(w, "Content-Length: 0\r\n"); err != nil {
-			return err
+			return r1, nil, err
 		}
 	}
 
 	// End-of-header
 	//TODO : maybe ? w.Write(CrLf) - If w implements a WriteString method, it is invoked directly. Otherwise, w.Write is called exactly once.
 	if _, err := io.WriteString(w, "\r\n"); err != nil {
-		return err
+		return r1, nil, err
 	}
-
-	// Write body and trailer
-	err = tw.WriteBody(w)
-	if err != nil {
-		return err
-	}
-
-	// Success
-	return nil
+	return r1, tw, nil
 }
+
 func (r *Response) createWriter() (*transferWriter, error) {
 	t := &transferWriter{
 		Body:             r.Body,
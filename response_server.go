@@ -7,6 +7,7 @@ package http
 
 import (
 	"bufio"
+	"context"
 	"io"
 	"net"
 	"strconv" // TODO : get rid of it
@@ -39,6 +40,11 @@ func (r *response) finalTrailers() hdr.Header {
 	return t
 }
 
+// SetTrailer implements the TrailerWriter.SetTrailer method.
+func (r *response) SetTrailer(key, value string) {
+	r.handlerHeader[TrailerPrefix+hdr.CanonicalHeaderKey(key)] = []string{value}
+}
+
 // declareTrailer is called for each Trailer header when the
 // response header is written. It notes that a header will need to be
 // written in the trailers at the end of the response.
@@ -244,6 +250,40 @@ func (r *response) WriteString(data string) (int, error) {
 	return r.bufWriter.WriteString(data)
 }
 
+// WriteContext implements the ContextWriter.WriteContext method.
+func (r *response) WriteContext(ctx context.Context, data []byte) (int, error) {
+	if err := ctx.Err(); err != nil {
+		r.closeAfterReply = true
+		return 0, err
+	}
+	done := ctx.Done()
+	if done == nil {
+		return r.Write(data)
+	}
+	stop := make(chan struct{})
+	watched := make(chan struct{})
+	go func() {
+		defer close(watched)
+		select {
+		case <-done:
+			// Unblock a write stuck on a client that stopped reading.
+			// The past deadline fails any later write on the
+			// connection too, which is closed below.
+			r.conn.netConIface.SetWriteDeadline(aLongTimeAgo)
+		case <-stop:
+		}
+	}()
+	n, err := r.Write(data)
+	close(stop)
+	// Don't return while the deadline may still be set behind our back.
+	<-watched
+	if cerr := ctx.Err(); cerr != nil {
+		r.closeAfterReply = true
+		return n, cerr
+	}
+	return n, err
+}
+
 func (r *response) finishRequest() {
 	r.handlerDone.setTrue()
 
@@ -308,6 +348,27 @@ func (r *response) Flush() {
 	r.chunkWriter.flush()
 }
 
+// WriteEarlyHints implements the EarlyHinter.WriteEarlyHints method.
+func (r *response) WriteEarlyHints(h hdr.Header) {
+	if r.conn.hijacked() {
+		return
+	}
+	if r.wroteHeader {
+		srv := r.ctx.Value(SrvCtxtKey).(*Server)
+		srv.logf("http: response.WriteEarlyHints called after the header was written")
+		return
+	}
+	// RFC 7231 6.2 : a server must not send a 1xx response to an HTTP/1.0 client
+	if !r.req.ProtoAtLeast(1, 1) {
+		return
+	}
+	bw := r.conn.bufWriter
+	writeStatusLine(bw, true, StatusEarlyHints, r.statusBuf[:])
+	h.Write(bw)
+	bw.Write(CrLf)
+	bw.Flush()
+}
+
 func (r *response) sendExpectationFailed() {
 	// TODO(bradfitz): let ServeHTTP handlers handle requests with non-standard expectation[s]? Seems theoretical at best, and doesn't fit into the current ServeHTTP model anyway. We'd need to make the ResponseWriter an optional "ExpectReplier" interface or something.
 	//
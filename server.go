@@ -8,8 +8,11 @@ package http
 import (
 	"context"
 	"crypto/tls"
+	"fmt"
+	"io"
 	"log"
 	"net"
+	"strings"
 	"sync/atomic"
 	"time"
 )
@@ -21,6 +24,10 @@ func (s *Server) newConn(rwc net.Conn) *conn {
 		//server:      s,
 		netConIface: rwc,
 	}
+	if s.CountConnBytes {
+		c.bytes = new(ConnBytes)
+		c.netConIface = &countingConn{Conn: rwc, bytes: c.bytes}
+	}
 	// @comment : replaces the underlying network connection with a fake one that traces everything (all tests will fail)
 	if debugServerConnections {
 		c.netConIface = newLoggingConn("server", c.netConIface)
@@ -116,7 +123,7 @@ func (s *Server) Shutdown(ctx context.Context) error {
 	ticker := time.NewTicker(shutdownPollInterval)
 	defer ticker.Stop()
 	for {
-		if s.closeIdleConns() {
+		if s.closeIdleConns(nil) {
 			return lnerr
 		}
 		select {
@@ -138,13 +145,101 @@ func (s *Server) RegisterOnShutdown(f func()) {
 	s.mu.Unlock()
 }
 
-// closeIdleConns closes all idle connections and reports whether the
-// server is quiescent.
-func (s *Server) closeIdleConns() bool {
+// RegisterEncoder registers newWriter as the content encoder for
+// responses with the given encoding, such as "gzip", "deflate" or "br".
+// The handler returned by EncodeHandler negotiates the encoding of each
+// response among the registered ones, using the request's
+// Accept-Encoding header. newWriter is called once per response, with
+// the ResponseWriter to write the encoded body to; the Close of the
+// returned WriteCloser must flush any buffered data but not close the
+// ResponseWriter.
+// Registering an encoding again replaces the previous encoder.
+func (s *Server) RegisterEncoder(encoding string, newWriter func(io.Writer) io.WriteCloser) {
+	s.mu.Lock()
+	if s.encoders == nil {
+		s.encoders = make(map[string]func(io.Writer) io.WriteCloser)
+	}
+	s.encoders[strings.ToLower(encoding)] = newWriter
+	s.mu.Unlock()
+}
+
+// encoder returns the encoder registered for encoding, if any.
+func (s *Server) encoder(encoding string) func(io.Writer) io.WriteCloser {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.encoders[encoding]
+}
+
+// ActiveConns returns the number of connections the Server currently
+// tracks as either active or idle. It can be polled while Shutdown
+// drains the server to watch the count drop to zero.
+// Hijacked connections are not counted.
+func (s *Server) ActiveConns() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for c := range s.activeConn {
+		st, _ := c.curState.Load().(ConnState)
+		if st == StateActive || st == StateIdle {
+			n++
+		}
+	}
+	return n
+}
+
+// ShutdownListener gracefully stops serving the single listener ln,
+// while the Server keeps serving its other listeners. It closes ln,
+// which makes the Serve call that was given ln return ErrServerClosed,
+// then closes the idle connections accepted on ln and waits for the
+// active ones to become idle and be closed in turn.
+// If the provided context expires before that, ShutdownListener returns
+// the context's error, otherwise it returns any error returned from
+// closing ln.
+//
+// The connections accepted on ln stop keep-alives, so the active ones
+// are closed after their current response.
+//
+// ln must be the listener passed to Serve or ServeTLS. Hijacked
+// connections are neither closed nor waited for, same as with Shutdown.
+func (s *Server) ShutdownListener(ctx context.Context, ln net.Listener) error {
+	s.mu.Lock()
+	if _, ok := s.listeners[ln]; !ok {
+		s.mu.Unlock()
+		return errListenerNotServed
+	}
+	delete(s.listeners, ln)
+	lnerr := ln.Close()
+	for c := range s.activeConn {
+		if c.listener == ln {
+			atomic.StoreInt32(&c.draining, 1)
+		}
+	}
+	s.mu.Unlock()
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for {
+		if s.closeIdleConns(ln) {
+			return lnerr
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// closeIdleConns closes the idle connections accepted on ln (all of them
+// if ln is nil) and reports whether those connections are all closed.
+func (s *Server) closeIdleConns(ln net.Listener) bool {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	quiescent := true
 	for c := range s.activeConn {
+		if ln != nil && c.listener != ln {
+			continue
+		}
 		st, ok := c.curState.Load().(ConnState)
 		if !ok || st != StateIdle {
 			quiescent = false
@@ -157,12 +252,14 @@ func (s *Server) closeIdleConns() bool {
 }
 
 func (s *Server) closeListenersLocked() error {
-	if s.listener != nil {
-		if cerr := s.listener.Close(); cerr != nil {
-			return cerr
+	var err error
+	for ln := range s.listeners {
+		if cerr := ln.Close(); cerr != nil && err == nil {
+			err = cerr
 		}
+		delete(s.listeners, ln)
 	}
-	return nil
+	return err
 }
 
 // ListenAndServe listens on the TCP network address srv.Addr and then
@@ -194,15 +291,28 @@ func (s *Server) ListenAndServe() error {
 // Serve always returns a non-nil error. After Shutdown or Close, the
 // returned error is ErrServerClosed.
 func (s *Server) Serve(lsn net.Listener) error {
+	return s.serve(lsn, lsn)
+}
+
+// serve accepts the connections of lsn, tracking them, for Close,
+// Shutdown and ShutdownListener, under the listener key the caller was
+// given, which differs from lsn when ServeTLS wrapped it.
+func (s *Server) serve(lsn, key net.Listener) error {
 	defer lsn.Close()
 
 	// @comment : new way of dispatching server Serve (so we got rid of the boilerplate)
 	TestEventsEmitter.Dispatch(ServerServe)
 
-	s.trackListener(lsn, true)
-	defer s.trackListener(lsn, false)
+	s.trackListener(key, true)
+	defer s.trackListener(key, false)
 
-	baseCtx := context.Background() // base is always background, per Issue 16220
+	baseCtx := context.Background() // base is background unless BaseContext says otherwise, per Issue 16220
+	if s.BaseContext != nil {
+		baseCtx = s.BaseContext(lsn)
+		if baseCtx == nil {
+			panic("BaseContext returned a nil context")
+		}
+	}
 	ctx := context.WithValue(baseCtx, SrvCtxtKey, s)
 
 	// @comment : how long to sleep on accept failure
@@ -217,6 +327,10 @@ func (s *Server) Serve(lsn net.Listener) error {
 				return ErrServerClosed
 			default:
 			}
+			if !s.isTrackedListener(key) {
+				// @comment : closed by ShutdownListener
+				return ErrServerClosed
+			}
 			// @comment : net.Error is an interface : Timeout() bool and Temporary() bool
 			if ne, ok := e.(net.Error); ok && ne.Temporary() {
 				if tempDelay == 0 {
@@ -236,21 +350,59 @@ func (s *Server) Serve(lsn net.Listener) error {
 		}
 		// @comment : finally, we're dealing with the connection
 		tempDelay = 0
-		// @comment : init internal connection
-		newConn := s.newConn(conn)
-		// @comment :  set it's state
-		s.setState(newConn, StateNew) // before Serve can return
-		// @comment : perform in a different goroutine + passing the context built here
-		go newConn.serve(ctx)
+		if s.MaxConcurrentConns > 0 && s.MaxConnsGrace > 0 {
+			// @comment : each connection waits for a slot on its own, so that they all get the whole grace
+			go func(conn net.Conn) {
+				holdsSlot, err := s.acquireConnSlot(conn)
+				if err != nil {
+					if err != errConnRejected {
+						conn.Close()
+					}
+					return
+				}
+				s.startConn(ctx, key, conn, holdsSlot)
+			}(conn)
+			continue
+		}
+		holdsSlot, err := s.acquireConnSlot(conn)
+		if err != nil {
+			conn.Close()
+			return err
+		}
+		s.startConn(ctx, key, conn, holdsSlot)
 	}
 }
 
+// startConn serves conn, accepted on the listener tracked as key, in a
+// new goroutine.
+func (s *Server) startConn(ctx context.Context, key net.Listener, conn net.Conn, holdsSlot bool) {
+	// @comment : init internal connection
+	newConn := s.newConn(conn)
+	newConn.listener = key
+	newConn.holdsSlot = holdsSlot
+	// @comment :  set it's state
+	s.setState(newConn, StateNew) // before Serve can return
+	connCtx := ctx
+	if cc := s.ConnContext; cc != nil {
+		connCtx = cc(connCtx, conn)
+		if connCtx == nil {
+			panic("ConnContext returned nil")
+		}
+	}
+	// @comment : perform in a different goroutine + passing the context built here
+	go newConn.serve(connCtx)
+}
+
 func (s *Server) setState(c *conn, state ConnState) {
 	switch state {
 	case StateNew:
 		s.trackConn(c, true)
 	case StateHijacked, StateClosed:
 		s.trackConn(c, false)
+		if c.holdsSlot {
+			c.holdsSlot = false
+			<-s.connSlots
+		}
 	}
 	c.curState.Store(connStateInterface[state])
 	if hook := s.ConnState; hook != nil {
@@ -298,20 +450,43 @@ func (s *Server) ServeTLS(lsn net.Listener, certFile, keyFile string) error {
 	}
 	// @comment : create a tls listener with the configuration and net.Listener
 	tlsListener := tls.NewListener(lsn, config)
-	return s.Serve(tlsListener)
+	return s.serve(tlsListener, lsn)
 }
 
 // @comment : tracks Close, Shutdown
 func (s *Server) trackListener(ln net.Listener, add bool) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	if s.listeners == nil {
+		s.listeners = make(map[net.Listener]struct{})
+	}
 	if add {
-		s.listener = ln
+		s.listeners[ln] = struct{}{}
+		s.boundAddr = ln.Addr()
 	} else {
-		s.listener = nil
+		delete(s.listeners, ln)
 	}
 }
 
+// BoundAddr returns the address of the listener the Server most recently
+// started serving, or nil if it didn't start serving yet. With an Addr
+// such as ":0", it tells the port the operating system picked, once
+// ListenAndServe is running.
+func (s *Server) BoundAddr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.boundAddr
+}
+
+// isTrackedListener reports whether ln is still being served, i.e. it was
+// not closed by ShutdownListener, Shutdown or Close.
+func (s *Server) isTrackedListener(ln net.Listener) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.listeners[ln]
+	return ok
+}
+
 func (s *Server) trackConn(c *conn, add bool) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -320,11 +495,59 @@ func (s *Server) trackConn(c *conn, add bool) {
 	}
 	if add {
 		s.activeConn[c] = struct{}{}
+		if c.listener != nil {
+			// @comment : accepted right before ShutdownListener closed its listener
+			if _, ok := s.listeners[c.listener]; !ok {
+				atomic.StoreInt32(&c.draining, 1)
+			}
+		}
 	} else {
 		delete(s.activeConn, c)
 	}
 }
 
+// acquireConnSlot waits for one of the MaxConcurrentConns slots to serve
+// rwc and reports whether it took one. If no slot frees up within
+// MaxConnsGrace, it replies 503 Service Unavailable, closes rwc and
+// returns errConnRejected. It returns ErrServerClosed if the server is
+// shut down while waiting. With a MaxConnsGrace, Serve calls it in the
+// goroutine of rwc, so that a slow peer doesn't hold up the others.
+func (s *Server) acquireConnSlot(rwc net.Conn) (bool, error) {
+	if s.MaxConcurrentConns <= 0 {
+		return false, nil
+	}
+	s.mu.Lock()
+	if s.connSlots == nil {
+		s.connSlots = make(chan struct{}, s.MaxConcurrentConns)
+	}
+	slots, done := s.connSlots, s.getDoneChanLocked()
+	s.mu.Unlock()
+
+	select {
+	case slots <- struct{}{}:
+		return true, nil
+	default:
+	}
+	var grace <-chan time.Time
+	if s.MaxConnsGrace > 0 {
+		t := time.NewTimer(s.MaxConnsGrace)
+		defer t.Stop()
+		grace = t.C
+	}
+	select {
+	case slots <- struct{}{}:
+		return true, nil
+	case <-done:
+		return false, ErrServerClosed
+	case <-grace:
+		const publicErr = "503 Service Unavailable"
+		rwc.SetWriteDeadline(time.Now().Add(time.Second))
+		fmt.Fprintf(rwc, "HTTP/1.1 "+publicErr+errorHeaders+publicErr)
+		rwc.Close()
+		return false, errConnRejected
+	}
+}
+
 func (s *Server) idleTimeout() time.Duration {
 	if s.IdleTimeout != 0 {
 		return s.IdleTimeout
@@ -339,6 +562,14 @@ func (s *Server) readHeaderTimeout() time.Duration {
 	return s.ReadTimeout
 }
 
+// now returns the current time, as given by NowFunc if set.
+func (s *Server) now() time.Time {
+	if s.NowFunc != nil {
+		return s.NowFunc()
+	}
+	return time.Now()
+}
+
 func (s *Server) doKeepAlives() bool {
 	return atomic.LoadInt32(&s.disableKeepAlives) == 0 && !s.shuttingDown()
 }
@@ -359,7 +590,7 @@ func (s *Server) SetKeepAlivesEnabled(v bool) {
 	atomic.StoreInt32(&s.disableKeepAlives, 1)
 
 	// Close idle HTTP/1 conns:
-	s.closeIdleConns()
+	s.closeIdleConns(nil)
 
 	// Close HTTP/2 conns, as soon as they become idle, but reset
 	// the chan so future conns (if the listener is still active)
@@ -6,7 +6,9 @@
 package tests
 
 import (
+	"bufio"
 	"bytes"
+	"compress/gzip"
 	"context"
 	"crypto/tls"
 	"encoding/base64"
@@ -30,6 +32,7 @@ import (
 	. "github.com/badu/http"
 	"github.com/badu/http/cli"
 	"github.com/badu/http/th"
+	"github.com/badu/http/trc"
 	. "github.com/badu/http/tport"
 )
 
@@ -67,6 +70,60 @@ func TestClientHead(t *testing.T) {
 	}
 }
 
+func TestClientGetIfModifiedSince(t *testing.T) {
+	defer afterTest(t)
+	lastMod := time.Date(2018, 3, 4, 5, 6, 7, 0, time.UTC)
+	cst := newClientServerTest(t, HandlerFunc(func(w ResponseWriter, r *Request) {
+		if r.URL.Path == "/old" {
+			Redirect(w, r, "/new", StatusFound)
+			return
+		}
+		w.Header().Set(hdr.LastModified, lastMod.Format(hdr.TimeFormat))
+		if ims, err := hdr.ParseTime(r.Header.Get(hdr.IfModifiedSince)); err == nil && !lastMod.After(ims) {
+			w.WriteHeader(StatusNotModified)
+			return
+		}
+		io.WriteString(w, "content")
+	}))
+	defer cst.close()
+
+	res, err := cst.c.Get(cst.ts.URL + "/new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.CloseBody()
+	// Last-Modified round-trips through If-Modified-Since.
+	modTime, err := hdr.ParseTime(res.Header.Get(hdr.LastModified))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path     string
+		since    time.Time
+		wantCode int
+		wantBody string
+	}{
+		{"/new", modTime.In(time.FixedZone("X", 3600)), StatusNotModified, ""},
+		{"/old", modTime, StatusNotModified, ""}, // behind a redirect
+		{"/new", modTime.Add(-time.Hour), StatusOK, "content"},
+	}
+	for _, tt := range tests {
+		res, err := cst.c.GetIfModifiedSince(cst.ts.URL+tt.path, tt.since)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.path, err)
+		}
+		body, err := ioutil.ReadAll(res.Body)
+		res.CloseBody()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != tt.wantCode || string(body) != tt.wantBody {
+			t.Errorf("%s since %v: got %d %q; want %d %q", tt.path, tt.since, res.StatusCode, body, tt.wantCode, tt.wantBody)
+		}
+	}
+}
+
 func TestGetRequestFormat(t *testing.T) {
 	setParallel(t)
 	defer afterTest(t)
@@ -176,27 +233,27 @@ func TestClientRedirects(t *testing.T) {
 
 	c := ts.Client()
 	_, err := c.Get(ts.URL)
-	if e, g := "Get /?n=10: stopped after 10 redirects", fmt.Sprintf("%v", err); e != g {
+	if e, g := "Get " + ts.URL + "/?n=10: stopped after 10 redirects", fmt.Sprintf("%v", err); e != g {
 		t.Errorf("with default client Get, expected error %q, got %q", e, g)
 	}
 
 	// HEAD request should also have the ability to follow redirects.
 	_, err = c.Head(ts.URL)
-	if e, g := "Head /?n=10: stopped after 10 redirects", fmt.Sprintf("%v", err); e != g {
+	if e, g := "Head " + ts.URL + "/?n=10: stopped after 10 redirects", fmt.Sprintf("%v", err); e != g {
 		t.Errorf("with default client Head, expected error %q, got %q", e, g)
 	}
 
 	// Do should also follow redirects.
 	greq, _ := NewRequest(GET, ts.URL, nil)
 	_, err = c.Do(greq)
-	if e, g := "Get /?n=10: stopped after 10 redirects", fmt.Sprintf("%v", err); e != g {
+	if e, g := "Get " + ts.URL + "/?n=10: stopped after 10 redirects", fmt.Sprintf("%v", err); e != g {
 		t.Errorf("with default client Do, expected error %q, got %q", e, g)
 	}
 
 	// Requests with an empty Method should also redirect (Issue 12705)
 	greq.Method = ""
 	_, err = c.Do(greq)
-	if e, g := "Get /?n=10: stopped after 10 redirects", fmt.Sprintf("%v", err); e != g {
+	if e, g := "Get " + ts.URL + "/?n=10: stopped after 10 redirects", fmt.Sprintf("%v", err); e != g {
 		t.Errorf("with default client Do and empty Method, expected error %q, got %q", e, g)
 	}
 
@@ -242,6 +299,8 @@ func TestClientRedirects(t *testing.T) {
 	res, err = c.Get(ts.URL)
 	if urlError, ok := err.(*url.Error); !ok || urlError.Err != checkErr {
 		t.Errorf("with redirects forbidden, expected a *url.Error with our 'no redirects allowed' error inside; got %#v (%q)", err, err)
+	} else if want := ts.URL + "/?n=1"; urlError.URL != want {
+		t.Errorf("with redirects forbidden, error URL = %q; want %q", urlError.URL, want)
 	}
 	if res == nil {
 		t.Fatalf("Expected a non-nil Response on CheckRedirect failure (https://golang.org/issue/3795)")
@@ -252,6 +311,284 @@ func TestClientRedirects(t *testing.T) {
 	}
 }
 
+// The error of a redirect chain failing on a later hop names that hop.
+func TestClientRedirectErrorURL(t *testing.T) {
+	setParallel(t)
+	defer afterTest(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadURL := "http://" + ln.Addr().String() + "/gone"
+	ln.Close()
+
+	ts := th.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		if r.URL.Path == "/" {
+			Redirect(w, r, "/hop", StatusFound)
+			return
+		}
+		Redirect(w, r, deadURL, StatusFound)
+	}))
+	defer ts.Close()
+
+	_, err = ts.Client().Get(ts.URL)
+	ue, ok := err.(*url.Error)
+	if !ok {
+		t.Fatalf("Get error = %#v; want a *url.Error", err)
+	}
+	if ue.URL != deadURL {
+		t.Errorf("error URL = %q; want %q", ue.URL, deadURL)
+	}
+}
+
+func TestClientMaxRedirects(t *testing.T) {
+	setParallel(t)
+	defer afterTest(t)
+	ts := th.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		n, _ := strconv.Atoi(r.FormValue("n"))
+		if n < 20 {
+			Redirect(w, r, fmt.Sprintf("/?n=%d", n+1), StatusFound)
+			return
+		}
+		fmt.Fprintf(w, "n=%d", n)
+	}))
+	defer ts.Close()
+
+	c := ts.Client()
+	c.MaxRedirects = 15
+	_, err := c.Get(ts.URL)
+	if e, g := "Get " + ts.URL + "/?n=15: stopped after 15 redirects", fmt.Sprintf("%v", err); e != g {
+		t.Errorf("with MaxRedirects 15, expected error %q, got %q", e, g)
+	}
+	res, err := c.Get(ts.URL + "/?n=6")
+	if err != nil {
+		t.Fatalf("14-hop chain with MaxRedirects 15: %v", err)
+	}
+	res.CloseBody()
+
+	c.MaxRedirects = 1
+	_, err = c.Get(ts.URL)
+	if e, g := "Get " + ts.URL + "/?n=1: stopped after 1 redirects", fmt.Sprintf("%v", err); e != g {
+		t.Errorf("with MaxRedirects 1, expected error %q, got %q", e, g)
+	}
+
+	// CheckRedirect is consulted first; MaxRedirects still applies after it.
+	checkErr := errors.New("no redirects to n=3")
+	var checked int
+	c.MaxRedirects = 5
+	c.CheckRedirect = func(req *Request, via []*Request) error {
+		checked++
+		if req.URL.Query().Get("n") == "3" {
+			return checkErr
+		}
+		return nil
+	}
+	_, err = c.Get(ts.URL)
+	if uerr, ok := err.(*url.Error); !ok || uerr.Err != checkErr {
+		t.Errorf("with CheckRedirect, expected error %v, got %v", checkErr, err)
+	}
+	checked = 0
+	_, err = c.Get(ts.URL + "/?n=10")
+	if e, g := "Get " + ts.URL + "/?n=15: stopped after 5 redirects", fmt.Sprintf("%v", err); e != g {
+		t.Errorf("with CheckRedirect and MaxRedirects 5, expected error %q, got %q", e, g)
+	}
+	if checked != 5 {
+		t.Errorf("CheckRedirect called %d times; want 5", checked)
+	}
+}
+
+func TestClientDoCapture(t *testing.T) {
+	setParallel(t)
+	defer afterTest(t)
+	const body = "0123456789abcdef"
+	ts := th.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		io.WriteString(w, body)
+	}))
+	defer ts.Close()
+
+	for _, max := range []int64{0, 4} {
+		c := ts.Client()
+		c.MaxCaptureBytes = max
+		req, _ := NewRequest(GET, ts.URL, nil)
+		res, captured, err := c.DoCapture(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadAll(res.Body)
+		res.CloseBody()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != body {
+			t.Errorf("max %d: body = %q; want %q", max, got, body)
+		}
+		want := body
+		if max > 0 {
+			want = body[:max]
+		}
+		if string(captured) != want {
+			t.Errorf("max %d: captured = %q; want %q", max, captured, want)
+		}
+	}
+}
+
+func TestDrainResponse(t *testing.T) {
+	setParallel(t)
+	defer afterTest(t)
+	ts := th.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		io.WriteString(w, "0123456789")
+	}))
+	defer ts.Close()
+	c := ts.Client()
+
+	var reused []bool
+	doGet := func() *Response {
+		req, _ := NewRequest(GET, ts.URL, nil)
+		req = req.WithContext(trc.WithClientTrace(req.Context(), &trc.ClientTrace{
+			GotConn: func(info trc.GotConnInfo) { reused = append(reused, info.Reused) },
+		}))
+		res, err := c.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	if err := cli.DrainResponse(doGet(), 1024); err != nil {
+		t.Fatalf("DrainResponse = %v; want nil", err)
+	}
+	if err := cli.DrainResponse(doGet(), 4); err != cli.ErrDrainTruncated {
+		t.Fatalf("DrainResponse = %v; want ErrDrainTruncated", err)
+	}
+	doGet().CloseBody()
+	// The first drain allows reuse; the truncated one doesn't.
+	if want := []bool{false, true, false}; !reflect.DeepEqual(reused, want) {
+		t.Errorf("connection reuse = %v; want %v", reused, want)
+	}
+}
+
+func TestClientMaxResponseBodyBytes(t *testing.T) {
+	setParallel(t)
+	defer afterTest(t)
+	ts := th.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		if r.URL.Path == "/gzip" {
+			w.Header().Set(hdr.ContentEncoding, "gzip")
+			gz := gzip.NewWriter(w)
+			gz.Write(bytes.Repeat([]byte("x"), 1000))
+			gz.Close()
+			return
+		}
+		io.WriteString(w, "0123456789")
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		path    string
+		max     int64
+		wantLen int
+		wantErr error
+	}{
+		{"/", 0, 10, nil},
+		{"/", 10, 10, nil},
+		{"/", 4, 4, cli.ErrResponseBodyTooLarge},
+		// The decompressed size counts, not the size on the wire.
+		{"/gzip", 100, 100, cli.ErrResponseBodyTooLarge},
+		{"/gzip", 1000, 1000, nil},
+	}
+	for _, tt := range tests {
+		c := ts.Client()
+		c.MaxResponseBodyBytes = tt.max
+		res, err := c.Get(ts.URL + tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadAll(res.Body)
+		res.CloseBody()
+		if len(got) != tt.wantLen || err != tt.wantErr {
+			t.Errorf("%s with max %d: read %d bytes, err %v; want %d bytes, err %v", tt.path, tt.max, len(got), err, tt.wantLen, tt.wantErr)
+		}
+	}
+}
+
+func TestClientRedirectTimings(t *testing.T) {
+	setParallel(t)
+	defer afterTest(t)
+	ts := th.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		n, _ := strconv.Atoi(r.FormValue("n"))
+		if n < 3 {
+			Redirect(w, r, fmt.Sprintf("/?n=%d", n+1), StatusFound)
+			return
+		}
+		fmt.Fprintf(w, "n=%d", n)
+	}))
+	defer ts.Close()
+
+	c := ts.Client()
+	res, err := c.Get(ts.URL + "/?n=3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.CloseBody()
+	if len(res.RedirectTimings) != 0 {
+		t.Errorf("RedirectTimings without redirects = %v; want none", res.RedirectTimings)
+	}
+
+	res, err = c.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.CloseBody()
+	if g, e := len(res.RedirectTimings), 3; g != e {
+		t.Fatalf("got %d redirect timings (%v); want %d", g, res.RedirectTimings, e)
+	}
+	for i, d := range res.RedirectTimings {
+		if d <= 0 {
+			t.Errorf("RedirectTimings[%d] = %v; want > 0", i, d)
+		}
+	}
+}
+
+func TestClientRedirectChain(t *testing.T) {
+	setParallel(t)
+	defer afterTest(t)
+	ts := th.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		n, _ := strconv.Atoi(r.FormValue("n"))
+		if n < 3 {
+			Redirect(w, r, fmt.Sprintf("/?n=%d", n+1), StatusFound)
+			return
+		}
+		fmt.Fprintf(w, "n=%d", n)
+	}))
+	defer ts.Close()
+
+	c := ts.Client()
+	res, err := c.Get(ts.URL + "/?n=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.CloseBody()
+	var got []string
+	for _, u := range res.RedirectChain() {
+		got = append(got, u.String())
+	}
+	want := []string{ts.URL + "/?n=0", ts.URL + "/?n=1", ts.URL + "/?n=2", ts.URL + "/?n=3"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("RedirectChain = %q; want %q", got, want)
+	}
+	if len(res.Via) != 3 {
+		t.Errorf("len(Via) = %d; want 3", len(res.Via))
+	}
+
+	res, err = c.Get(ts.URL + "/?n=3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.CloseBody()
+	if chain := res.RedirectChain(); len(chain) != 0 || len(res.Via) != 0 {
+		t.Errorf("without redirects, RedirectChain = %v, Via = %v; want empty", chain, res.Via)
+	}
+}
+
 // Tests that Client redirects' contexts are derived from the original request's context.
 func TestClientRedirectContext(t *testing.T) {
 	setParallel(t)
@@ -284,6 +621,127 @@ func TestClientRedirectContext(t *testing.T) {
 	}
 }
 
+func TestClientTimeout(t *testing.T) {
+	setParallel(t)
+	defer afterTest(t)
+	const timeout = 200 * time.Millisecond
+	ts := th.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		switch r.URL.Path {
+		case "/redirect":
+			// each hop stays under the timeout, not the two of them
+			time.Sleep(timeout * 3 / 4)
+			Redirect(w, r, "/slow-headers", StatusFound)
+			return
+		case "/slow-headers":
+			time.Sleep(timeout * 3 / 4)
+		case "/slow-body":
+			io.WriteString(w, "first part")
+			w.(Flusher).Flush()
+		}
+		<-r.Context().Done()
+	}))
+	defer ts.Close()
+	c := ts.Client()
+	c.Timeout = timeout
+
+	isTimeout := func(err error) bool {
+		te, ok := err.(interface{ Timeout() bool })
+		return ok && te.Timeout()
+	}
+
+	t1 := time.Now()
+	res, err := c.Get(ts.URL + "/slow-body")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(res.Body)
+	res.CloseBody()
+	if string(got) != "first part" {
+		t.Errorf("body = %q; want %q", got, "first part")
+	}
+	if !isTimeout(err) {
+		t.Errorf("reading the body: error = %v; want a timeout", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("reading the body: errors.Is(%v, context.DeadlineExceeded) = false; want true", err)
+	}
+	if d := time.Since(t1); d < timeout || d > 10*timeout {
+		t.Errorf("reading the body took %v; want about %v", d, timeout)
+	}
+
+	res, err = c.Get(ts.URL + "/redirect")
+	if err == nil {
+		res.CloseBody()
+		t.Fatal("redirected request succeeded; want the timeout to span the redirect")
+	}
+	if !isTimeout(err) {
+		t.Errorf("redirected request: error = %v; want a timeout", err)
+	}
+}
+
+func TestClientBaseContext(t *testing.T) {
+	setParallel(t)
+	defer afterTest(t)
+	arrived := make(chan bool, 3)
+	unblock := make(chan bool)
+	ts := th.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		arrived <- true
+		select {
+		case <-unblock:
+		case <-r.Context().Done():
+		}
+	}))
+	defer ts.Close()
+
+	base, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := ts.Client()
+	c.BaseContext = base
+
+	type result struct {
+		own bool
+		err error
+	}
+	results := make(chan result, 3)
+	for _, own := range []bool{false, false, true} {
+		go func(own bool) {
+			req, _ := NewRequest(GET, ts.URL, nil)
+			if own {
+				req = req.WithContext(context.WithValue(context.Background(), "own", true))
+			}
+			res, err := c.Do(req)
+			if err == nil {
+				res.CloseBody()
+			}
+			results <- result{own, err}
+		}(own)
+	}
+	for i := 0; i < 3; i++ {
+		<-arrived
+	}
+	cancel()
+
+	// Both requests with the default context abort, the other one
+	// keeps waiting on the handler.
+	for i := 0; i < 2; i++ {
+		select {
+		case r := <-results:
+			if r.own {
+				t.Fatalf("request with its own context ended after BaseContext was canceled: %v", r.err)
+			}
+			if ue, ok := r.err.(*url.Error); !ok || ue.Err != context.Canceled {
+				t.Errorf("request with the default context = %v; want a url.Error for %v", r.err, context.Canceled)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for the requests to abort")
+		}
+	}
+	close(unblock)
+	if r := <-results; !r.own || r.err != nil {
+		t.Errorf("request with its own context = %v; want success", r.err)
+	}
+}
+
 func TestPostRedirects(t *testing.T) {
 	postRedirectTests := []redirectTest{
 		{"/", 200, "first"},
@@ -619,6 +1077,150 @@ Cookies("http://firsthost.fake/nosetcookie")
 	}
 }
 
+func TestJarDomainScoping(t *testing.T) {
+	jar, _ := cli.NewCookie(nil)
+	mustParse := func(s string) *url.URL {
+		u, err := url.Parse(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return u
+	}
+	jar.SetCookies(mustParse("http://www.example.com/"), []*cli.Cookie{
+		{Name: "host", Value: "1"},
+		{Name: "domain", Value: "2", Domain: "example.com"},
+		{Name: "tld", Value: "3", Domain: "com"},
+		{Name: "other", Value: "4", Domain: "other.com"},
+		{Name: "secure", Value: "5", Secure: true},
+		{Name: "httponly", Value: "6", HttpOnly: true},
+		{Name: "path", Value: "7", Path: "/sub"},
+	})
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"http://www.example.com/", "host=1 domain=2 httponly=6"},
+		{"https://www.example.com/sub/page", "path=7 host=1 domain=2 secure=5 httponly=6"},
+		{"http://api.example.com/", "domain=2"},
+		{"http://example.com/", "domain=2"},
+		{"http://other.com/", ""},
+		{"http://another.com/", ""},
+		{"ftp://www.example.com/", ""},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, c := range jar.Cookies(mustParse(tt.url)) {
+			got = append(got, c.Name+"="+c.Value)
+		}
+		if g := strings.Join(got, " "); g != tt.want {
+			t.Errorf("Cookies(%q) = %q; want %q", tt.url, g, tt.want)
+		}
+	}
+}
+
+func TestCookieSameSite(t *testing.T) {
+	tests := []struct {
+		setCookie string
+		want      cli.SameSite
+		written   string
+	}{
+		{"a=1; SameSite=Strict", cli.SameSiteStrict, "a=1; SameSite=Strict"},
+		{"a=1; samesite=lax", cli.SameSiteLax, "a=1; SameSite=Lax"},
+		{"a=1; Secure; SameSite=None", cli.SameSiteNone, "a=1; Secure; SameSite=None"},
+		{"a=1; SameSite", cli.SameSiteDefault, "a=1"},
+		{"a=1; SameSite=bogus", cli.SameSiteDefault, "a=1"},
+		{"a=1", 0, "a=1"},
+	}
+	for _, tt := range tests {
+		res := &Response{Header: hdr.Header{hdr.SetCookieHeader: {tt.setCookie}}}
+		cookies := cli.RespCookies(res)
+		if len(cookies) != 1 {
+			t.Errorf("%q: got %d cookies; want 1", tt.setCookie, len(cookies))
+			continue
+		}
+		if got := cookies[0].SameSite; got != tt.want {
+			t.Errorf("%q: SameSite = %v; want %v", tt.setCookie, got, tt.want)
+		}
+		rec := th.NewRecorder()
+		cli.SetCookie(rec, cookies[0])
+		if got := rec.Header().Get(hdr.SetCookieHeader); got != tt.written {
+			t.Errorf("%q: SetCookie wrote %q; want %q", tt.setCookie, got, tt.written)
+		}
+	}
+	// SameSite=None is written even without Secure
+	rec := th.NewRecorder()
+	cli.SetCookie(rec, &cli.Cookie{Name: "b", Value: "2", SameSite: cli.SameSiteNone})
+	if got, want := rec.Header().Get(hdr.SetCookieHeader), "b=2; SameSite=None"; got != want {
+		t.Errorf("SetCookie wrote %q; want %q", got, want)
+	}
+}
+
+func TestJarExpiry(t *testing.T) {
+	jar, _ := cli.NewCookie(nil)
+	u, _ := url.Parse("http://www.example.com/")
+	jar.SetCookies(u, []*cli.Cookie{
+		{Name: "session", Value: "1"},
+		{Name: "short", Value: "2", Expires: time.Now().Add(100 * time.Millisecond)},
+		{Name: "long", Value: "3", MaxAge: 3600},
+		{Name: "past", Value: "4", Expires: time.Now().Add(-time.Hour)},
+		{Name: "gone", Value: "5", MaxAge: 3600},
+	})
+	// a negative Max-Age deletes the cookie
+	jar.SetCookies(u, []*cli.Cookie{{Name: "gone", Value: "", MaxAge: -1}})
+
+	names := func() string {
+		var got []string
+		for _, c := range jar.Cookies(u) {
+			got = append(got, c.Name)
+		}
+		return strings.Join(got, " ")
+	}
+	if got, want := names(), "session short long"; got != want {
+		t.Errorf("cookies = %q; want %q", got, want)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if got, want := names(), "session long"; got != want {
+		t.Errorf("after expiry, cookies = %q; want %q", got, want)
+	}
+}
+
+func TestClientOnCookie(t *testing.T) {
+	defer afterTest(t)
+	ts := th.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		pathSuffix := r.RequestURI[1:]
+		cli.SetCookie(w, &cli.Cookie{Name: "name" + pathSuffix, Value: "val" + pathSuffix})
+		if r.RequestURI == "/" {
+			Redirect(w, r, "http://thirdparty.fake/tracker", 302)
+		}
+	}))
+	defer ts.Close()
+	jar := new(RecordingJar)
+	c := ts.Client()
+	c.Jar = jar
+	c.OnCookie = func(u *url.URL, set []*cli.Cookie) {
+		jar.logf("OnCookie(%q, %v)\n", u, set)
+	}
+	c.Transport.(*Transport).DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return net.Dial("tcp", ts.Listener.Addr().String())
+	}
+	res, err := c.Get("http://firsthost.fake/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.CloseBody()
+	got := jar.log.String()
+	want := `Cookies("http://firsthost.fake/")
+SetCookie("http://firsthost.fake/", [name=val])
+OnCookie("http://firsthost.fake/", [name=val])
+Cookies("http://thirdparty.fake/tracker")
+SetCookie("http://thirdparty.fake/tracker", [nametracker=valtracker])
+OnCookie("http://thirdparty.fake/tracker", [nametracker=valtracker])
+`
+	if got != want {
+		t.Errorf("Got Jar and OnCookie calls:\n%s\nWant:\n%s", got, want)
+	}
+}
+
 func TestStreamingGet(t *testing.T) {
 	defer afterTest(t)
 	say := make(chan string)
@@ -658,6 +1260,88 @@ func TestStreamingGet(t *testing.T) {
 	}
 }
 
+func TestEventStreamWriter(t *testing.T) {
+	defer afterTest(t)
+	type event struct{ name, data string }
+	send := make(chan event)
+	cst := newClientServerTest(t, HandlerFunc(func(w ResponseWriter, r *Request) {
+		ew, err := NewEventStreamWriter(w)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if err := ew.SendComment("hello"); err != nil {
+			t.Error(err)
+		}
+		for e := range send {
+			if err := ew.Send(e.name, e.data); err != nil {
+				t.Error(err)
+			}
+		}
+	}))
+	defer cst.close()
+
+	res, err := cst.c.Get(cst.ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.CloseBody()
+	if got := res.Header.Get(hdr.ContentType); got != "text/event-stream" {
+		t.Errorf("Content-Type = %q; want text/event-stream", got)
+	}
+	if got := res.Header.Get(hdr.CacheControl); got != "no-cache" {
+		t.Errorf("Cache-Control = %q; want no-cache", got)
+	}
+	br := bufio.NewReader(res.Body)
+	readLines := func(n int) string {
+		var lines string
+		for i := 0; i < n; i++ {
+			line, err := br.ReadString('\n')
+			if err != nil {
+				t.Fatalf("reading event: %v", err)
+			}
+			lines += line
+		}
+		return lines
+	}
+	if got := readLines(1); got != ": hello\n" {
+		t.Errorf("comment = %q; want %q", got, ": hello\n")
+	}
+	tests := []struct {
+		event event
+		lines int
+		want  string
+	}{
+		{event{"", "one"}, 2, "data: one\n\n"},
+		{event{"update", "two"}, 3, "event: update\ndata: two\n\n"},
+		{event{"multi", "a\nb\r\nc"}, 5, "event: multi\ndata: a\ndata: b\ndata: c\n\n"},
+	}
+	for _, tt := range tests {
+		send <- tt.event
+		if got := readLines(tt.lines); got != tt.want {
+			t.Errorf("Send(%q, %q) wrote %q; want %q", tt.event.name, tt.event.data, got, tt.want)
+		}
+	}
+	close(send)
+	if _, err := br.ReadByte(); err != io.EOF {
+		t.Errorf("at end got %v; want EOF", err)
+	}
+}
+
+func TestEventStreamWriterNotFlusher(t *testing.T) {
+	w := struct{ ResponseWriter }{th.NewRecorder()}
+	if _, err := NewEventStreamWriter(w); err != ErrNotFlusher {
+		t.Errorf("NewEventStreamWriter = %v; want ErrNotFlusher", err)
+	}
+	ew, err := NewEventStreamWriter(th.NewRecorder())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ew.Send("a\nb", "data"); err == nil {
+		t.Error("Send with a multi-line event name succeeded")
+	}
+}
+
 // TestClientWrites verifies that client requests are buffered and we
 // don't send a TCP packet per line of the http request + body.
 func TestClientWrites(t *testing.T) {
@@ -818,6 +1502,49 @@ func TestTransportUsesTLSConfigServerName(t *testing.T) {
 	res.CloseBody()
 }
 
+// Request.Host overrides the Host header, but neither the dialed address
+// nor the TLS server name, which follow the URL.
+func TestTransportRequestHostOverride(t *testing.T) {
+	defer afterTest(t)
+	gotHost := make(chan string, 1)
+	gotServerName := make(chan string, 1)
+	ts := th.NewUnstartedServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		gotHost <- r.Host
+	}))
+	ts.TLS = &tls.Config{
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			gotServerName <- hello.ServerName
+			return nil, nil
+		},
+	}
+	ts.StartTLS()
+	defer ts.Close()
+
+	c := ts.Client()
+	tr := c.Transport.(*Transport)
+	dialed := make(chan string, 1)
+	tr.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialed <- addr
+		return net.Dial(network, ts.Listener.Addr().String())
+	}
+	req, _ := NewRequest(GET, "https://example.com/", nil)
+	req.Host = "override.example"
+	res, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.CloseBody()
+	if got := <-dialed; got != "example.com:443" {
+		t.Errorf("dialed %q; want %q", got, "example.com:443")
+	}
+	if got := <-gotServerName; got != "example.com" {
+		t.Errorf("TLS server name = %q; want %q", got, "example.com")
+	}
+	if got := <-gotHost; got != "override.example" {
+		t.Errorf("Host header = %q; want %q", got, "override.example")
+	}
+}
+
 func TestResponseSetsTLSConnectionState(t *testing.T) {
 	defer afterTest(t)
 	ts := th.NewTLSServer(HandlerFunc(func(w ResponseWriter, r *Request) {
@@ -1005,6 +1732,116 @@ func TestBasicAuthHeadersPreserved(t *testing.T) {
 
 }
 
+func TestRequireBasicAuth(t *testing.T) {
+	setParallel(t)
+	defer afterTest(t)
+	ts := th.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "gopher" || pass != "secret" {
+			RequireBasicAuth(w, `my "private" realm\`)
+			return
+		}
+		io.WriteString(w, "welcome")
+	}))
+	defer ts.Close()
+	c := ts.Client()
+
+	res, err := c.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != StatusUnauthorized {
+		t.Errorf("status = %d; want %d", res.StatusCode, StatusUnauthorized)
+	}
+	want := `Basic realm="my \"private\" realm\\"`
+	if got := res.Header.Get(hdr.WWWAuthenticate); got != want {
+		t.Errorf("%s = %q; want %q", hdr.WWWAuthenticate, got, want)
+	}
+
+	req, err := NewRequest(GET, ts.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.SetBasicAuth("gopher", "secret")
+	res, err = c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != StatusOK {
+		t.Errorf("authenticated status = %d; want %d", res.StatusCode, StatusOK)
+	}
+	if _, ok := res.Header[hdr.WWWAuthenticate]; ok {
+		t.Errorf("unexpected %s on an authenticated response", hdr.WWWAuthenticate)
+	}
+}
+func TestBearerAuth(t *testing.T) {
+	tests := []struct {
+		header string
+		token  string
+		ok     bool
+	}{
+		{"Bearer mF_9.B5f-4.1JqM", "mF_9.B5f-4.1JqM", true},
+		{"bearer mF_9.B5f-4.1JqM", "mF_9.B5f-4.1JqM", true},
+		{"BEARER   tok  ", "tok", true},
+		{"Bearer ", "", false},
+		{"Bearer    ", "", false},
+		{"Bearer", "", false},
+		{"Basic QWxhZGRpbjpvcGVuIHNlc2FtZQ==", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		req := &Request{Header: hdr.Header{}}
+		if tt.header != "" {
+			req.Header.Set(hdr.Authorization, tt.header)
+		}
+		token, ok := req.BearerAuth()
+		if token != tt.token || ok != tt.ok {
+			t.Errorf("BearerAuth() with %q = %q, %v; want %q, %v", tt.header, token, ok, tt.token, tt.ok)
+		}
+	}
+
+	req, err := NewRequest(GET, "http://dummy.faketld/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.SetBearerAuth("abc.def")
+	if got, want := req.Header.Get(hdr.Authorization), "Bearer abc.def"; got != want {
+		t.Errorf("Authorization = %q; want %q", got, want)
+	}
+	if token, ok := req.BearerAuth(); !ok || token != "abc.def" {
+		t.Errorf("BearerAuth() = %q, %v; want %q, true", token, ok, "abc.def")
+	}
+}
+
+// A Bearer token must not follow a redirect to another host.
+func TestBearerAuthNotCopiedOnRedirect(t *testing.T) {
+	setParallel(t)
+	defer afterTest(t)
+	ts1 := th.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		if token, ok := r.BearerAuth(); ok {
+			t.Errorf("redirected request carries bearer token %q", token)
+		}
+	}))
+	defer ts1.Close()
+	ts2 := th.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		if _, ok := r.BearerAuth(); !ok {
+			t.Error("initial request lacks bearer token")
+		}
+		Redirect(w, r, ts1.URL, StatusFound)
+	}))
+	defer ts2.Close()
+
+	// ts1 and ts2 only differ by port, which is enough to count as another host.
+	req, _ := NewRequest(GET, ts2.URL, nil)
+	req.SetBearerAuth("secret-token")
+	res, err := ts1.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.CloseBody()
+}
+
 func TestClientRedirectEatsBody(t *testing.T) {
 	setParallel(t)
 	defer afterTest(t)
@@ -1094,6 +1931,49 @@ func TestClientRedirectResponseWithoutRequest(t *testing.T) {
 }
 
 // Issue 4800: copy (some) headers when Client follows a redirect
+func TestRequestClone(t *testing.T) {
+	req, _ := NewRequest(POST, "http://foo.com/path?q=1", strings.NewReader("body"))
+	req.Header.Set("X-Foo", "foo")
+	req.Trailer = hdr.Header{"X-Trailer": {"t"}}
+	req.Form = url.Values{"a": {"1"}}
+
+	type ctxKey struct{}
+	ctx := context.WithValue(context.Background(), ctxKey{}, "v")
+	clone := req.Clone(ctx)
+	if clone.Context() != ctx {
+		t.Error("clone doesn't carry the new context")
+	}
+	if req.Context() == ctx {
+		t.Error("original request context changed")
+	}
+	if clone.Body != req.Body {
+		t.Error("clone doesn't share the body")
+	}
+
+	clone.Header.Set("X-Foo", "changed")
+	clone.Header.Add("X-Foo", "added")
+	clone.Header.Set("X-Bar", "bar")
+	clone.Trailer["X-Trailer"][0] = "changed"
+	clone.URL.Path = "/changed"
+	clone.Form["a"][0] = "changed"
+
+	if got := req.Header[hdr.CanonicalHeaderKey("X-Foo")]; !reflect.DeepEqual(got, []string{"foo"}) {
+		t.Errorf("original X-Foo = %q; want [foo]", got)
+	}
+	if req.Header.Get("X-Bar") != "" {
+		t.Error("original got the clone's X-Bar header")
+	}
+	if got := req.Trailer.Get("X-Trailer"); got != "t" {
+		t.Errorf("original trailer = %q; want t", got)
+	}
+	if req.URL.Path != "/path" {
+		t.Errorf("original URL path = %q; want /path", req.URL.Path)
+	}
+	if got := req.Form.Get("a"); got != "1" {
+		t.Errorf("original form value = %q; want 1", got)
+	}
+}
+
 func TestClientCopyHeadersOnRedirect(t *testing.T) {
 	const (
 		ua   = "some-agent/1.2"
@@ -6,6 +6,7 @@
 package tests
 
 import (
+	"bytes"
 	"compress/gzip"
 	"context"
 	"fmt"
@@ -17,6 +18,7 @@ import (
 	"reflect"
 	"runtime"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"testing"
@@ -441,6 +443,148 @@ func testTrailersServerToClient(t *testing.T, flush bool) {
 	}
 }
 
+// Tests that a server rejects a request trailer over its MaxTrailerBytes.
+func TestTrailersClientToServerTooLarge(t *testing.T) {
+	defer afterTest(t)
+	const max = 100
+	errc := make(chan error, 1)
+	cst := newClientServerTest(t, HandlerFunc(func(w ResponseWriter, r *Request) {
+		_, err := ioutil.ReadAll(r.Body)
+		errc <- err
+	}), func(ts *th.TestServer) {
+		ts.Server.MaxTrailerBytes = max
+	})
+	defer cst.close()
+
+	for _, size := range []int{max / 2, 2 * max} {
+		req, _ := NewRequest(POST, cst.ts.URL, strings.NewReader("foo"))
+		req.Trailer = hdr.Header{"Client-Trailer": {strings.Repeat("a", size)}}
+		req.ContentLength = -1
+		res, err := cst.c.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.CloseBody()
+		err = <-errc
+		if size < max && err != nil {
+			t.Errorf("%d byte trailer: server read error %v; want nil", size, err)
+		}
+		if size > max && err != ErrTrailerTooLarge {
+			t.Errorf("%d byte trailer: server read error %v; want %v", size, err, ErrTrailerTooLarge)
+		}
+	}
+}
+
+// Tests that a client rejects a response trailer over its Transport's MaxTrailerBytes.
+func TestTrailersServerToClientStrictTE(t *testing.T) {
+	defer afterTest(t)
+	cst := newClientServerTest(t, HandlerFunc(func(w ResponseWriter, r *Request) {
+		w.Header().Set(hdr.Trailer, "Server-Trailer-A")
+		io.WriteString(w, "body")
+		w.(Flusher).Flush()
+		w.Header().Set("Server-Trailer-A", "valuea")
+		w.Header().Set(TrailerPrefix+"Server-Trailer-B", "valueb")
+	}), func(ts *th.TestServer) {
+		ts.Server.StrictTE = true
+	})
+	defer cst.close()
+
+	tests := []struct {
+		te   string
+		want hdr.Header
+	}{
+		{"", nil},
+		{"deflate", nil},
+		{"trailers", hdr.Header{"Server-Trailer-A": {"valuea"}, "Server-Trailer-B": {"valueb"}}},
+		{"deflate;q=0.5, Trailers", hdr.Header{"Server-Trailer-A": {"valuea"}, "Server-Trailer-B": {"valueb"}}},
+	}
+	for _, tt := range tests {
+		req, _ := NewRequest(GET, cst.ts.URL, nil)
+		if tt.te != "" {
+			req.Header.Set(hdr.TEHeader, tt.te)
+		}
+		res, err := cst.c.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.want == nil {
+			if v, ok := res.Header[hdr.Trailer]; ok {
+				t.Errorf("TE %q: got %s header %q; want none", tt.te, hdr.Trailer, v)
+			}
+		}
+		if err := wantBody(res, nil, "body"); err != nil {
+			t.Fatalf("TE %q: %v", tt.te, err)
+		}
+		if len(res.Trailer) == 0 {
+			res.Trailer = nil
+		}
+		if !reflect.DeepEqual(res.Trailer, tt.want) {
+			t.Errorf("TE %q: Trailer = %v; want %v", tt.te, res.Trailer, tt.want)
+		}
+	}
+}
+
+func TestTrailersServerToClientTooLarge(t *testing.T) {
+	defer afterTest(t)
+	const max = 100
+	cst := newClientServerTest(t, HandlerFunc(func(w ResponseWriter, r *Request) {
+		size, _ := strconv.Atoi(r.FormValue("size"))
+		w.Header().Set(hdr.Trailer, "Server-Trailer")
+		io.WriteString(w, "body")
+		w.Header().Set("Server-Trailer", strings.Repeat("a", size))
+	}), func(tr *Transport) {
+		tr.MaxTrailerBytes = max
+	})
+	defer cst.close()
+
+	for _, size := range []int{max / 2, 2 * max} {
+		res, err := cst.c.Get(fmt.Sprintf("%s/?size=%d", cst.ts.URL, size))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = ioutil.ReadAll(res.Body)
+		res.CloseBody()
+		if size < max && err != nil {
+			t.Errorf("%d byte trailer: client read error %v; want nil", size, err)
+		}
+		if size > max && err != ErrTrailerTooLarge {
+			t.Errorf("%d byte trailer: client read error %v; want %v", size, err, ErrTrailerTooLarge)
+		}
+	}
+}
+
+func TestResponseTypedTrailers(t *testing.T) {
+	defer afterTest(t)
+	modTime := time.Date(2018, time.March, 4, 5, 6, 7, 0, time.UTC)
+	cst := newClientServerTest(t, HandlerFunc(func(w ResponseWriter, r *Request) {
+		w.Header().Set(hdr.Trailer, "Grpc-Status, X-Modified")
+		io.WriteString(w, "body")
+		w.Header().Set("Grpc-Status", "14")
+		w.Header().Set("X-Modified", modTime.Format(hdr.TimeFormat))
+	}))
+	defer cst.close()
+
+	res, err := cst.c.Get(cst.ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := res.TrailerInt("Grpc-Status"); err != ErrNoTrailer {
+		t.Errorf("TrailerInt before body read: err = %v; want ErrNoTrailer", err)
+	}
+	if err := wantBody(res, nil, "body"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := res.TrailerInt("Grpc-Status"); err != nil || got != 14 {
+		t.Errorf("TrailerInt = %d, %v; want 14, nil", got, err)
+	}
+	if got, err := res.TrailerTime("X-Modified"); err != nil || !got.Equal(modTime) {
+		t.Errorf("TrailerTime = %v, %v; want %v, nil", got, err, modTime)
+	}
+	if _, err := res.TrailerInt("X-Missing"); err != ErrNoTrailer {
+		t.Errorf("TrailerInt of missing trailer: err = %v; want ErrNoTrailer", err)
+	}
+}
+
 // Don't allow a Body.Read after Body.Close. Issue 13648.
 func TestResponseBodyReadAfterClose(t *testing.T) {
 	defer afterTest(t)
@@ -908,6 +1052,45 @@ func TestAutoGzipWithDumpResponse(t *testing.T) {
 	}.run(t)
 }
 
+func TestDumpResponseTo(t *testing.T) {
+	setParallel(t)
+	defer afterTest(t)
+	const size = 10 << 20
+	content := bytes.Repeat([]byte("0123456789abcdef"), size/16)
+	cst := newClientServerTest(t, HandlerFunc(func(w ResponseWriter, r *Request) {
+		w.Header().Set(hdr.ContentLength, strconv.Itoa(size))
+		w.Write(content)
+	}))
+	defer cst.close()
+
+	res, err := cst.c.Get(cst.ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dump bytes.Buffer
+	if err := util.DumpResponseTo(&dump, res, true); err != nil {
+		t.Fatal(err)
+	}
+	i := bytes.Index(dump.Bytes(), []byte("\r\n\r\n"))
+	if i < 0 || !bytes.HasPrefix(dump.Bytes(), []byte("HTTP/1.1 200 OK\r\n")) {
+		t.Fatalf("unexpected dump header: %q", dump.Bytes()[:64])
+	}
+	if !bytes.Equal(dump.Bytes()[i+4:], content) {
+		t.Errorf("dumped body of %d bytes; want %d", dump.Len()-i-4, size)
+	}
+
+	restored, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(restored, content) {
+		t.Errorf("restored body of %d bytes; want %d", len(restored), size)
+	}
+	if err := res.Body.Close(); err != nil {
+		t.Errorf("Close = %v", err)
+	}
+}
+
 // Issue 14607
 func TestCloseIdleConnections(t *testing.T) {
 	setParallel(t)
@@ -991,6 +1174,58 @@ func TestServerUndeclaredTrailers(t *testing.T) {
 	}
 }
 
+func TestServerSetTrailer(t *testing.T) {
+	defer afterTest(t)
+	now := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	wire := func(h HandlerFunc) string {
+		ts := th.NewUnstartedServer(h)
+		ts.Server.NowFunc = func() time.Time { return now }
+		ts.Start()
+		defer ts.Close()
+		cn, err := net.Dial("tcp", ts.Listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer cn.Close()
+		io.WriteString(cn, "GET / HTTP/1.1\r\nHost: foo.com\r\nConnection: close\r\n\r\n")
+		all, err := ioutil.ReadAll(cn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(all)
+	}
+
+	prefixed := wire(func(w ResponseWriter, r *Request) {
+		w.Header().Set(hdr.Trailer, "Declared")
+		io.WriteString(w, "body")
+		w.(Flusher).Flush()
+		w.Header().Set("Declared", "d")
+		w.Header().Set(TrailerPrefix+"Foo", "Baz")
+		w.Header().Set(TrailerPrefix+"Bar", "Quux")
+	})
+	setTrailer := wire(func(w ResponseWriter, r *Request) {
+		w.Header().Set(hdr.Trailer, "Declared")
+		io.WriteString(w, "body")
+		w.(Flusher).Flush()
+		w.Header().Set("Declared", "d")
+		tw, ok := w.(TrailerWriter)
+		if !ok {
+			t.Error("ResponseWriter doesn't implement TrailerWriter")
+			return
+		}
+		tw.SetTrailer("foo", "Baz")
+		tw.SetTrailer("Bar", "Quux")
+	})
+	if prefixed != setTrailer {
+		t.Errorf("wire output differs\nprefix:\n%q\nSetTrailer:\n%q", prefixed, setTrailer)
+	}
+	for _, want := range []string{"\r\nDeclared: d\r\n", "\r\nFoo: Baz\r\n", "\r\nBar: Quux\r\n"} {
+		if !strings.Contains(setTrailer, want) {
+			t.Errorf("response lacks trailer %q:\n%s", want, setTrailer)
+		}
+	}
+}
+
 func TestBadResponseAfterReadingBody(t *testing.T) {
 	defer afterTest(t)
 	cst := newClientServerTest(t, HandlerFunc(func(w ResponseWriter, r *Request) {
@@ -940,6 +940,69 @@ func TestServerFileStatError(t *testing.T) {
 	}
 }
 
+func TestServeContentRange(t *testing.T) {
+	content := strings.Repeat("0123456789", 20)
+	tests := []struct {
+		rangeHeader      string
+		wantStatus       int
+		wantContentRange string
+		wantBody         string   // for a single range
+		wantParts        []string // for several ranges
+	}{
+		{"", StatusOK, "", content, nil},
+		{"bytes=0-9", StatusPartialContent, "bytes 0-9/200", content[:10], nil},
+		{"bytes=100-", StatusPartialContent, "bytes 100-199/200", content[100:], nil},
+		{"bytes=-5", StatusPartialContent, "bytes 195-199/200", content[195:], nil},
+		{"bytes=0-1,5-6", StatusPartialContent, "", "", []string{content[0:2], content[5:7]}},
+		{"bytes=300-", StatusRequestedRangeNotSatisfiable, "bytes */200", "", nil},
+	}
+	for _, tt := range tests {
+		req, _ := NewRequest(GET, "/", nil)
+		if tt.rangeHeader != "" {
+			req.Header.Set("Range", tt.rangeHeader)
+		}
+		rec := th.NewRecorder()
+		filetransport.ServeContentRange(rec, req, time.Time{}, strings.NewReader(content))
+		if rec.Code != tt.wantStatus {
+			t.Errorf("Range %q: status = %d; want %d", tt.rangeHeader, rec.Code, tt.wantStatus)
+			continue
+		}
+		if got := rec.Header().Get(hdr.ContentRange); got != tt.wantContentRange {
+			t.Errorf("Range %q: Content-Range = %q; want %q", tt.rangeHeader, got, tt.wantContentRange)
+		}
+		if tt.wantStatus == StatusPartialContent {
+			if got := rec.Header().Get(hdr.AcceptRanges); got != "bytes" {
+				t.Errorf("Range %q: Accept-Ranges = %q; want bytes", tt.rangeHeader, got)
+			}
+		}
+		if tt.wantParts == nil {
+			if tt.wantStatus != StatusRequestedRangeNotSatisfiable && rec.Body.String() != tt.wantBody {
+				t.Errorf("Range %q: body = %q; want %q", tt.rangeHeader, rec.Body.String(), tt.wantBody)
+			}
+			continue
+		}
+		typ, params, err := mime.MIMEParseMediaType(rec.Header().Get(hdr.ContentType))
+		if err != nil || typ != "multipart/byteranges" {
+			t.Errorf("Range %q: content type = %q, %v; want multipart/byteranges", tt.rangeHeader, typ, err)
+			continue
+		}
+		mr := mime.NewMultipartReader(rec.Body, params["boundary"])
+		for i, want := range tt.wantParts {
+			part, err := mr.NextPart()
+			if err != nil {
+				t.Fatalf("Range %q: part %d: %v", tt.rangeHeader, i, err)
+			}
+			got, _ := ioutil.ReadAll(part)
+			if string(got) != want {
+				t.Errorf("Range %q: part %d = %q; want %q", tt.rangeHeader, i, got, want)
+			}
+		}
+		if _, err := mr.NextPart(); err != io.EOF {
+			t.Errorf("Range %q: after the parts got %v; want io.EOF", tt.rangeHeader, err)
+		}
+	}
+}
+
 func TestServeContentErrorMessages(t *testing.T) {
 	defer afterTest(t)
 	fs := fakeFS{
@@ -7,6 +7,7 @@ package tests
 
 import (
 	"bytes"
+	"reflect"
 	"runtime"
 	"testing"
 	"time"
@@ -105,6 +106,113 @@ func TestHeaderWrite(t *testing.T) {
 	}
 }
 
+func TestHeaderCanonicalBytes(t *testing.T) {
+	h := hdr.Header{
+		hdr.ContentType: {"text/plain"},
+		hdr.Date:        {"Mon, 02 Jan 2006 15:04:05 GMT"},
+		"X-Multi":       {" b ", "a", "multi\nline"},
+		"X-Empty":       {""},
+		"X-Unsigned":    {"not signed"},
+	}
+	tests := []struct {
+		keys []string
+		want string
+	}{
+		{nil, ""},
+		{[]string{"x-missing"}, ""},
+		{[]string{"date", "content-type"}, "Content-Type: text/plain\r\nDate: Mon, 02 Jan 2006 15:04:05 GMT\r\n"},
+		{[]string{"Content-Type", "CONTENT-TYPE", "content-type"}, "Content-Type: text/plain\r\n"},
+		{[]string{"x-multi"}, "X-Multi: b, a, multi line\r\n"},
+		{[]string{"x-empty", "x-missing"}, "X-Empty: \r\n"},
+	}
+	for _, tt := range tests {
+		if got := string(h.CanonicalBytes(tt.keys)); got != tt.want {
+			t.Errorf("CanonicalBytes(%q) = %q; want %q", tt.keys, got, tt.want)
+		}
+	}
+
+	// The output doesn't depend on the map iteration order nor on the
+	// order of the keys.
+	keys := []string{"x-multi", "date", "content-type", "x-empty"}
+	want := h.CanonicalBytes(keys)
+	for i := 0; i < 20; i++ {
+		keys[0], keys[i%len(keys)] = keys[i%len(keys)], keys[0]
+		if got := h.Clone().CanonicalBytes(keys); !bytes.Equal(got, want) {
+			t.Fatalf("run %d: CanonicalBytes(%q) = %q; want %q", i, keys, got, want)
+		}
+	}
+}
+
+func TestHeaderValues(t *testing.T) {
+	h := hdr.Header{
+		"Www-Authenticate": {"Basic", "Bearer"},
+		"WWW-Authenticate": {"Digest"},
+		hdr.ContentType:    {"text/plain"},
+	}
+	tests := []struct {
+		key       string
+		values    []string
+		rawValues []string
+	}{
+		{"www-authenticate", []string{"Basic", "Bearer"}, nil},
+		{"Www-Authenticate", []string{"Basic", "Bearer"}, []string{"Basic", "Bearer"}},
+		{"WWW-Authenticate", []string{"Basic", "Bearer"}, []string{"Digest"}},
+		{"content-type", []string{"text/plain"}, nil},
+		{"X-Missing", nil, nil},
+	}
+	for _, tt := range tests {
+		if got := h.Values(tt.key); !reflect.DeepEqual(got, tt.values) {
+			t.Errorf("Values(%q) = %q; want %q", tt.key, got, tt.values)
+		}
+		if got := h.GetRaw(tt.key); !reflect.DeepEqual(got, tt.rawValues) {
+			t.Errorf("GetRaw(%q) = %q; want %q", tt.key, got, tt.rawValues)
+		}
+	}
+
+	var nilHeader hdr.Header
+	if got := nilHeader.Values(hdr.ContentType); got != nil {
+		t.Errorf("Values on a nil Header = %q; want nil", got)
+	}
+	if got := nilHeader.GetRaw(hdr.ContentType); got != nil {
+		t.Errorf("GetRaw on a nil Header = %q; want nil", got)
+	}
+}
+
+func TestHeaderWriteSorted(t *testing.T) {
+	h := hdr.Header{
+		hdr.ContentType: {"text/plain"},
+		hdr.Date:        {"Mon, 02 Jan 2006 15:04:05 GMT"},
+		"X-Multi":       {"a", "b"},
+		"X-Zeta":        {"z"},
+		"Accept":        {"*/*"},
+	}
+	tests := []struct {
+		order []string
+		want  string
+	}{
+		{nil, "Accept: */*\r\nContent-Type: text/plain\r\nDate: Mon, 02 Jan 2006 15:04:05 GMT\r\nX-Multi: a\r\nX-Multi: b\r\nX-Zeta: z\r\n"},
+		{[]string{"x-zeta", "date"}, "X-Zeta: z\r\nDate: Mon, 02 Jan 2006 15:04:05 GMT\r\nAccept: */*\r\nContent-Type: text/plain\r\nX-Multi: a\r\nX-Multi: b\r\n"},
+		{[]string{"X-Multi", "x-missing", "x-multi", "Content-Type", "X-Zeta", "Date", "Accept"}, "X-Multi: a\r\nX-Multi: b\r\nContent-Type: text/plain\r\nX-Zeta: z\r\nDate: Mon, 02 Jan 2006 15:04:05 GMT\r\nAccept: */*\r\n"},
+	}
+	var buf bytes.Buffer
+	for _, tt := range tests {
+		buf.Reset()
+		if err := h.WriteSorted(&buf, tt.order); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != tt.want {
+			t.Errorf("WriteSorted(%q):\n got: %q\nwant: %q", tt.order, buf.String(), tt.want)
+		}
+	}
+
+	// Write is unchanged.
+	buf.Reset()
+	h.Write(&buf)
+	if buf.String() != tests[0].want {
+		t.Errorf("Write:\n got: %q\nwant: %q", buf.String(), tests[0].want)
+	}
+}
+
 func TestParseTime(t *testing.T) {
 	var parseTimeTests = []struct {
 		h   hdr.Header
@@ -137,6 +245,50 @@ func TestParseTime(t *testing.T) {
 	}
 }
 
+func TestParseAltSvc(t *testing.T) {
+	tests := []struct {
+		values []string
+		want   []hdr.AltSvc
+	}{
+		{
+			values: []string{`h3=":443"; ma=3600; persist=1, h2="alt.example.com:8443", h3-29="[::1]:443"; ma=60`},
+			want: []hdr.AltSvc{
+				{Protocol: "h3", Port: "443", MaxAge: time.Hour, Persist: true, Params: map[string]string{"ma": "3600", "persist": "1"}},
+				{Protocol: "h2", Host: "alt.example.com", Port: "8443", MaxAge: 24 * time.Hour},
+				{Protocol: "h3-29", Host: "::1", Port: "443", MaxAge: time.Minute, Params: map[string]string{"ma": "60"}},
+			},
+		},
+		{
+			// Quoted parameters with escapes and separators inside quotes.
+			values: []string{`w%3D%3Dx="alt:80"; note="a \"b\"; c,d"; MA="120"`},
+			want: []hdr.AltSvc{
+				{Protocol: "w==x", Host: "alt", Port: "80", MaxAge: 2 * time.Minute, Params: map[string]string{"note": `a "b"; c,d`, "ma": "120"}},
+			},
+		},
+		{
+			// Malformed alternatives are skipped, valid ones kept.
+			values: []string{`h2=noport, h2="alt:81" junk, h2="alt:82"; ma=bad`, "h2=\"unterminated"},
+			want: []hdr.AltSvc{
+				{Protocol: "h2", Host: "alt", Port: "82", MaxAge: 24 * time.Hour},
+			},
+		},
+		{
+			values: []string{" clear "},
+			want:   []hdr.AltSvc{{Clear: true}},
+		},
+		{
+			values: nil,
+			want:   nil,
+		},
+	}
+	for i, tt := range tests {
+		h := hdr.Header{hdr.AltSvcHeader: tt.values}
+		if got := hdr.ParseAltSvc(h); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("#%d: ParseAltSvc(%q) =\n%+v\nwant\n%+v", i, tt.values, got, tt.want)
+		}
+	}
+}
+
 func TestHasToken(t *testing.T) {
 
 	type hasTokenTest struct {
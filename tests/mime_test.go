@@ -93,6 +93,42 @@ func TestWriter(t *testing.T) {
 	}
 }
 
+func TestWriterCreateFormFileWithContentType(t *testing.T) {
+	var b bytes.Buffer
+	w := mime.NewMultipartWriter(&b)
+	part, err := w.CreateFormFileWithContentType(`my"image`, `a "quoted" name.png`, "image/png")
+	if err != nil {
+		t.Fatalf("CreateFormFileWithContentType: %v", err)
+	}
+	part.Write([]byte("\x89PNG"))
+	if _, err := w.CreateFormFile("other", "other.bin"); err != nil {
+		t.Fatalf("CreateFormFile: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	r := mime.NewMultipartReader(&b, w.Boundary())
+	tests := []struct {
+		name, filename, contentType string
+	}{
+		{`my"image`, `a "quoted" name.png`, "image/png"},
+		{"other", "other.bin", "application/octet-stream"},
+	}
+	for i, tt := range tests {
+		p, err := r.NextPart()
+		if err != nil {
+			t.Fatalf("part %d: %v", i+1, err)
+		}
+		if p.FormName() != tt.name || p.FileName() != tt.filename {
+			t.Errorf("part %d: name, filename = %q, %q; want %q, %q", i+1, p.FormName(), p.FileName(), tt.name, tt.filename)
+		}
+		if got := p.Header.Get(hdr.ContentType); got != tt.contentType {
+			t.Errorf("part %d: %s = %q; want %q", i+1, hdr.ContentType, got, tt.contentType)
+		}
+	}
+}
+
 func TestWriterSetBoundary(t *testing.T) {
 	tests := []struct {
 		b  string
@@ -598,6 +634,67 @@ func TestQuotedPrintableEncoding(t *testing.T) {
 	}
 }
 
+func TestAutoDecodeTransferEncoding(t *testing.T) {
+	body := strings.Replace(`--b
+Content-Disposition: form-data; name=b64
+Content-Transfer-Encoding: base64
+
+aGVsbG8s
+IHdvcmxk
+--b
+Content-Disposition: form-data; name=qp
+Content-Transfer-Encoding: Quoted-Printable
+
+caf=C3=A9
+--b
+Content-Disposition: form-data; name=raw
+Content-Transfer-Encoding: 8bit
+
+as is
+--b
+Content-Disposition: form-data; name=odd
+Content-Transfer-Encoding: x-uuencode
+
+begin
+--b
+Content-Disposition: form-data; name=last
+
+end
+--b--`, "\n", "\r\n", -1)
+
+	tests := []struct {
+		auto bool
+		want []string // bodies, or "error" if Read fails
+	}{
+		{false, []string{"aGVsbG8s\r\nIHdvcmxk", "caf=C3=A9", "as is", "begin", "end"}},
+		{true, []string{"hello, world", "caf\u00e9", "as is", "error", "end"}},
+	}
+	for _, tt := range tests {
+		r := mime.NewMultipartReader(strings.NewReader(body), "b")
+		r.AutoDecodeTransferEncoding = tt.auto
+		for i, want := range tt.want {
+			part, err := r.NextPart()
+			if err != nil {
+				t.Fatalf("auto=%v, part %d: %v", tt.auto, i, err)
+			}
+			b, err := ioutil.ReadAll(part)
+			got := string(b)
+			if err != nil {
+				got = "error"
+			}
+			if got != want {
+				t.Errorf("auto=%v, part %q = %q; want %q", tt.auto, part.FormName(), got, want)
+			}
+			if _, ok := part.Header[hdr.ContentTransferEncoding]; tt.auto && ok && (i == 0 || i == 1) {
+				t.Errorf("auto=%v, part %q: decoded part kept its %s header", tt.auto, part.FormName(), hdr.ContentTransferEncoding)
+			}
+		}
+		if _, err := r.NextPart(); err != io.EOF {
+			t.Errorf("auto=%v: NextPart at the end = %v; want io.EOF", tt.auto, err)
+		}
+	}
+}
+
 // Test parsing an image attachment from gmail, which previously failed.
 func TestNested(t *testing.T) {
 	// nested-mime is the body part of a multipart/mixed email
@@ -1064,6 +1161,50 @@ func TestReadForm(t *testing.T) {
 	fd.Close()
 }
 
+func TestReadFormTotalBytes(t *testing.T) {
+	b := strings.NewReader(strings.Replace(message, "\n", "\r\n", -1))
+	r := mime.NewMultipartReader(b, boundary)
+	// fileb is larger than maxMemory, so it is spilled to disk
+	f, err := r.ReadForm(25)
+	if err != nil {
+		t.Fatal("ReadForm:", err)
+	}
+	defer f.RemoveAll()
+	want := int64(len(textaValue) + len(textbValue) + len(fileaContents) + len(filebContents))
+	if got := f.TotalBytes(); got != want {
+		t.Errorf("TotalBytes = %d; want %d", got, want)
+	}
+}
+
+func TestPartBytesRead(t *testing.T) {
+	b := strings.NewReader(strings.Replace(message, "\n", "\r\n", -1))
+	r := mime.NewMultipartReader(b, boundary)
+	part, err := r.NextPart()
+	if err != nil {
+		t.Fatalf("NextPart: %v", err)
+	}
+	if n := part.BytesRead(); n != 0 {
+		t.Errorf("BytesRead before reading = %d; want 0", n)
+	}
+	buf := make([]byte, 7)
+	if _, err := io.ReadFull(part, buf); err != nil {
+		t.Fatalf("ReadFull: %v", err)
+	}
+	if n := part.BytesRead(); n != 7 {
+		t.Errorf("BytesRead after partial read = %d; want 7", n)
+	}
+	rest, err := ioutil.ReadAll(part)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if g, e := part.BytesRead(), int64(len(fileaContents)); g != e {
+		t.Errorf("BytesRead after full read = %d; want %d", g, e)
+	}
+	if g := string(buf) + string(rest); g != fileaContents {
+		t.Errorf("contents = %q; want %q", g, fileaContents)
+	}
+}
+
 /**
 func TestReadFormWithNamelessFile(t *testing.T) {
 	b := strings.NewReader(strings.Replace(messageWithFileWithoutName, "\n", "\r\n", -1))
@@ -1222,3 +1363,103 @@ Content-Disposition: form-data; name="largetext"
 		})
 	}
 }
+
+func TestReadFormCapped(t *testing.T) {
+	var buf bytes.Buffer
+	w := mime.NewMultipartWriter(&buf)
+	for i := 0; i < 3; i++ {
+		fw, err := w.CreateFormFile("file", fmt.Sprintf("f%d.txt", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write([]byte("0123456789"))
+	}
+	w.Close()
+
+	tmp, err := ioutil.TempDir("", "readformcapped")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	defer os.Setenv("TMPDIR", os.Getenv("TMPDIR"))
+	os.Setenv("TMPDIR", tmp)
+
+	testCases := []struct {
+		name     string
+		maxFiles int64
+		err      error
+	}{
+		{"under", 31, nil},
+		{"exact-fit", 30, nil},
+		{"over", 29, mime.ErrFilesTooLarge},
+		{"small-cap", 5, mime.ErrFilesTooLarge},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := mime.NewMultipartReader(bytes.NewReader(buf.Bytes()), w.Boundary())
+			// no memory, so that every file part goes to a temporary file
+			f, err := r.ReadFormCapped(0, tc.maxFiles)
+			if err != tc.err {
+				t.Fatalf("ReadFormCapped error = %v; want %v", err, tc.err)
+			}
+			if err == nil {
+				if len(f.File["file"]) != 3 {
+					t.Errorf("got %d files; want 3", len(f.File["file"]))
+				}
+				f.RemoveAll()
+			}
+			left, err := ioutil.ReadDir(tmp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(left) != 0 {
+				t.Errorf("%d temporary files left behind", len(left))
+			}
+		})
+	}
+}
+
+func TestNextPartLimited(t *testing.T) {
+	var buf bytes.Buffer
+	w := mime.NewMultipartWriter(&buf)
+	fw, err := w.CreateFormFile("big", "big.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(bytes.Repeat([]byte("x"), 100))
+	w.WriteField("small", "hello")
+	w.Close()
+
+	r := mime.NewMultipartReader(&buf, w.Boundary())
+	p, err := r.NextPartLimited(40)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(p)
+	if err != mime.ErrPartTooLarge {
+		t.Fatalf("reading the big part: err = %v; want %v", err, mime.ErrPartTooLarge)
+	}
+	if len(got) != 40 {
+		t.Errorf("read %d bytes before the error; want 40", len(got))
+	}
+	if _, err := p.Read(make([]byte, 10)); err != mime.ErrPartTooLarge {
+		t.Errorf("Read after the limit: err = %v; want %v", err, mime.ErrPartTooLarge)
+	}
+
+	// The rest of the message is still readable, and a part within its
+	// limit reads to the end.
+	p, err = r.NextPartLimited(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.FormName() != "small" {
+		t.Fatalf("next part = %q; want %q", p.FormName(), "small")
+	}
+	got, err = ioutil.ReadAll(p)
+	if err != nil || string(got) != "hello" {
+		t.Errorf("small part = %q, %v; want %q, nil", got, err, "hello")
+	}
+	if _, err := r.NextPart(); err != io.EOF {
+		t.Errorf("NextPart at the end = %v; want io.EOF", err)
+	}
+}
@@ -77,6 +77,7 @@ func TestNextProtoUpgrade(t *testing.T) {
 	// Normal request, without NPN.
 	{
 		c := ts.Client()
+		c.Transport.(*Transport).TLSNextProtos = []string{}
 		res, err := c.Get(ts.URL)
 		if err != nil {
 			t.Fatal(err)
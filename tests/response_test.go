@@ -14,6 +14,7 @@ import (
 	"go/ast"
 	"io"
 	"io/ioutil"
+	"os"
 	"reflect"
 	"regexp"
 	"strings"
@@ -124,6 +125,57 @@ var respTests = []respTest{
 		"Body here\n",
 	},
 
+	// HTTP/1.0 response opting into keep-alive, with Content-Length.
+	{
+		"HTTP/1.0 200 OK\r\n" +
+			"Content-Length: 10\r\n" +
+			"Connection: keep-alive\r\n" +
+			"\r\n" +
+			"Body here\n",
+
+		Response{
+			Status:     "200 OK",
+			StatusCode: 200,
+			Proto:      "HTTP/1.0",
+			ProtoMajor: 1,
+			ProtoMinor: 0,
+			Request:    dummyReq(GET),
+			Header: hdr.Header{
+				hdr.Connection:    {DoKeepAlive},
+				hdr.ContentLength: {"10"},
+			},
+			Close:         false,
+			ContentLength: 10,
+		},
+
+		"Body here\n",
+	},
+
+	// HTTP/1.0 keep-alive response without Content-Length: the body
+	// ends with the connection, so it can't be kept alive.
+	{
+		"HTTP/1.0 200 OK\r\n" +
+			"Connection: keep-alive\r\n" +
+			"\r\n" +
+			"Body here\n",
+
+		Response{
+			Status:     "200 OK",
+			StatusCode: 200,
+			Proto:      "HTTP/1.0",
+			ProtoMajor: 1,
+			ProtoMinor: 0,
+			Request:    dummyReq(GET),
+			Header: hdr.Header{
+				hdr.Connection: {DoKeepAlive},
+			},
+			Close:         true,
+			ContentLength: -1,
+		},
+
+		"Body here\n",
+	},
+
 	// Chunked response without Content-Length.
 	{
 		"HTTP/1.1 200 OK\r\n" +
@@ -617,6 +669,30 @@ func TestWriteResponse(t *testing.T) {
 	}
 }
 
+func TestReadChunkedWithTrailer(t *testing.T) {
+	const raw = "5\r\nhello\r\n7\r\n, world\r\n0\r\nX-Checksum: abc\r\nX-Count: 2\r\n\r\nNext Request Here"
+	br := bufio.NewReader(strings.NewReader(raw))
+	body, trailer := ReadChunkedWithTrailer(br)
+	if got := trailer(); got != nil {
+		t.Errorf("trailer before EOF = %v; want nil", got)
+	}
+	slurp, err := ioutil.ReadAll(body)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if got, want := string(slurp), "hello, world"; got != want {
+		t.Errorf("body = %q; want %q", got, want)
+	}
+	want := hdr.Header{"X-Checksum": {"abc"}, "X-Count": {"2"}}
+	if got := trailer(); !reflect.DeepEqual(got, want) {
+		t.Errorf("trailer = %v; want %v", got, want)
+	}
+	rest, _ := ioutil.ReadAll(br)
+	if got, want := string(rest), "Next Request Here"; got != want {
+		t.Errorf("remaining = %q; want %q", got, want)
+	}
+}
+
 // TestReadResponseCloseInMiddle tests that closing a body after
 // reading only part of its contents advances the read to the end of
 // the request, right up until the next request.
@@ -964,6 +1040,47 @@ func TestResponseWritesOnlySingleConnectionClose(t *testing.T) {
 		t.Errorf("Found %d %q header", count, connectionCloseHeader)
 	}
 }
+func TestResponseBufferToDisk(t *testing.T) {
+	body := strings.Repeat("0123456789", 100)
+	for _, memLimit := range []int64{int64(len(body)), 64} {
+		res := &Response{Body: ioutil.NopCloser(strings.NewReader(body))}
+		rs, cleanup, err := res.BufferToDisk(memLimit)
+		if err != nil {
+			t.Fatalf("memLimit %d: BufferToDisk: %v", memLimit, err)
+		}
+		f, spilled := rs.(*os.File)
+		if want := memLimit < int64(len(body)); spilled != want {
+			t.Errorf("memLimit %d: spilled to disk = %v; want %v", memLimit, spilled, want)
+		}
+
+		if _, err := rs.Seek(500, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadAll(rs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != body[500:] {
+			t.Errorf("memLimit %d: read %q after seek; want %q", memLimit, got, body[500:])
+		}
+		if _, err := rs.Seek(0, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := ioutil.ReadAll(rs); string(got) != body {
+			t.Errorf("memLimit %d: read %d bytes after rewinding; want %d", memLimit, len(got), len(body))
+		}
+
+		if err := cleanup(); err != nil {
+			t.Errorf("memLimit %d: cleanup: %v", memLimit, err)
+		}
+		if spilled {
+			if _, err := os.Stat(f.Name()); !os.IsNotExist(err) {
+				t.Errorf("temp file %s not removed by cleanup: %v", f.Name(), err)
+			}
+		}
+	}
+}
+
 func TestResponseWrite(t *testing.T) {
 
 	type respWriteTest struct {
@@ -1244,6 +1361,54 @@ func TestResponseWrite(t *testing.T) {
 	}
 }
 
+func TestResponseWriteHeaderOnly(t *testing.T) {
+	tests := []struct {
+		name string
+		resp func() *Response
+	}{
+		{"content_length", func() *Response {
+			return &Response{StatusCode: 200, ProtoMajor: 1, ProtoMinor: 1, Request: dummyReq(GET),
+				Header: hdr.Header{"Foo": {"Bar"}}, Body: ioutil.NopCloser(strings.NewReader("abcdef")), ContentLength: 6}
+		}},
+		{"unknown_length", func() *Response {
+			return &Response{StatusCode: 200, ProtoMajor: 1, ProtoMinor: 1, Request: dummyReq(GET),
+				Header: hdr.Header{}, Body: ioutil.NopCloser(strings.NewReader("abcdef")), ContentLength: 0}
+		}},
+		{"chunked", func() *Response {
+			return &Response{StatusCode: 200, ProtoMajor: 1, ProtoMinor: 1, Request: dummyReq(GET),
+				Header: hdr.Header{}, Body: ioutil.NopCloser(strings.NewReader("abcdef")), ContentLength: -1,
+				TransferEncoding: []string{DoChunked}}
+		}},
+		{"empty", func() *Response {
+			return &Response{StatusCode: 200, ProtoMajor: 1, ProtoMinor: 1, Request: dummyReq(GET),
+				Header: hdr.Header{}, Body: nil}
+		}},
+		{"head", func() *Response {
+			return &Response{StatusCode: 200, ProtoMajor: 1, ProtoMinor: 1, Request: dummyReq(HEAD),
+				Header: hdr.Header{}, Body: ioutil.NopCloser(strings.NewReader("abcdef")), ContentLength: 6}
+		}},
+	}
+	for _, tt := range tests {
+		var full, head bytes.Buffer
+		if err := tt.resp().Write(&full); err != nil {
+			t.Fatalf("%s: Write: %v", tt.name, err)
+		}
+		res := tt.resp()
+		if err := res.WriteHeaderOnly(&head); err != nil {
+			t.Fatalf("%s: WriteHeaderOnly: %v", tt.name, err)
+		}
+		if !strings.HasSuffix(head.String(), "\r\n\r\n") || !strings.HasPrefix(full.String(), head.String()) {
+			t.Errorf("%s: header block\n%q\nis not a prefix of\n%q", tt.name, head.String(), full.String())
+		}
+		// The body is left for the caller.
+		if res.Body != nil {
+			if body, err := ioutil.ReadAll(res.Body); err != nil || string(body) != "abcdef" {
+				t.Errorf("%s: body after WriteHeaderOnly = %q, %v; want \"abcdef\"", tt.name, body, err)
+			}
+		}
+	}
+}
+
 func TestReadRequest(t *testing.T) {
 	var (
 		noError              = ""
@@ -1622,6 +1787,7 @@ func TestReadRequest(t *testing.T) {
 		}
 		rbody := req.Body
 		req.Body = nil
+		req.RawHeaders = nil // see TestReadRequestRawHeaders
 		testName := fmt.Sprintf("Test %d (%q)", i, tt.Raw)
 		diff(t, testName, req, tt.Req)
 		var bout bytes.Buffer
@@ -1642,6 +1808,101 @@ func TestReadRequest(t *testing.T) {
 	}
 }
 
+func TestReadRequestRawHeaders(t *testing.T) {
+	raw := "GET / HTTP/1.1\r\n" +
+		"Host: example.com\r\n" +
+		"x-lower: 1\r\n" +
+		"X-UPPER: 2\r\n" +
+		"Cookie: a=1\r\n" +
+		"x-lower: 3\r\n" +
+		"X-Folded: one\r\n two\r\n" +
+		"X-Trailing-Space : 4\r\n" +
+		"\r\n"
+	req, err := ReadRequest(bufio.NewReader(strings.NewReader(raw)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []hdr.KV{
+		{Key: "Host", Value: "example.com"},
+		{Key: "x-lower", Value: "1"},
+		{Key: "X-UPPER", Value: "2"},
+		{Key: "Cookie", Value: "a=1"},
+		{Key: "x-lower", Value: "3"},
+		{Key: "X-Folded", Value: "one two"},
+		{Key: "X-Trailing-Space", Value: "4"},
+	}
+	if !reflect.DeepEqual(req.RawHeaders, want) {
+		t.Errorf("RawHeaders =\n%q\nwant\n%q", req.RawHeaders, want)
+	}
+	// The canonical map is unaffected.
+	if got := req.Header[hdr.CanonicalHeaderKey("x-lower")]; !reflect.DeepEqual(got, []string{"1", "3"}) {
+		t.Errorf("Header[X-Lower] = %q; want [1 3]", got)
+	}
+}
+
+func TestNewRequestFromCurl(t *testing.T) {
+	req, err := NewRequestFromCurl(`curl 'https://example.com/api?q=1' -H 'Accept: application/json' \
+		-H "X-Quoted: say \"hi\""`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Method != GET || req.URL.String() != "https://example.com/api?q=1" {
+		t.Errorf("got %s %s; want GET https://example.com/api?q=1", req.Method, req.URL)
+	}
+	if got := req.Header.Get(hdr.Accept); got != "application/json" {
+		t.Errorf("Accept = %q; want application/json", got)
+	}
+	if got := req.Header.Get("X-Quoted"); got != `say "hi"` {
+		t.Errorf("X-Quoted = %q; want %q", got, `say "hi"`)
+	}
+	if req.Body != nil {
+		t.Error("GET request has a Body")
+	}
+
+	req, err = NewRequestFromCurl(`curl -XPUT --url http://example.com/items -d name=foo -d 'size=2 cm' -H 'Content-Type: text/plain'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Method != PUT {
+		t.Errorf("Method = %q; want PUT", req.Method)
+	}
+	if got := req.Header.Get(hdr.ContentType); got != "text/plain" {
+		t.Errorf("Content-Type = %q; want text/plain", got)
+	}
+
+	req, err = NewRequestFromCurl(`curl http://example.com/form --data "a=1&b=2" --data-raw c=3`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Method != POST {
+		t.Errorf("Method = %q; want POST", req.Method)
+	}
+	if got := req.Header.Get(hdr.ContentType); got != "application/x-www-form-urlencoded" {
+		t.Errorf("Content-Type = %q; want application/x-www-form-urlencoded", got)
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "a=1&b=2&c=3" || req.ContentLength != int64(len(body)) {
+		t.Errorf("Body = %q (ContentLength %d); want %q", body, req.ContentLength, "a=1&b=2&c=3")
+	}
+
+	for _, bad := range []string{
+		"wget http://example.com/",
+		"curl -X GET",
+		"curl http://example.com/ -H",
+		"curl 'http://example.com/",
+		"curl http://example.com/ -H NoColon",
+		"curl http://a.example/ http://b.example/",
+		"curl http://example.com/ --header=X-Foo:bar",
+	} {
+		if _, err := NewRequestFromCurl(bad); err == nil {
+			t.Errorf("NewRequestFromCurl(%q) succeeded; want error", bad)
+		}
+	}
+}
+
 func TestReadRequestBad(t *testing.T) {
 	var badRequestTests = []struct {
 		name string
@@ -1664,5 +1925,46 @@ Content-Length: 5`)},
 			all, err := ioutil.ReadAll(got.Body)
 			t.Errorf("%s: got unexpected request = %#v\n  Body = %q, %v", tt.name, got, all, err)
 		}
+		got, err = ReadRequestLimited(bufio.NewReader(bytes.NewReader(tt.req)), 1<<10)
+		if err == nil {
+			all, err := ioutil.ReadAll(got.Body)
+			t.Errorf("%s: ReadRequestLimited got unexpected request = %#v\n  Body = %q, %v", tt.name, got, all, err)
+		}
+	}
+}
+
+func TestReadRequestLimited(t *testing.T) {
+	const head = "GET / HTTP/1.1\r\nHost: foo.com\r\n"
+	tests := []struct {
+		name    string
+		req     string
+		max     int
+		wantErr error
+	}{
+		{"fits", head + "X-Small: 1\r\n\r\n", 100, nil},
+		{"large_value", head + "X-Big: " + strings.Repeat("a", 200) + "\r\n\r\n", 100, hdr.ErrHeaderTooLarge},
+		{"many_fields", head + strings.Repeat("X-Field: value\r\n", 50) + "\r\n", 500, hdr.ErrHeaderTooLarge},
+		{"long_request_line", "GET /" + strings.Repeat("a", 200) + " HTTP/1.1\r\n\r\n", 100, hdr.ErrHeaderTooLarge},
+		{"default_limit", head + "X-Big: " + strings.Repeat("a", DefaultMaxHeaderBytes) + "\r\n\r\n", 0, hdr.ErrHeaderTooLarge},
+	}
+	for _, tt := range tests {
+		req, err := ReadRequestLimited(bufio.NewReader(strings.NewReader(tt.req)), tt.max)
+		if err != tt.wantErr {
+			t.Errorf("%s: err = %v; want %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err == nil && req.Header.Get("X-Small") != "1" {
+			t.Errorf("%s: header = %v", tt.name, req.Header)
+		}
+	}
+
+	// The limit only applies to the header, not to the body.
+	body := strings.Repeat("b", 1000)
+	req, err := ReadRequestLimited(bufio.NewReader(strings.NewReader("POST / HTTP/1.1\r\nHost: foo.com\r\nContent-Length: 1000\r\n\r\n"+body)), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ioutil.ReadAll(req.Body); err != nil || string(got) != body {
+		t.Errorf("body = %d bytes, %v; want %d bytes", len(got), err, len(body))
 	}
 }
@@ -8,6 +8,7 @@ package tests
 import (
 	"bufio"
 	"bytes"
+	"compress/flate"
 	"compress/gzip"
 	"context"
 	"crypto/tls"
@@ -40,6 +41,8 @@ import (
 	"github.com/badu/http/th"
 	. "github.com/badu/http/tport"
 	"github.com/badu/http/url"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
 )
 
 func TestConsumingBodyOnNextConn(t *testing.T) {
@@ -116,6 +119,186 @@ func TestServeMuxHandler(t *testing.T) {
 	}
 }
 
+func TestServeMuxMatchedPattern(t *testing.T) {
+	setParallel(t)
+	srvMx := mux.NewServeMux()
+	var got string
+	var gotOK bool
+	srvMx.HandleFunc("/users/", func(w ResponseWriter, r *Request) {
+		got, gotOK = mux.MatchedPattern(r)
+	})
+	req, err := NewRequest(GET, "http://example.com/users/42", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := mux.MatchedPattern(req); ok {
+		t.Error("MatchedPattern reported a pattern before dispatch")
+	}
+	srvMx.ServeHTTP(th.NewRecorder(), req)
+	if !gotOK || got != "/users/" {
+		t.Errorf("MatchedPattern = %q, %v; want %q, true", got, gotOK, "/users/")
+	}
+}
+
+func TestServeMuxUseForPattern(t *testing.T) {
+	setParallel(t)
+	srvMx := mux.NewServeMux()
+	var order []string
+	tag := func(name string) func(Handler) Handler {
+		return func(h Handler) Handler {
+			return HandlerFunc(func(w ResponseWriter, r *Request) {
+				order = append(order, name)
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+				h.ServeHTTP(w, r)
+			})
+		}
+	}
+	srvMx.UseForPattern("/api/", tag("outer"))
+	srvMx.HandleFunc("/api/", func(w ResponseWriter, r *Request) {
+		order = append(order, "handler")
+	})
+	srvMx.HandleFunc("/static/", func(w ResponseWriter, r *Request) {
+		order = append(order, "handler")
+	})
+	srvMx.UseForPattern("/api/", tag("inner"))
+
+	tests := []struct {
+		url       string
+		wantOrder string
+		wantCORS  string
+	}{
+		{"http://example.com/api/users", "outer,inner,handler", "*"},
+		{"http://example.com/static/app.js", "handler", ""},
+	}
+	for _, tt := range tests {
+		order = nil
+		req, err := NewRequest(GET, tt.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := th.NewRecorder()
+		srvMx.ServeHTTP(rr, req)
+		if got := strings.Join(order, ","); got != tt.wantOrder {
+			t.Errorf("%s: call order = %q; want %q", tt.url, got, tt.wantOrder)
+		}
+		if got := rr.HeaderMap.Get("Access-Control-Allow-Origin"); got != tt.wantCORS {
+			t.Errorf("%s: Access-Control-Allow-Origin = %q; want %q", tt.url, got, tt.wantCORS)
+		}
+	}
+}
+
+func TestServeMuxParams(t *testing.T) {
+	setParallel(t)
+	srvMx := mux.NewServeMux()
+	for _, pattern := range []string{
+		"/",
+		"/users/",
+		"/users/new",
+		"/users/{id}",
+		"/users/{id}/posts/{slug}",
+		"/users/{id}/files/",
+		"/users/admin/files/",
+		"example.com/hosts/{name}",
+	} {
+		pattern := pattern
+		srvMx.HandleFunc(pattern, func(w ResponseWriter, r *Request) {
+			w.Header().Set("Pattern", pattern)
+			w.Header().Set("Id", mux.Param(r, "id"))
+			w.Header().Set("Slug", mux.Param(r, "slug"))
+			w.Header().Set("Name", mux.Param(r, "name"))
+		})
+	}
+
+	tests := []struct {
+		url         string
+		wantCode    int
+		wantPattern string
+		wantParams  string // id,slug,name
+		wantLoc     string
+	}{
+		{"http://other.com/users/new", 200, "/users/new", ",,", ""},
+		{"http://other.com/users/42", 200, "/users/{id}", "42,,", ""},
+		{"http://other.com/users/42/posts/hello", 200, "/users/{id}/posts/{slug}", "42,hello,", ""},
+		{"http://other.com/users/42/posts/", 200, "/users/", ",,", ""},
+		{"http://other.com/users/42/files/a/b", 200, "/users/{id}/files/", "42,,", ""},
+		{"http://other.com/users/admin/files/a", 200, "/users/admin/files/", ",,", ""},
+		{"http://other.com/users/42/files", 301, "", "", "/users/42/files/"},
+		{"http://other.com/users/", 200, "/users/", ",,", ""},
+		{"http://other.com/about", 200, "/", ",,", ""},
+		{"http://example.com/hosts/gopher", 200, "example.com/hosts/{name}", ",,gopher", ""},
+		{"http://other.com/hosts/gopher", 200, "/", ",,", ""},
+	}
+	for _, tt := range tests {
+		req, err := NewRequest(GET, tt.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := th.NewRecorder()
+		srvMx.ServeHTTP(rr, req)
+		if rr.Code != tt.wantCode {
+			t.Errorf("%s: code = %d; want %d", tt.url, rr.Code, tt.wantCode)
+			continue
+		}
+		if tt.wantLoc != "" {
+			if got := rr.HeaderMap.Get(hdr.Location); got != tt.wantLoc {
+				t.Errorf("%s: Location = %q; want %q", tt.url, got, tt.wantLoc)
+			}
+			continue
+		}
+		if got := rr.HeaderMap.Get("Pattern"); got != tt.wantPattern {
+			t.Errorf("%s: pattern = %q; want %q", tt.url, got, tt.wantPattern)
+		}
+		h := rr.HeaderMap
+		if got := h.Get("Id") + "," + h.Get("Slug") + "," + h.Get("Name"); got != tt.wantParams {
+			t.Errorf("%s: params = %q; want %q", tt.url, got, tt.wantParams)
+		}
+	}
+
+	req, err := NewRequest(GET, "http://other.com/users/42", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := mux.Param(req, "id"); got != "" {
+		t.Errorf("Param before dispatch = %q; want empty", got)
+	}
+}
+
+func TestServeMuxInvalidParams(t *testing.T) {
+	setParallel(t)
+	for _, pattern := range []string{"/users/{}", "/users/{id}/posts/{id}"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Handle(%q) didn't panic", pattern)
+				}
+			}()
+			mux.NewServeMux().HandleFunc(pattern, func(ResponseWriter, *Request) {})
+		}()
+	}
+}
+
+func TestServeMuxRoutes(t *testing.T) {
+	setParallel(t)
+	srvMx := mux.NewServeMux()
+	if got := srvMx.Routes(); len(got) != 0 {
+		t.Errorf("Routes of an empty ServeMux = %v; want none", got)
+	}
+	srvMx.HandleFunc("/users/{id}", func(ResponseWriter, *Request) {})
+	srvMx.Handle("/old", RedirectHandler("/new", StatusMovedPermanently))
+	srvMx.HandleFunc("/images/", func(ResponseWriter, *Request) {})
+	srvMx.Handle("example.com/", NotFoundHandler())
+
+	want := []mux.RouteInfo{
+		{Pattern: "/images/", Subtree: true, Handler: "http.HandlerFunc"},
+		{Pattern: "/old", Subtree: false, Handler: "*http.redirectHandler"},
+		{Pattern: "/users/{id}", Subtree: false, Handler: "http.HandlerFunc"},
+		{Pattern: "example.com/", Subtree: true, Handler: "http.HandlerFunc"},
+	}
+	if got := srvMx.Routes(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Routes = %+v; want %+v", got, want)
+	}
+}
+
 // TestServeMuxHandlerRedirects tests that automatic redirects generated by
 // mux.Handler() shouldn't clear the request's query string.
 func TestServeMuxHandlerRedirects(t *testing.T) {
@@ -278,6 +461,64 @@ func testServerTimeouts(timeout time.Duration) error {
 	return nil
 }
 
+// ReadHeaderTimeout applies only to reading the request headers; with
+// ReadTimeout unset a slow body must still be delivered to the handler.
+func TestServerReadHeaderTimeout(t *testing.T) {
+	setParallel(t)
+	defer afterTest(t)
+	const timeout = 250 * time.Millisecond
+	handled := make(chan string, 2)
+	ts := th.NewUnstartedServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		slurp, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("ReadAll: %v", err)
+		}
+		handled <- string(slurp)
+	}))
+	ts.Server.ReadHeaderTimeout = timeout
+	ts.Start()
+	defer ts.Close()
+
+	// Slow header writer: the connection is closed without running the handler.
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	t1 := time.Now()
+	conn.Write([]byte("GET / HTTP/1.1\r\nHost: foo\r\n"))
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	if n, err := conn.Read(make([]byte, 1)); n != 0 || err != io.EOF {
+		t.Fatalf("Read = %v, %v; want 0, EOF", n, err)
+	}
+	if latency, min := time.Since(t1), timeout/5*4; latency < min {
+		t.Errorf("got EOF after %v; want >= %v", latency, min)
+	}
+	select {
+	case got := <-handled:
+		t.Fatalf("handler ran for slow headers; body %q", got)
+	default:
+	}
+
+	// Slow body writer: headers arrive in time, so the body may take longer.
+	conn2, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn2.Close()
+	conn2.Write([]byte("POST / HTTP/1.1\r\nHost: foo\r\nContent-Length: 5\r\n\r\nab"))
+	time.Sleep(2 * timeout)
+	conn2.Write([]byte("cde"))
+	select {
+	case got := <-handled:
+		if got != "abcde" {
+			t.Errorf("body = %q; want %q", got, "abcde")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("timeout waiting for handler")
+	}
+}
+
 // golang.org/issue/4741 -- setting only a write timeout that triggers
 // shouldn't cause a handler to block forever on reads (next HTTP
 // request) that will never happen.
@@ -1218,6 +1459,232 @@ func TestRequestBodyTimeoutClosesConnection(t *testing.T) {
 	}
 }
 
+func TestRequestDedupKey(t *testing.T) {
+	req, _ := NewRequest(POST, "http://example.com/orders?x=1", nil)
+	if got := req.DedupKey(); got != "" {
+		t.Errorf("DedupKey without Idempotency-Key = %q; want empty", got)
+	}
+	req.Header.Set(hdr.IdempotencyKey, "abc")
+	const want = "POST http://example.com/orders?x=1 abc"
+	if got := req.DedupKey(); got != want {
+		t.Errorf("DedupKey = %q; want %q", got, want)
+	}
+}
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	var calls int32
+	h := NewIdempotencyMiddleware(&memIdempotencyStore{})(HandlerFunc(func(w ResponseWriter, r *Request) {
+		n := atomic.AddInt32(&calls, 1)
+		w.Header().Set("X-Call", strconv.Itoa(int(n)))
+		w.WriteHeader(StatusCreated)
+		fmt.Fprintf(w, "order %d", n)
+	}))
+
+	serve := func(key string) *th.ResponseRecorder {
+		req, _ := NewRequest(POST, "http://example.com/orders", nil)
+		if key != "" {
+			req.Header.Set(hdr.IdempotencyKey, key)
+		}
+		rec := th.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	tests := []struct {
+		key      string
+		wantBody string
+	}{
+		{"a", "order 1"},
+		{"a", "order 1"}, // replayed
+		{"b", "order 2"},
+		{"", "order 3"}, // no key, passed through
+		{"", "order 4"},
+		{"b", "order 2"}, // replayed
+	}
+	for i, tt := range tests {
+		rec := serve(tt.key)
+		if rec.Code != StatusCreated {
+			t.Errorf("%d. code = %d; want %d", i, rec.Code, StatusCreated)
+		}
+		if got := rec.Body.String(); got != tt.wantBody {
+			t.Errorf("%d. body = %q; want %q", i, got, tt.wantBody)
+		}
+		if got, want := rec.Header().Get("X-Call"), tt.wantBody[len("order "):]; got != want {
+			t.Errorf("%d. X-Call = %q; want %q", i, got, want)
+		}
+	}
+	if calls != 4 {
+		t.Errorf("handler called %d times; want 4", calls)
+	}
+}
+
+func TestEncodeHandler(t *testing.T) {
+	setParallel(t)
+	defer afterTest(t)
+	const body = "some text that the deflate encoder gets to squeeze, some text"
+	ts := th.NewUnstartedServer(EncodeHandler(HandlerFunc(func(w ResponseWriter, r *Request) {
+		if r.URL.Path == "/identity" {
+			w.Header().Set(hdr.ContentEncoding, "identity")
+		}
+		io.WriteString(w, body)
+	})))
+	var gzipUsed int32
+	ts.Server.RegisterEncoder("gzip", func(w io.Writer) io.WriteCloser {
+		atomic.AddInt32(&gzipUsed, 1)
+		return gzip.NewWriter(w)
+	})
+	ts.Server.RegisterEncoder("Deflate", func(w io.Writer) io.WriteCloser {
+		fw, _ := flate.NewWriter(w, flate.BestCompression)
+		return fw
+	})
+	ts.Start()
+	defer ts.Close()
+	c := &cli.Client{Transport: &Transport{DisableCompression: true}}
+	defer c.Transport.(*Transport).CloseIdleConnections()
+
+	tests := []struct {
+		path           string
+		acceptEncoding string
+		wantEncoding   string
+	}{
+		{"/", "", ""},
+		{"/", "compress", ""},
+		{"/", "deflate", "deflate"},
+		{"/", "gzip;q=0.5, DEFLATE", "deflate"},
+		{"/", "deflate;q=0, gzip;q=0.1", "gzip"},
+		{"/", "gzip, deflate", "gzip"},
+		{"/identity", "deflate", "identity"},
+	}
+	for _, tt := range tests {
+		req, _ := NewRequest(GET, ts.URL+tt.path, nil)
+		if tt.acceptEncoding != "" {
+			req.Header.Set(hdr.AcceptEncoding, tt.acceptEncoding)
+		}
+		res, err := c.Do(req)
+		if err != nil {
+			t.Fatalf("Accept-Encoding %q: %v", tt.acceptEncoding, err)
+		}
+		if got := res.Header.Get(hdr.ContentEncoding); got != tt.wantEncoding {
+			t.Errorf("Accept-Encoding %q: Content-Encoding = %q; want %q", tt.acceptEncoding, got, tt.wantEncoding)
+		}
+		var r io.Reader = res.Body
+		switch res.Header.Get(hdr.ContentEncoding) {
+		case "deflate":
+			r = flate.NewReader(res.Body)
+		case "gzip":
+			if r, err = gzip.NewReader(res.Body); err != nil {
+				t.Fatal(err)
+			}
+		}
+		got, err := ioutil.ReadAll(r)
+		res.CloseBody()
+		if err != nil {
+			t.Errorf("Accept-Encoding %q: reading body: %v", tt.acceptEncoding, err)
+		} else if string(got) != body {
+			t.Errorf("Accept-Encoding %q: body = %q; want %q", tt.acceptEncoding, got, body)
+		}
+		if tt.wantEncoding == "deflate" || tt.wantEncoding == "gzip" {
+			if got := res.Header.Get(hdr.ContentType); !strings.HasPrefix(got, "text/plain") {
+				t.Errorf("Accept-Encoding %q: Content-Type = %q; want the sniffed text/plain", tt.acceptEncoding, got)
+			}
+		}
+	}
+	if n := atomic.LoadInt32(&gzipUsed); n != 2 {
+		t.Errorf("gzip encoder used %d times; want 2", n)
+	}
+}
+
+func TestWrapGzipFlush(t *testing.T) {
+	setParallel(t)
+	defer afterTest(t)
+	next := make(chan bool)
+	ts := th.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		gw := WrapGzip(w, r)
+		if c, ok := gw.(io.Closer); ok {
+			defer c.Close()
+		}
+		io.WriteString(gw, "first part;")
+		gw.(Flusher).Flush()
+		<-next
+		io.WriteString(gw, "second part")
+	}))
+	defer ts.Close()
+	c := &cli.Client{Transport: &Transport{DisableCompression: true}}
+	defer c.Transport.(*Transport).CloseIdleConnections()
+
+	req, _ := NewRequest(GET, ts.URL, nil)
+	req.Header.Set(hdr.AcceptEncoding, "gzip")
+	res, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.CloseBody()
+	if got := res.Header.Get(hdr.ContentEncoding); got != "gzip" {
+		t.Fatalf("Content-Encoding = %q; want gzip", got)
+	}
+	gz, err := gzip.NewReader(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, len("first part;"))
+	if _, err := io.ReadFull(gz, buf); err != nil || string(buf) != "first part;" {
+		t.Fatalf("read before second write = %q, %v; want %q", buf, err, "first part;")
+	}
+	close(next)
+	rest, err := ioutil.ReadAll(gz)
+	if err != nil || string(rest) != "second part" {
+		t.Errorf("rest = %q, %v; want %q", rest, err, "second part")
+	}
+}
+
+func TestWrapGzipSkips(t *testing.T) {
+	setParallel(t)
+	defer afterTest(t)
+	ts := th.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		gw := WrapGzip(w, r)
+		if c, ok := gw.(io.Closer); ok {
+			defer c.Close()
+		}
+		if r.URL.Path == "/png" {
+			gw.Header().Set(hdr.ContentType, "image/png")
+		}
+		io.WriteString(gw, "some body")
+	}))
+	defer ts.Close()
+	c := &cli.Client{Transport: &Transport{DisableCompression: true}}
+	defer c.Transport.(*Transport).CloseIdleConnections()
+
+	tests := []struct {
+		path           string
+		acceptEncoding string
+		wantEncoding   string
+	}{
+		{"/", "gzip", "gzip"},
+		{"/", "", ""},
+		{"/", "deflate", ""},
+		{"/", "gzip;q=0", ""},
+		{"/png", "gzip", ""},
+	}
+	for _, tt := range tests {
+		req, _ := NewRequest(GET, ts.URL+tt.path, nil)
+		if tt.acceptEncoding != "" {
+			req.Header.Set(hdr.AcceptEncoding, tt.acceptEncoding)
+		}
+		res, err := c.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(res.Body)
+		res.CloseBody()
+		if got := res.Header.Get(hdr.ContentEncoding); got != tt.wantEncoding {
+			t.Errorf("%s with Accept-Encoding %q: Content-Encoding = %q; want %q", tt.path, tt.acceptEncoding, got, tt.wantEncoding)
+		}
+		if tt.wantEncoding == "" && string(body) != "some body" {
+			t.Errorf("%s with Accept-Encoding %q: body = %q; want %q", tt.path, tt.acceptEncoding, body, "some body")
+		}
+	}
+}
+
 func TestTimeoutHandler(t *testing.T) {
 	setParallel(t)
 	defer afterTest(t)
@@ -1460,6 +1927,38 @@ func TestTimeoutHandlerEmptyResponse(t *testing.T) {
 	}
 }
 
+func TestContextTimeoutHandler(t *testing.T) {
+	setParallel(t)
+	defer afterTest(t)
+	ctxErr := make(chan error, 1)
+	var handler HandlerFunc = func(w ResponseWriter, r *Request) {
+		if _, ok := r.Context().Deadline(); !ok {
+			t.Error("request context has no deadline")
+		}
+		select {
+		case <-r.Context().Done():
+			ctxErr <- r.Context().Err()
+		case <-time.After(10 * time.Second):
+			ctxErr <- errors.New("request context not canceled")
+		}
+	}
+	ts := th.NewServer(ContextTimeoutHandler(handler, 50*time.Millisecond, "timed out"))
+	defer ts.Close()
+
+	res, err := ts.Client().Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.CloseBody()
+	if res.StatusCode != StatusServiceUnavailable || string(body) != "timed out" {
+		t.Errorf("got %d %q; want %d %q", res.StatusCode, body, StatusServiceUnavailable, "timed out")
+	}
+	if err := <-ctxErr; err != context.DeadlineExceeded {
+		t.Errorf("context error = %v; want %v", err, context.DeadlineExceeded)
+	}
+}
+
 func TestRedirectBadPath(t *testing.T) {
 	// This used to crash. It's not valid input (bad path), but it
 	// shouldn't crash.
@@ -1741,6 +2240,36 @@ func TestStripPrefix_notModifyRequest(t *testing.T) {
 	}
 }
 
+func TestNewTRequestCtx(t *testing.T) {
+	const timeout = time.Hour
+	before := time.Now()
+	req := th.NewTRequestCtx(POST, "/upload", strings.NewReader("body"), timeout)
+	after := time.Now()
+	if req.Method != POST || req.URL.Path != "/upload" || req.ContentLength != 4 {
+		t.Errorf("got %s %s with ContentLength %d; want POST /upload with ContentLength 4", req.Method, req.URL.Path, req.ContentLength)
+	}
+	deadline, ok := req.Context().Deadline()
+	if !ok {
+		t.Fatal("request context has no deadline")
+	}
+	if deadline.Before(before.Add(timeout)) || deadline.After(after.Add(timeout)) {
+		t.Errorf("deadline = %v; want %v from now", deadline, timeout)
+	}
+	if err := req.Context().Err(); err != nil {
+		t.Errorf("context already done: %v", err)
+	}
+
+	req = th.NewTRequestCtx(GET, "/", nil, time.Millisecond)
+	select {
+	case <-req.Context().Done():
+		if err := req.Context().Err(); err != context.DeadlineExceeded {
+			t.Errorf("context error = %v; want %v", err, context.DeadlineExceeded)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("context not done after its timeout")
+	}
+}
+
 func TestRequestLimit(t *testing.T) {
 	setParallel(t)
 	defer afterTest(t)
@@ -1859,43 +2388,218 @@ func TestServerBufferedChunking(t *testing.T) {
 	}
 }
 
-// Tests that the server flushes its response headers out when it's
-// ignoring the response body and waits a bit before forcefully
-// closing the TCP connection, causing the client to get a RST.
-// See https://golang.org/issue/3595
-func TestServerGracefulClose(t *testing.T) {
-	setParallel(t)
-	defer afterTest(t)
-	ts := th.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
-		Error(w, "bye", StatusUnauthorized)
+// Tests that a streaming handler talking to an HTTP/1.0 client gets a
+// close-delimited response, since HTTP/1.0 has no chunked encoding.
+func TestServerHTTP10StreamingIsCloseDelimited(t *testing.T) {
+	conn := new(testConn)
+	conn.readBuf.Write([]byte("GET / HTTP/1.0\r\nConnection: keep-alive\r\n\r\n"))
+	conn.closec = make(chan bool, 1)
+	ls := &oneConnListener{conn}
+	go Serve(ls, HandlerFunc(func(rw ResponseWriter, req *Request) {
+		rw.Header().Set(hdr.TransferEncoding, "chunked") // must be dropped
+		io.WriteString(rw, "hello, ")
+		rw.(Flusher).Flush()
+		io.WriteString(rw, "world")
 	}))
-	defer ts.Close()
+	<-conn.closec
 
-	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	res, err := ReadResponse(bufio.NewReader(&conn.writeBuf), &Request{Method: GET})
 	if err != nil {
 		t.Fatal(err)
 	}
-	defer conn.Close()
-	const bodySize = 5 << 20
-	req := []byte(fmt.Sprintf("POST / HTTP/1.1\r\nHost: foo.com\r\nContent-Length: %d\r\n\r\n", bodySize))
-	for i := 0; i < bodySize; i++ {
-		req = append(req, 'x')
+	if res.ProtoMajor != 1 || res.ProtoMinor != 0 {
+		t.Errorf("proto = %d.%d; want 1.0", res.ProtoMajor, res.ProtoMinor)
 	}
-	writeErr := make(chan error)
-	go func() {
-		_, err := conn.Write(req)
-		writeErr <- err
-	}()
-	br := bufio.NewReader(conn)
-	lineNum := 0
-	for {
-		line, err := br.ReadString('\n')
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			t.Fatalf("ReadLine: %v", err)
-		}
+	if len(res.TransferEncoding) != 0 || res.Header.Get(hdr.TransferEncoding) != "" {
+		t.Errorf("response was chunked: %q", conn.writeBuf.String())
+	}
+	if res.ContentLength != -1 || !res.Close {
+		t.Errorf("ContentLength = %d, Close = %v; want -1, true", res.ContentLength, res.Close)
+	}
+	if res.Header.Get(hdr.Connection) == DoKeepAlive {
+		t.Errorf("close-delimited response advertises keep-alive")
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "hello, world" {
+		t.Errorf("body = %q; want %q", body, "hello, world")
+	}
+}
+
+func TestServerWriteEarlyHints(t *testing.T) {
+	conn := new(testConn)
+	conn.readBuf.Write([]byte("GET / HTTP/1.1\r\nHost: foo\r\nConnection: close\r\n\r\n"))
+	conn.closec = make(chan bool, 1)
+	ls := &oneConnListener{conn}
+	var logBuf bytes.Buffer
+	srv := &Server{ErrorLog: log.New(&logBuf, "", 0)}
+	srv.Handler = HandlerFunc(func(rw ResponseWriter, req *Request) {
+		eh, ok := rw.(EarlyHinter)
+		if !ok {
+			t.Errorf("ResponseWriter %T does not implement EarlyHinter", rw)
+			return
+		}
+		eh.WriteEarlyHints(hdr.Header{hdr.Link: {"</style.css>; rel=preload; as=style"}})
+		eh.WriteEarlyHints(hdr.Header{hdr.Link: {"</script.js>; rel=preload; as=script"}})
+		rw.Write([]byte("ok"))
+		eh.WriteEarlyHints(hdr.Header{hdr.Link: {"</late.js>; rel=preload"}})
+	})
+	go srv.Serve(ls)
+	<-conn.closec
+	got := conn.writeBuf.String()
+	const want = "HTTP/1.1 103 Early Hints\r\nLink: </style.css>; rel=preload; as=style\r\n\r\n" +
+		"HTTP/1.1 103 Early Hints\r\nLink: </script.js>; rel=preload; as=script\r\n\r\n" +
+		"HTTP/1.1 200 OK\r\n"
+	if !strings.HasPrefix(got, want) {
+		t.Errorf("response didn't start with the early hints; got:\n%q", got)
+	}
+	if strings.Contains(got, "late.js") {
+		t.Errorf("early hints written after the final header; got:\n%q", got)
+	}
+	if !strings.Contains(logBuf.String(), "WriteEarlyHints called after the header was written") {
+		t.Errorf("no warning logged for the late early hints; log: %q", logBuf.String())
+	}
+}
+
+// Tests that a handler returning in the middle of a chunked response has
+// the chunk stream terminated, while one returning short of its declared
+// Content-Length gets its connection closed rather than reused.
+func TestServerHandlerReturnsEarly(t *testing.T) {
+	const reqs = "GET /chunked HTTP/1.1\r\nHost: foo\r\n\r\n" +
+		"GET /short HTTP/1.1\r\nHost: foo\r\n\r\n" +
+		"GET /never HTTP/1.1\r\nHost: foo\r\n\r\n"
+	conn := new(testConn)
+	conn.readBuf.Write([]byte(reqs))
+	conn.closec = make(chan bool, 1)
+	ls := &oneConnListener{conn}
+	go Serve(ls, HandlerFunc(func(rw ResponseWriter, req *Request) {
+		switch req.URL.Path {
+		case "/chunked":
+			io.WriteString(rw, "hello")
+			rw.(Flusher).Flush()
+		case "/short":
+			rw.Header().Set(hdr.ContentLength, "10")
+			io.WriteString(rw, "abc")
+		default:
+			t.Errorf("unexpected request for %s on a connection to be closed", req.URL.Path)
+		}
+	}))
+	<-conn.closec
+
+	br := bufio.NewReader(strings.NewReader(conn.writeBuf.String()))
+	res, err := ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.TransferEncoding) != 1 || res.TransferEncoding[0] != DoChunked {
+		t.Errorf("first response Transfer-Encoding = %q; want chunked", res.TransferEncoding)
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil || string(body) != "hello" {
+		t.Errorf("first response body = %q, %v; want %q, nil", body, err, "hello")
+	}
+
+	res, err = ReadResponse(br, nil)
+	if err != nil {
+		t.Fatalf("second response: %v", err)
+	}
+	body, err = ioutil.ReadAll(res.Body)
+	if err != io.ErrUnexpectedEOF || string(body) != "abc" {
+		t.Errorf("second response body = %q, %v; want %q, %v", body, err, "abc", io.ErrUnexpectedEOF)
+	}
+}
+
+func TestServerRejectBareLF(t *testing.T) {
+	for _, reject := range []bool{false, true} {
+		conn := new(testConn)
+		conn.readBuf.Write([]byte("GET / HTTP/1.1\r\nHost: foo\nConnection: close\r\n\r\n"))
+		conn.closec = make(chan bool, 1)
+		ls := &oneConnListener{conn}
+		srv := &Server{
+			RejectBareLF: reject,
+			Handler: HandlerFunc(func(rw ResponseWriter, req *Request) {
+				rw.Write([]byte("ok"))
+			}),
+		}
+		go srv.Serve(ls)
+		<-conn.closec
+		got := conn.writeBuf.String()
+		want := "HTTP/1.1 200 OK\r\n"
+		if reject {
+			want = "HTTP/1.1 400 Bad Request"
+		}
+		if !strings.HasPrefix(got, want) {
+			t.Errorf("RejectBareLF=%v: got response %q; want prefix %q", reject, got, want)
+		}
+	}
+}
+
+func TestServerKeepRawHeaders(t *testing.T) {
+	for _, keep := range []bool{false, true} {
+		conn := new(testConn)
+		conn.readBuf.Write([]byte("GET / HTTP/1.1\r\nHost: foo\r\nx-lower: 1\r\nConnection: close\r\n\r\n"))
+		conn.closec = make(chan bool, 1)
+		ls := &oneConnListener{conn}
+		var raw []hdr.KV
+		srv := &Server{
+			KeepRawHeaders: keep,
+			Handler: HandlerFunc(func(rw ResponseWriter, req *Request) {
+				raw = req.RawHeaders
+			}),
+		}
+		go srv.Serve(ls)
+		<-conn.closec
+		if !keep {
+			if raw != nil {
+				t.Errorf("KeepRawHeaders=false: RawHeaders = %q; want nil", raw)
+			}
+			continue
+		}
+		if len(raw) != 3 || raw[1] != (hdr.KV{Key: "x-lower", Value: "1"}) {
+			t.Errorf("KeepRawHeaders=true: RawHeaders = %q", raw)
+		}
+	}
+}
+
+// Tests that the server flushes its response headers out when it's
+// ignoring the response body and waits a bit before forcefully
+// closing the TCP connection, causing the client to get a RST.
+// See https://golang.org/issue/3595
+func TestServerGracefulClose(t *testing.T) {
+	setParallel(t)
+	defer afterTest(t)
+	ts := th.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		Error(w, "bye", StatusUnauthorized)
+	}))
+	defer ts.Close()
+
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	const bodySize = 5 << 20
+	req := []byte(fmt.Sprintf("POST / HTTP/1.1\r\nHost: foo.com\r\nContent-Length: %d\r\n\r\n", bodySize))
+	for i := 0; i < bodySize; i++ {
+		req = append(req, 'x')
+	}
+	writeErr := make(chan error)
+	go func() {
+		_, err := conn.Write(req)
+		writeErr <- err
+	}()
+	br := bufio.NewReader(conn)
+	lineNum := 0
+	for {
+		line, err := br.ReadString('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("ReadLine: %v", err)
+		}
 		lineNum++
 		if lineNum == 1 && !strings.Contains(line, "401 Unauthorized") {
 			t.Errorf("Response line = %q; want a 401", line)
@@ -2126,6 +2830,93 @@ func TestHijackAfterCloseNotifier(t *testing.T) {
 	}
 }
 
+func TestUpgradeWebSocket(t *testing.T) {
+	setParallel(t)
+	defer afterTest(t)
+	ts := th.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		w.Header().Set("Sec-Websocket-Protocol", "echo")
+		conn, brw, err := Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		// no framing: echo a line back, raw
+		line, err := brw.ReadString('\n')
+		if err != nil {
+			t.Errorf("reading from upgraded conn: %v", err)
+			return
+		}
+		brw.WriteString(line)
+		brw.Flush()
+	}))
+	defer ts.Close()
+
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	// the key and accept values are the example of RFC 6455 section 1.3
+	io.WriteString(conn, "GET /chat HTTP/1.1\r\nHost: foo\r\nUpgrade: websocket\r\nConnection: keep-alive, Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n")
+	br := bufio.NewReader(conn)
+	res, err := ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != StatusSwitchingProtocols {
+		t.Fatalf("status = %d; want %d", res.StatusCode, StatusSwitchingProtocols)
+	}
+	for k, want := range map[string]string{
+		hdr.UpgradeHeader:        "websocket",
+		hdr.Connection:           "Upgrade",
+		hdr.SecWebSocketAccept:   "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=",
+		"Sec-Websocket-Protocol": "echo",
+	} {
+		if got := res.Header.Get(k); got != want {
+			t.Errorf("%s = %q; want %q", k, got, want)
+		}
+	}
+	io.WriteString(conn, "raw bytes\n")
+	if got, err := br.ReadString('\n'); err != nil || got != "raw bytes\n" {
+		t.Errorf("echo = %q, %v; want %q", got, err, "raw bytes\n")
+	}
+}
+
+func TestUpgradeWebSocketBadHandshake(t *testing.T) {
+	setParallel(t)
+	defer afterTest(t)
+	tests := []struct {
+		method string
+		header map[string]string
+		want   int
+	}{
+		{POST, nil, StatusBadRequest},
+		{GET, map[string]string{hdr.UpgradeHeader: ""}, StatusBadRequest},
+		{GET, map[string]string{hdr.SecWebSocketKey: ""}, StatusBadRequest},
+		{GET, map[string]string{hdr.SecWebSocketKey: "c2hvcnQ="}, StatusBadRequest},
+		{GET, map[string]string{hdr.SecWebSocketVersion: "8"}, StatusUpgradeRequired},
+	}
+	for _, tt := range tests {
+		req, _ := NewRequest(tt.method, "/", nil)
+		req.Header.Set(hdr.UpgradeHeader, "websocket")
+		req.Header.Set(hdr.Connection, "Upgrade")
+		req.Header.Set(hdr.SecWebSocketKey, "dGhlIHNhbXBsZSBub25jZQ==")
+		req.Header.Set(hdr.SecWebSocketVersion, "13")
+		for k, v := range tt.header {
+			req.Header.Set(k, v)
+		}
+		rec := th.NewRecorder()
+		if _, _, err := Upgrade(rec, req); err != ErrBadHandshake {
+			t.Errorf("%s %v: Upgrade error = %v; want ErrBadHandshake", tt.method, tt.header, err)
+		}
+		if rec.Code != tt.want {
+			t.Errorf("%s %v: status = %d; want %d", tt.method, tt.header, rec.Code, tt.want)
+		}
+	}
+}
+
 func TestHijackBeforeRequestBodyRead(t *testing.T) {
 	setParallel(t)
 	defer afterTest(t)
@@ -3084,6 +3875,66 @@ func TestCloseWrite(t *testing.T) {
 // fixed.
 //
 // So add an explicit test for this.
+func TestServerWriteContext(t *testing.T) {
+	setParallel(t)
+	defer afterTest(t)
+	gotErr := make(chan error, 1)
+	ts := th.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		cw, ok := w.(ContextWriter)
+		if !ok {
+			gotErr <- errors.New("ResponseWriter is not a ContextWriter")
+			return
+		}
+		if r.URL.Path == "/canceled" {
+			ctx, cancel := context.WithCancel(r.Context())
+			cw.WriteContext(ctx, []byte("before"))
+			cancel()
+			_, err := cw.WriteContext(ctx, []byte("after"))
+			gotErr <- err
+			return
+		}
+		// Stream until the client goes away.
+		chunk := bytes.Repeat([]byte("x"), 4<<10)
+		for {
+			if _, err := cw.WriteContext(r.Context(), chunk); err != nil {
+				gotErr <- err
+				return
+			}
+		}
+	}))
+	defer ts.Close()
+	c := ts.Client()
+
+	res, err := c.Get(ts.URL + "/canceled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.CloseBody()
+	if err := <-gotErr; err != context.Canceled {
+		t.Errorf("WriteContext after cancel = %v; want %v", err, context.Canceled)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := NewRequest(GET, ts.URL+"/stream", nil)
+	res, err = c.Do(req.WithContext(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(res.Body, make([]byte, 1)); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	res.CloseBody()
+	select {
+	case err := <-gotErr:
+		if err != context.Canceled {
+			t.Errorf("WriteContext after client went away = %v; want %v", err, context.Canceled)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("streaming handler didn't stop after the client went away")
+	}
+}
+
 func TestServerFlushAndHijack(t *testing.T) {
 	defer afterTest(t)
 	ts := th.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
@@ -3578,67 +4429,253 @@ func TestServerContext_LocalAddrContextKey(t *testing.T) {
 	}
 }
 
-// https://golang.org/issue/15960
-func TestHandlerSetTransferEncodingChunked(t *testing.T) {
+func TestServerContext_ConnBytesContextKey(t *testing.T) {
 	setParallel(t)
 	defer afterTest(t)
-	ht := newHandlerTest(HandlerFunc(func(w ResponseWriter, r *Request) {
-		w.Header().Set(hdr.TransferEncoding, DoChunked)
-		w.Write([]byte("hello"))
+	type counts struct{ read, written int64 }
+	ch := make(chan counts, 1)
+	ts := th.NewUnstartedServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		cb, ok := r.Context().Value(ConnBytesContextKey).(*ConnBytes)
+		if !ok {
+			t.Error("no *ConnBytes in the request context")
+			return
+		}
+		ch <- counts{atomic.LoadInt64(&cb.Read), atomic.LoadInt64(&cb.Written)}
+		io.WriteString(w, "hello")
 	}))
-	resp := ht.rawResponse("GET / HTTP/1.1\nHost: foo")
-	const hdr = "Transfer-Encoding: chunked"
-	if n := strings.Count(resp, hdr); n != 1 {
-		t.Errorf("want 1 occurrence of %q in response, got %v\nresponse: %v", hdr, n, resp)
+	ts.Server.CountConnBytes = true
+	ts.Start()
+	defer ts.Close()
+
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
 	}
-}
+	defer conn.Close()
+	var nRead int64
+	br := bufio.NewReader(countReader{conn, &nRead})
 
-// https://golang.org/issue/16063
-func TestHandlerSetTransferEncodingGzip(t *testing.T) {
-	setParallel(t)
-	defer afterTest(t)
-	ht := newHandlerTest(HandlerFunc(func(w ResponseWriter, r *Request) {
-		w.Header().Set(hdr.TransferEncoding, "gzip")
-		gz := gzip.NewWriter(w)
-		gz.Write([]byte("hello"))
-		gz.Close()
-	}))
-	resp := ht.rawResponse("GET / HTTP/1.1\nHost: foo")
-	for _, v := range []string{"gzip", DoChunked} {
-		hdr := "Transfer-Encoding: " + v
-		if n := strings.Count(resp, hdr); n != 1 {
-			t.Errorf("want 1 occurrence of %q in response, got %v\nresponse: %v", hdr, n, resp)
+	const req = "GET / HTTP/1.1\r\nHost: foo\r\n\r\n"
+	var sent int64
+	for i := 0; i < 2; i++ {
+		n, err := io.WriteString(conn, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sent += int64(n)
+		got := <-ch
+		if got.read != sent {
+			t.Errorf("request %d: Read = %d; want %d", i, got.read, sent)
+		}
+		// The previous response was fully read by the client,
+		// so the server wrote exactly those bytes.
+		if received := atomic.LoadInt64(&nRead); got.written != received {
+			t.Errorf("request %d: Written = %d; want %d", i, got.written, received)
+		}
+		res, err := ReadResponse(br, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if body, _ := ioutil.ReadAll(res.Body); string(body) != "hello" {
+			t.Errorf("request %d: body = %q; want hello", i, body)
 		}
+		res.CloseBody()
 	}
-}
-
-// Verify this doesn't race (Issue 16505)
-func TestConcurrentServerServe(t *testing.T) {
-	setParallel(t)
-	for i := 0; i < 100; i++ {
-		ln1 := &oneConnListener{conn: nil}
-		ln2 := &oneConnListener{conn: nil}
-		srv := Server{}
-		go func() { srv.Serve(ln1) }()
-		go func() { srv.Serve(ln2) }()
+	if received := atomic.LoadInt64(&nRead); received == 0 {
+		t.Error("client read no bytes")
 	}
 }
 
-func TestServerIdleTimeout(t *testing.T) {
-	if testing.Short() {
-		t.Skip("skipping in short mode")
-	}
+func TestServerContext_ConnBytesHijacked(t *testing.T) {
 	setParallel(t)
 	defer afterTest(t)
+	type counts struct{ read, written int64 }
+	ch := make(chan counts, 1)
 	ts := th.NewUnstartedServer(HandlerFunc(func(w ResponseWriter, r *Request) {
-		io.Copy(ioutil.Discard, r.Body)
-		io.WriteString(w, r.RemoteAddr)
+		cb := r.Context().Value(ConnBytesContextKey).(*ConnBytes)
+		conn, bufrw, err := w.(Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		before := counts{atomic.LoadInt64(&cb.Read), atomic.LoadInt64(&cb.Written)}
+		io.WriteString(conn, "hello")
+		if _, err := io.ReadFull(bufrw, make([]byte, 3)); err != nil {
+			t.Error(err)
+		}
+		ch <- counts{atomic.LoadInt64(&cb.Read) - before.read, atomic.LoadInt64(&cb.Written) - before.written}
 	}))
-	ts.Server.ReadHeaderTimeout = 1 * time.Second
-	ts.Server.IdleTimeout = 2 * time.Second
+	ts.Server.CountConnBytes = true
 	ts.Start()
 	defer ts.Close()
-	c := ts.Client()
+
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	io.WriteString(conn, "GET / HTTP/1.1\r\nHost: foo\r\n\r\n")
+	if _, err := io.ReadFull(conn, make([]byte, 5)); err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(conn, "bye")
+	if got, want := <-ch, (counts{read: 3, written: 5}); got != want {
+		t.Errorf("after Hijack, counted %+v; want %+v", got, want)
+	}
+}
+
+func TestServerContext_ConnBytesContextKeyDisabled(t *testing.T) {
+	setParallel(t)
+	defer afterTest(t)
+	ch := make(chan interface{}, 1)
+	cst := newClientServerTest(t, HandlerFunc(func(w ResponseWriter, r *Request) {
+		ch <- r.Context().Value(ConnBytesContextKey)
+	}))
+	defer cst.close()
+	if _, err := cst.c.Head(cst.ts.URL); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-ch; got != nil {
+		t.Errorf("conn bytes value = %v; want nil when CountConnBytes is off", got)
+	}
+}
+
+func TestServerContexts(t *testing.T) {
+	setParallel(t)
+	defer afterTest(t)
+	type baseKey struct{}
+	type connKey struct{}
+	ch := make(chan context.Context, 1)
+	ts := th.NewUnstartedServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		ch <- r.Context()
+	}))
+	ts.Server.BaseContext = func(ln net.Listener) context.Context {
+		if ln == nil {
+			t.Error("BaseContext got a nil listener")
+		}
+		return context.WithValue(context.Background(), baseKey{}, "base")
+	}
+	ts.Server.ConnContext = func(ctx context.Context, c net.Conn) context.Context {
+		if got, want := ctx.Value(baseKey{}), "base"; got != want {
+			t.Errorf("in ConnContext, base context key = %#v; want %q", got, want)
+		}
+		if ctx.Value(SrvCtxtKey) == nil {
+			t.Error("in ConnContext, no server in the context")
+		}
+		return context.WithValue(ctx, connKey{}, "conn")
+	}
+	ts.Start()
+	defer ts.Close()
+	res, err := ts.Client().Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.CloseBody()
+	ctx := <-ch
+	if got, want := ctx.Value(baseKey{}), "base"; got != want {
+		t.Errorf("base context key = %#v; want %q", got, want)
+	}
+	if got, want := ctx.Value(connKey{}), "conn"; got != want {
+		t.Errorf("conn context key = %#v; want %q", got, want)
+	}
+}
+
+// Canceling the context returned by BaseContext cancels the in-flight requests.
+func TestServerBaseContextCancel(t *testing.T) {
+	setParallel(t)
+	defer afterTest(t)
+	baseCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	inHandler := make(chan struct{})
+	handlerErr := make(chan error, 1)
+	ts := th.NewUnstartedServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		close(inHandler)
+		select {
+		case <-r.Context().Done():
+			handlerErr <- r.Context().Err()
+		case <-time.After(5 * time.Second):
+			handlerErr <- errors.New("request context not canceled")
+		}
+	}))
+	ts.Server.BaseContext = func(net.Listener) context.Context { return baseCtx }
+	ts.Start()
+	defer ts.Close()
+
+	go func() {
+		res, err := ts.Client().Get(ts.URL)
+		if err == nil {
+			res.CloseBody()
+		}
+	}()
+	<-inHandler
+	cancel()
+	if err := <-handlerErr; err != context.Canceled {
+		t.Errorf("handler context error = %v; want %v", err, context.Canceled)
+	}
+}
+
+// https://golang.org/issue/15960
+func TestHandlerSetTransferEncodingChunked(t *testing.T) {
+	setParallel(t)
+	defer afterTest(t)
+	ht := newHandlerTest(HandlerFunc(func(w ResponseWriter, r *Request) {
+		w.Header().Set(hdr.TransferEncoding, DoChunked)
+		w.Write([]byte("hello"))
+	}))
+	resp := ht.rawResponse("GET / HTTP/1.1\nHost: foo")
+	const hdr = "Transfer-Encoding: chunked"
+	if n := strings.Count(resp, hdr); n != 1 {
+		t.Errorf("want 1 occurrence of %q in response, got %v\nresponse: %v", hdr, n, resp)
+	}
+}
+
+// https://golang.org/issue/16063
+func TestHandlerSetTransferEncodingGzip(t *testing.T) {
+	setParallel(t)
+	defer afterTest(t)
+	ht := newHandlerTest(HandlerFunc(func(w ResponseWriter, r *Request) {
+		w.Header().Set(hdr.TransferEncoding, "gzip")
+		gz := gzip.NewWriter(w)
+		gz.Write([]byte("hello"))
+		gz.Close()
+	}))
+	resp := ht.rawResponse("GET / HTTP/1.1\nHost: foo")
+	for _, v := range []string{"gzip", DoChunked} {
+		hdr := "Transfer-Encoding: " + v
+		if n := strings.Count(resp, hdr); n != 1 {
+			t.Errorf("want 1 occurrence of %q in response, got %v\nresponse: %v", hdr, n, resp)
+		}
+	}
+}
+
+// Verify this doesn't race (Issue 16505)
+func TestConcurrentServerServe(t *testing.T) {
+	setParallel(t)
+	for i := 0; i < 100; i++ {
+		ln1 := &oneConnListener{conn: nil}
+		ln2 := &oneConnListener{conn: nil}
+		srv := Server{}
+		go func() { srv.Serve(ln1) }()
+		go func() { srv.Serve(ln2) }()
+	}
+}
+
+func TestServerIdleTimeout(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode")
+	}
+	setParallel(t)
+	defer afterTest(t)
+	ts := th.NewUnstartedServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		io.Copy(ioutil.Discard, r.Body)
+		io.WriteString(w, r.RemoteAddr)
+	}))
+	ts.Server.ReadHeaderTimeout = 1 * time.Second
+	ts.Server.IdleTimeout = 2 * time.Second
+	ts.Start()
+	defer ts.Close()
+	c := ts.Client()
 
 	get := func() string {
 		res, err := c.Get(ts.URL)
@@ -3719,6 +4756,212 @@ func TestServerSetKeepAlivesEnabledClosesConns(t *testing.T) {
 	}
 }
 
+func TestServerMaxConcurrentConns(t *testing.T) {
+	setParallel(t)
+	defer afterTest(t)
+	release := make(chan struct{})
+	served := make(chan string, 2)
+	ts := th.NewUnstartedServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		served <- r.URL.Path
+		if r.URL.Path == "/first" {
+			<-release
+		}
+	}))
+	ts.Server.MaxConcurrentConns = 1
+	ts.Start()
+	defer ts.Close()
+
+	dial := func(path string) net.Conn {
+		conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nHost: foo\r\nConnection: close\r\n\r\n", path)
+		return conn
+	}
+	c1 := dial("/first")
+	defer c1.Close()
+	if got := <-served; got != "/first" {
+		t.Fatalf("served %q first; want /first", got)
+	}
+	c2 := dial("/second")
+	defer c2.Close()
+	select {
+	case got := <-served:
+		t.Fatalf("served %q while the limit was reached", got)
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(release)
+	select {
+	case got := <-served:
+		if got != "/second" {
+			t.Errorf("served %q; want /second", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("second connection not served after the first was closed")
+	}
+	res, err := ReadResponse(bufio.NewReader(c2), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.CloseBody()
+	if res.StatusCode != StatusOK {
+		t.Errorf("status = %d; want %d", res.StatusCode, StatusOK)
+	}
+}
+
+func TestServerMaxConnsGrace(t *testing.T) {
+	setParallel(t)
+	defer afterTest(t)
+	release := make(chan struct{})
+	served := make(chan bool, 1)
+	ts := th.NewUnstartedServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		served <- true
+		<-release
+	}))
+	ts.Server.MaxConcurrentConns = 1
+	ts.Server.MaxConnsGrace = 50 * time.Millisecond
+	ts.Start()
+	defer ts.Close()
+	defer close(release)
+
+	c1, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c1.Close()
+	io.WriteString(c1, "GET / HTTP/1.1\r\nHost: foo\r\n\r\n")
+	<-served
+
+	c2, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c2.Close()
+	c2.SetReadDeadline(time.Now().Add(5 * time.Second))
+	res, err := ReadResponse(bufio.NewReader(c2), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.CloseBody()
+	if res.StatusCode != StatusServiceUnavailable {
+		t.Errorf("status = %d; want %d", res.StatusCode, StatusServiceUnavailable)
+	}
+}
+
+// Connections over the limit wait for a slot concurrently: each one gets
+// its 503 after about MaxConnsGrace, not after the grace of the ones
+// accepted before it.
+func TestServerMaxConnsGraceConcurrent(t *testing.T) {
+	setParallel(t)
+	defer afterTest(t)
+	const grace = 300 * time.Millisecond
+	release := make(chan struct{})
+	served := make(chan bool, 1)
+	ts := th.NewUnstartedServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		served <- true
+		<-release
+	}))
+	ts.Server.MaxConcurrentConns = 1
+	ts.Server.MaxConnsGrace = grace
+	ts.Start()
+	defer ts.Close()
+	defer close(release)
+
+	c1, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c1.Close()
+	io.WriteString(c1, "GET / HTTP/1.1\r\nHost: foo\r\n\r\n")
+	<-served
+
+	start := time.Now()
+	const extra = 3
+	errc := make(chan error, extra)
+	for i := 0; i < extra; i++ {
+		go func() {
+			c, err := net.Dial("tcp", ts.Listener.Addr().String())
+			if err != nil {
+				errc <- err
+				return
+			}
+			defer c.Close()
+			c.SetReadDeadline(time.Now().Add(5 * time.Second))
+			res, err := ReadResponse(bufio.NewReader(c), nil)
+			if err == nil {
+				res.CloseBody()
+				if res.StatusCode != StatusServiceUnavailable {
+					err = fmt.Errorf("status = %d; want %d", res.StatusCode, StatusServiceUnavailable)
+				}
+			}
+			errc <- err
+		}()
+	}
+	for i := 0; i < extra; i++ {
+		if err := <-errc; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d := time.Since(start); d >= extra*grace {
+		t.Errorf("%d rejected connections took %v; want them rejected concurrently, in about %v", extra, d, grace)
+	}
+}
+
+// Shutdown must stop Serve while it waits for a connection slot.
+func TestServerMaxConcurrentConnsShutdown(t *testing.T) {
+	setParallel(t)
+	defer afterTest(t)
+	release := make(chan struct{})
+	served := make(chan bool, 1)
+	srv := &Server{
+		Handler: HandlerFunc(func(w ResponseWriter, r *Request) {
+			served <- true
+			<-release
+		}),
+		MaxConcurrentConns: 1,
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- srv.Serve(ln) }()
+
+	c1, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c1.Close()
+	io.WriteString(c1, "GET / HTTP/1.1\r\nHost: foo\r\nConnection: close\r\n\r\n")
+	<-served
+	c2, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c2.Close()
+
+	shutdownErr := make(chan error, 1)
+	go func() { shutdownErr <- srv.Shutdown(context.Background()) }()
+	select {
+	case err := <-serveErr:
+		if err != ErrServerClosed {
+			t.Errorf("Serve = %v; want ErrServerClosed", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve still waiting for a slot after Shutdown")
+	}
+	close(release)
+	select {
+	case err := <-shutdownErr:
+		if err != nil {
+			t.Errorf("Shutdown = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Shutdown didn't return")
+	}
+}
+
 func TestServerShutdown(t *testing.T) {
 	setParallel(t)
 	defer afterTest(t)
@@ -3760,6 +5003,695 @@ func TestServerShutdown(t *testing.T) {
 	}
 }
 
+func TestServerShutdownListener(t *testing.T) {
+	setParallel(t)
+	defer afterTest(t)
+	srv := &Server{Handler: HandlerFunc(func(w ResponseWriter, r *Request) {
+		io.WriteString(w, "ok")
+	})}
+	defer srv.Close()
+
+	var lns [2]net.Listener
+	var serveErr [2]chan error
+	for i := range lns {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		lns[i] = ln
+		serveErr[i] = make(chan error, 1)
+		go func(i int) { serveErr[i] <- srv.Serve(lns[i]) }(i)
+	}
+
+	c := &cli.Client{Transport: new(Transport)}
+	defer c.Transport.(*Transport).CloseIdleConnections()
+	for _, ln := range lns {
+		if got := get(t, c, "http://"+ln.Addr().String()); got != "ok" {
+			t.Fatalf("got %q; want ok", got)
+		}
+	}
+
+	if err := srv.ShutdownListener(context.Background(), lns[0]); err != nil {
+		t.Fatalf("ShutdownListener: %v", err)
+	}
+	select {
+	case err := <-serveErr[0]:
+		if err != ErrServerClosed {
+			t.Errorf("Serve = %v; want ErrServerClosed", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve on the shut down listener didn't return")
+	}
+	if res, err := c.Get("http://" + lns[0].Addr().String()); err == nil {
+		res.CloseBody()
+		t.Error("request to the shut down listener should fail")
+	}
+
+	if got := get(t, c, "http://"+lns[1].Addr().String()); got != "ok" {
+		t.Errorf("other listener: got %q; want ok", got)
+	}
+	select {
+	case err := <-serveErr[1]:
+		t.Fatalf("Serve on the other listener returned: %v", err)
+	default:
+	}
+
+	if err := srv.ShutdownListener(context.Background(), lns[0]); err == nil {
+		t.Error("second ShutdownListener of the same listener should fail")
+	}
+}
+
+// Test that ShutdownListener stops keep-alives on the connections of the
+// drained listener, so a busy client doesn't keep it waiting.
+func TestServerShutdownListenerActiveConn(t *testing.T) {
+	setParallel(t)
+	defer afterTest(t)
+	entered := make(chan bool, 1)
+	release := make(chan bool)
+	srv := &Server{Handler: HandlerFunc(func(w ResponseWriter, r *Request) {
+		if r.URL.Path == "/slow" {
+			entered <- true
+			<-release
+		}
+		io.WriteString(w, "ok")
+	})}
+	defer srv.Close()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(ln)
+
+	c := &cli.Client{Transport: new(Transport)}
+	defer c.Transport.(*Transport).CloseIdleConnections()
+	url := "http://" + ln.Addr().String()
+	get(t, c, url)
+
+	resc := make(chan *Response, 1)
+	go func() {
+		res, err := c.Get(url + "/slow")
+		if err != nil {
+			t.Error(err)
+		}
+		resc <- res
+	}()
+	<-entered
+	shutc := make(chan error, 1)
+	go func() { shutc <- srv.ShutdownListener(context.Background(), ln) }()
+	time.Sleep(50 * time.Millisecond) // let ShutdownListener mark the conn
+	close(release)
+
+	res := <-resc
+	if res == nil {
+		return
+	}
+	res.CloseBody()
+	if !res.Close {
+		t.Error("response on a draining listener didn't close the connection")
+	}
+	select {
+	case err := <-shutc:
+		if err != nil {
+			t.Errorf("ShutdownListener = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ShutdownListener didn't return")
+	}
+}
+
+func TestServerShutdownListenerTLS(t *testing.T) {
+	setParallel(t)
+	defer afterTest(t)
+	cert, err := tls.X509KeyPair(th.LocalhostCert, th.LocalhostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &Server{
+		Handler:   HandlerFunc(func(w ResponseWriter, r *Request) {}),
+		TLSConfig: &tls.Config{Certificates: []tls.Certificate{cert}},
+	}
+	defer srv.Close()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- srv.ServeTLS(ln, "", "") }()
+
+	if !waitCondition(5*time.Second, 10*time.Millisecond, func() bool {
+		return srv.BoundAddr() != nil
+	}) {
+		t.Fatal("ServeTLS didn't start")
+	}
+	if err := srv.ShutdownListener(context.Background(), ln); err != nil {
+		t.Fatalf("ShutdownListener of the ServeTLS listener: %v", err)
+	}
+	select {
+	case err := <-serveErr:
+		if err != ErrServerClosed {
+			t.Errorf("ServeTLS = %v; want ErrServerClosed", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ServeTLS didn't return")
+	}
+}
+
+// h2cUpgradeRequest is a request asking to upgrade the connection to
+// HTTP/2, with SETTINGS_INITIAL_WINDOW_SIZE = 65535 as HTTP2-Settings.
+const h2cUpgradeRequest = "GET /h2c HTTP/1.1\r\nHost: foo\r\n" +
+	"Connection: Upgrade, HTTP2-Settings\r\nUpgrade: h2c\r\nHTTP2-Settings: AAQAAP__\r\n\r\n"
+
+func TestServerH2CUpgrade(t *testing.T) {
+	setParallel(t)
+	defer afterTest(t)
+	body := strings.Repeat("h2c body ", 20000) // larger than the flow control window
+	ts := th.NewUnstartedServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		if r.Header.Get(hdr.Http2Settings) != "" || r.Header.Get(hdr.UpgradeHeader) != "" {
+			t.Errorf("upgrade headers left in the request: %v", r.Header)
+		}
+		w.Header().Set("X-Proto", r.Proto)
+		w.Header().Set(hdr.ContentType, "text/plain")
+		io.WriteString(w, body)
+	}))
+	ts.Server.EnableH2C = true
+	ts.Start()
+	defer ts.Close()
+
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	if _, err := io.WriteString(conn, h2cUpgradeRequest); err != nil {
+		t.Fatal(err)
+	}
+	br := bufio.NewReader(conn)
+	res, err := ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != StatusSwitchingProtocols || res.Header.Get(hdr.UpgradeHeader) != "h2c" {
+		t.Fatalf("upgrade response = %v %v; want 101 with Upgrade: h2c", res.Status, res.Header)
+	}
+
+	if _, err := io.WriteString(conn, http2.ClientPreface); err != nil {
+		t.Fatal(err)
+	}
+	fr := http2.NewFramer(conn, br)
+	if err := fr.WriteSettings(); err != nil {
+		t.Fatal(err)
+	}
+	var (
+		header   = hdr.Header{}
+		got      bytes.Buffer
+		goAway   bool
+		settings bool
+	)
+	dec := hpack.NewDecoder(4096, func(f hpack.HeaderField) {
+		header.Add(f.Name, f.Value)
+	})
+	for done := false; !done; {
+		f, err := fr.ReadFrame()
+		if err != nil {
+			t.Fatalf("ReadFrame: %v", err)
+		}
+		switch f := f.(type) {
+		case *http2.SettingsFrame:
+			if !f.IsAck() {
+				settings = true
+				fr.WriteSettingsAck()
+			}
+		case *http2.GoAwayFrame:
+			goAway = true
+			if f.LastStreamID != 1 {
+				t.Errorf("GOAWAY last stream = %d; want 1", f.LastStreamID)
+			}
+		case *http2.HeadersFrame:
+			if _, err := dec.Write(f.HeaderBlockFragment()); err != nil {
+				t.Fatal(err)
+			}
+			done = f.StreamEnded()
+		case *http2.DataFrame:
+			got.Write(f.Data())
+			if n := uint32(len(f.Data())); n > 0 {
+				fr.WriteWindowUpdate(0, n)
+				fr.WriteWindowUpdate(1, n)
+			}
+			done = f.StreamEnded()
+		}
+	}
+	if !settings || !goAway {
+		t.Errorf("got SETTINGS %v, GOAWAY %v; want both", settings, goAway)
+	}
+	if got, want := header.Get(":status"), "200"; got != want {
+		t.Errorf(":status = %q; want %q", got, want)
+	}
+	if got, want := header.Get("x-proto"), "HTTP/2.0"; got != want {
+		t.Errorf("handler saw Proto %q; want %q", got, want)
+	}
+	if got.String() != body {
+		t.Errorf("got a %d byte body; want %d bytes", got.Len(), len(body))
+	}
+}
+
+// The response to an upgraded HEAD request is a HEADERS frame ending the
+// stream, without the body the handler wrote.
+func TestServerH2CUpgradeHead(t *testing.T) {
+	setParallel(t)
+	defer afterTest(t)
+	ts := th.NewUnstartedServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		io.WriteString(w, "hello")
+		w.(Flusher).Flush()
+	}))
+	ts.Server.EnableH2C = true
+	ts.Start()
+	defer ts.Close()
+
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	if _, err := io.WriteString(conn, "HEAD"+strings.TrimPrefix(h2cUpgradeRequest, "GET")); err != nil {
+		t.Fatal(err)
+	}
+	br := bufio.NewReader(conn)
+	if _, err := ReadResponse(br, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(conn, http2.ClientPreface); err != nil {
+		t.Fatal(err)
+	}
+	fr := http2.NewFramer(conn, br)
+	if err := fr.WriteSettings(); err != nil {
+		t.Fatal(err)
+	}
+	header := hdr.Header{}
+	dec := hpack.NewDecoder(4096, func(f hpack.HeaderField) {
+		header.Add(f.Name, f.Value)
+	})
+	for {
+		f, err := fr.ReadFrame()
+		if err != nil {
+			t.Fatalf("ReadFrame: %v", err)
+		}
+		if _, ok := f.(*http2.DataFrame); ok {
+			t.Fatal("got a DATA frame in the response to a HEAD")
+		}
+		if f, ok := f.(*http2.HeadersFrame); ok {
+			if _, err := dec.Write(f.HeaderBlockFragment()); err != nil {
+				t.Fatal(err)
+			}
+			if !f.StreamEnded() {
+				t.Error("HEADERS frame of a HEAD response doesn't end the stream")
+			}
+			break
+		}
+	}
+	if got, want := header.Get("content-length"), "5"; got != want {
+		t.Errorf("content-length = %q; want %q", got, want)
+	}
+}
+
+// An invalid setting from the client is a connection error: the server
+// replies with a GOAWAY and gives up on the stream.
+func TestServerH2CInvalidSettings(t *testing.T) {
+	setParallel(t)
+	defer afterTest(t)
+	canceled := make(chan bool, 1)
+	ts := th.NewUnstartedServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		select {
+		case <-r.Context().Done():
+			canceled <- true
+		case <-time.After(5 * time.Second):
+			canceled <- false
+		}
+		io.WriteString(w, "too late")
+	}))
+	ts.Server.EnableH2C = true
+	ts.Start()
+	defer ts.Close()
+
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	if _, err := io.WriteString(conn, h2cUpgradeRequest); err != nil {
+		t.Fatal(err)
+	}
+	br := bufio.NewReader(conn)
+	if _, err := ReadResponse(br, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(conn, http2.ClientPreface); err != nil {
+		t.Fatal(err)
+	}
+	fr := http2.NewFramer(conn, br)
+	if err := fr.WriteSettings(http2.Setting{ID: http2.SettingMaxFrameSize, Val: 0}); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		f, err := fr.ReadFrame()
+		if err != nil {
+			t.Fatalf("ReadFrame: %v; want a GOAWAY with PROTOCOL_ERROR", err)
+		}
+		if f, ok := f.(*http2.GoAwayFrame); ok && f.ErrCode != http2.ErrCodeNo {
+			if f.ErrCode != http2.ErrCodeProtocol {
+				t.Errorf("GOAWAY error code = %v; want %v", f.ErrCode, http2.ErrCodeProtocol)
+			}
+			break
+		}
+		if f, ok := f.(*http2.SettingsFrame); ok && f.IsAck() {
+			t.Fatal("server acknowledged the invalid SETTINGS")
+		}
+	}
+	if !<-canceled {
+		t.Error("request context not canceled after the invalid SETTINGS")
+	}
+}
+
+// Without EnableH2C, or for a client not asking for it, the server
+// sticks to HTTP/1.1.
+func TestServerH2CUpgradeNotEnabled(t *testing.T) {
+	setParallel(t)
+	defer afterTest(t)
+	for _, enable := range []bool{false, true} {
+		ts := th.NewUnstartedServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+			io.WriteString(w, r.Proto)
+		}))
+		ts.Server.EnableH2C = enable
+		ts.Start()
+
+		reqs := []string{"GET / HTTP/1.1\r\nHost: foo\r\n\r\n"}
+		if !enable {
+			reqs = append(reqs, h2cUpgradeRequest)
+		}
+		for _, raw := range reqs {
+			conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			io.WriteString(conn, raw)
+			res, err := ReadResponse(bufio.NewReader(conn), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			slurp, _ := ioutil.ReadAll(io.LimitReader(res.Body, 100))
+			if res.StatusCode != StatusOK || string(slurp) != "HTTP/1.1" {
+				t.Errorf("EnableH2C %v, request %q: got %v %q; want 200 HTTP/1.1", enable, raw, res.Status, slurp)
+			}
+			conn.Close()
+		}
+		ts.Close()
+	}
+}
+
+func TestServerNowFunc(t *testing.T) {
+	setParallel(t)
+	defer afterTest(t)
+	// in a zone other than UTC, to check the Date header is in GMT
+	now := time.Date(2009, time.November, 11, 1, 2, 3, 0, time.FixedZone("EET", 2*3600))
+	cst := newClientServerTest(t, HandlerFunc(func(w ResponseWriter, r *Request) {
+		io.WriteString(w, "ok")
+	}), func(ts *th.TestServer) {
+		ts.Server.NowFunc = func() time.Time { return now }
+	})
+	defer cst.close()
+
+	res, err := cst.c.Get(cst.ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if got, want := res.Header.Get(hdr.Date), "Tue, 10 Nov 2009 23:02:03 GMT"; got != want {
+		t.Errorf("%s = %q; want %q", hdr.Date, got, want)
+	}
+}
+
+func TestServerVerifyContentLength(t *testing.T) {
+	setParallel(t)
+	defer afterTest(t)
+	type result struct {
+		body string
+		err  error
+	}
+	results := make(chan result, 1)
+	ts := th.NewUnstartedServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		results <- result{string(body), err}
+	}))
+	ts.Server.VerifyContentLength = true
+	ts.Start()
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		req      string
+		wantBody string
+		wantErr  error
+	}{
+		{
+			name:     "exact",
+			req:      "POST / HTTP/1.1\r\nHost: e.com\r\nConnection: close\r\nContent-Length: 3\r\n\r\nabc",
+			wantBody: "abc",
+		},
+		{
+			name:     "short",
+			req:      "POST / HTTP/1.1\r\nHost: e.com\r\nContent-Length: 10\r\n\r\nabc",
+			wantBody: "abc",
+			wantErr:  io.ErrUnexpectedEOF,
+		},
+		{
+			name:     "long",
+			req:      "POST / HTTP/1.1\r\nHost: e.com\r\nConnection: close\r\nContent-Length: 3\r\n\r\nabcdef",
+			wantBody: "abc",
+			wantErr:  ErrContentLengthExceeded,
+		},
+	}
+	for _, tt := range tests {
+		cn, err := net.Dial("tcp", ts.Listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(cn, tt.req); err != nil {
+			t.Fatal(err)
+		}
+		if err := cn.(*net.TCPConn).CloseWrite(); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case got := <-results:
+			if got.body != tt.wantBody || got.err != tt.wantErr {
+				t.Errorf("%s: handler read %q, %v; want %q, %v", tt.name, got.body, got.err, tt.wantBody, tt.wantErr)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: timeout waiting for the handler", tt.name)
+		}
+		cn.Close()
+	}
+
+	// Extra bytes sent in a separate write, after the handler read the
+	// declared length from the buffer, are caught too.
+	cn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cn.Close()
+	io.WriteString(cn, "POST / HTTP/1.1\r\nHost: e.com\r\nConnection: close\r\nContent-Length: 3\r\n\r\nabc")
+	time.Sleep(10 * time.Millisecond)
+	io.WriteString(cn, "def")
+	select {
+	case got := <-results:
+		if got.body != "abc" || got.err != ErrContentLengthExceeded {
+			t.Errorf("separate extra bytes: handler read %q, %v; want \"abc\", %v", got.body, got.err, ErrContentLengthExceeded)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("separate extra bytes: timeout waiting for the handler")
+	}
+}
+
+func TestServerRejectLog(t *testing.T) {
+	setParallel(t)
+	defer afterTest(t)
+	type rejection struct {
+		addr, reason string
+		raw          []byte
+	}
+	rejects := make(chan rejection, 1)
+	ts := th.NewUnstartedServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		io.WriteString(w, "ok")
+	}))
+	ts.Server.MaxHeaderBytes = 1 << 10
+	ts.Server.RejectLog = func(addr, reason string, raw []byte) {
+		rejects <- rejection{addr, reason, append([]byte(nil), raw...)}
+	}
+	ts.Start()
+	defer ts.Close()
+
+	tests := []struct {
+		name       string
+		req        string
+		wantStatus string
+		wantReason string // substring, or empty if the request isn't rejected
+	}{
+		{
+			name:       "smuggling",
+			req:        "POST / HTTP/1.1\r\nHost: foo\r\nContent-Length: 3\r\nContent-Length: 30\r\n\r\nabc",
+			wantStatus: "HTTP/1.1 400 Bad Request",
+			wantReason: "multiple Content-Length",
+		},
+		{
+			name:       "bad request line",
+			req:        "GET/HTTP/1.1\r\nHost: foo\r\n\r\n",
+			wantStatus: "HTTP/1.1 400 Bad Request",
+			wantReason: "malformed HTTP request",
+		},
+		{
+			name:       "header too large",
+			req:        "GET / HTTP/1.1\r\nHost: foo\r\nX-Big: " + strings.Repeat("a", 10<<10) + "\r\n\r\n",
+			wantStatus: "HTTP/1.1 431 Request Header Fields Too Large",
+			wantReason: "request header too large",
+		},
+		{
+			name:       "valid",
+			req:        "GET / HTTP/1.1\r\nHost: foo\r\nConnection: close\r\n\r\n",
+			wantStatus: "HTTP/1.1 200 OK",
+		},
+	}
+	for _, tt := range tests {
+		c, err := net.Dial("tcp", ts.Listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		go io.WriteString(c, tt.req)
+		status, err := bufio.NewReader(c).ReadString('\n')
+		c.Close()
+		if err != nil {
+			t.Fatalf("%s: reading the status line: %v", tt.name, err)
+		}
+		if got := strings.TrimSpace(status); got != tt.wantStatus {
+			t.Errorf("%s: status = %q; want %q", tt.name, got, tt.wantStatus)
+		}
+		if tt.wantReason == "" {
+			select {
+			case r := <-rejects:
+				t.Errorf("%s: unexpected rejection %q", tt.name, r.reason)
+			default:
+			}
+			continue
+		}
+		var r rejection
+		select {
+		case r = <-rejects:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: RejectLog not called", tt.name)
+		}
+		if !strings.Contains(r.reason, tt.wantReason) {
+			t.Errorf("%s: reason = %q; want it to contain %q", tt.name, r.reason, tt.wantReason)
+		}
+		if r.addr != c.LocalAddr().String() {
+			t.Errorf("%s: remote address = %q; want %q", tt.name, r.addr, c.LocalAddr())
+		}
+		if len(r.raw) > 4<<10 {
+			t.Errorf("%s: got %d raw bytes; want at most 4KB", tt.name, len(r.raw))
+		}
+		if want := tt.req[:8]; !bytes.HasPrefix(r.raw, []byte(want)) {
+			t.Errorf("%s: raw = %.40q...; want it to start with %q", tt.name, r.raw, want)
+		}
+	}
+}
+
+func TestServerBoundAddr(t *testing.T) {
+	setParallel(t)
+	defer afterTest(t)
+	srv := &Server{Addr: "127.0.0.1:0", Handler: HandlerFunc(func(w ResponseWriter, r *Request) {
+		io.WriteString(w, "ok")
+	})}
+	if addr := srv.BoundAddr(); addr != nil {
+		t.Errorf("BoundAddr before ListenAndServe = %v; want nil", addr)
+	}
+	errc := make(chan error, 1)
+	go func() { errc <- srv.ListenAndServe() }()
+	defer srv.Close()
+
+	var addr net.Addr
+	for deadline := time.Now().Add(5 * time.Second); addr == nil; {
+		select {
+		case err := <-errc:
+			t.Fatalf("ListenAndServe: %v", err)
+		default:
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("BoundAddr still nil after ListenAndServe started")
+		}
+		time.Sleep(time.Millisecond)
+		addr = srv.BoundAddr()
+	}
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok || tcpAddr.Port == 0 {
+		t.Fatalf("BoundAddr = %#v; want a TCP address with a concrete port", addr)
+	}
+	c := &cli.Client{Transport: new(Transport)}
+	defer c.Transport.(*Transport).CloseIdleConnections()
+	if got := get(t, c, "http://"+addr.String()); got != "ok" {
+		t.Errorf("got %q; want ok", got)
+	}
+}
+
+func TestServerActiveConns(t *testing.T) {
+	setParallel(t)
+	defer afterTest(t)
+	inHandler := make(chan struct{})
+	release := make(chan struct{})
+	handler := HandlerFunc(func(w ResponseWriter, r *Request) {
+		inHandler <- struct{}{}
+		<-release
+		io.WriteString(w, "ok")
+	})
+	gotOnShutdown := make(chan struct{})
+	cst := newClientServerTest(t, handler, func(srv *th.TestServer) {
+		srv.Server.RegisterOnShutdown(func() { close(gotOnShutdown) })
+	})
+	defer cst.close()
+	srv := cst.ts.Server
+
+	if n := srv.ActiveConns(); n != 0 {
+		t.Errorf("before any request, ActiveConns = %d; want 0", n)
+	}
+	getc := make(chan string, 1)
+	go func() { getc <- get(t, cst.c, cst.ts.URL) }()
+	<-inHandler
+	if n := srv.ActiveConns(); n != 1 {
+		t.Errorf("during request, ActiveConns = %d; want 1", n)
+	}
+
+	shutdownRes := make(chan error, 1)
+	go func() { shutdownRes <- srv.Shutdown(context.Background()) }()
+	select {
+	case <-gotOnShutdown:
+	case <-time.After(5 * time.Second):
+		t.Fatal("onShutdown callback not called when Shutdown began")
+	}
+	if n := srv.ActiveConns(); n != 1 {
+		t.Errorf("while draining, ActiveConns = %d; want 1", n)
+	}
+
+	close(release)
+	if got := <-getc; got != "ok" {
+		t.Errorf("got %q; want ok", got)
+	}
+	if err := <-shutdownRes; err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if n := srv.ActiveConns(); n != 0 {
+		t.Errorf("after Shutdown, ActiveConns = %d; want 0", n)
+	}
+}
+
 // Issue 17878: tests that we can call Close twice.
 func TestServerCloseDeadlock(t *testing.T) {
 	var s Server
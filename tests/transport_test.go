@@ -8,9 +8,11 @@ package tests
 import (
 	"bufio"
 	"bytes"
+	"compress/flate"
 	"compress/gzip"
 	"context"
 	"crypto/rand"
+	"crypto/sha256"
 	"crypto/tls"
 	"encoding/binary"
 	"errors"
@@ -229,6 +231,170 @@ func TestTransportIdleCacheKeys(t *testing.T) {
 	}
 }
 
+func TestTransportCloseIdleConnectionsForHost(t *testing.T) {
+	defer afterTest(t)
+	entered := make(chan bool, 1)
+	release := make(chan bool)
+	ts1 := th.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		if r.URL.Path == "/slow" {
+			entered <- true
+			<-release
+		}
+		io.WriteString(w, "ts1")
+	}))
+	defer ts1.Close()
+	ts2 := th.NewServer(hostPortHandler)
+	defer ts2.Close()
+	tr := &Transport{}
+	defer tr.CloseIdleConnections()
+	c := &cli.Client{Transport: tr}
+
+	get(t, c, ts1.URL)
+	get(t, c, ts2.URL)
+	if e, g := 2, len(tr.IdleConnKeysForTesting()); e != g {
+		t.Fatalf("expected %d idle conn cache keys; got %d", e, g)
+	}
+
+	// Take ts1's idle conn for a request still in flight while draining.
+	done := make(chan error, 1)
+	go func() {
+		res, err := c.Get(ts1.URL + "/slow")
+		if err == nil {
+			_, err = ioutil.ReadAll(res.Body)
+			res.Body.Close()
+		}
+		done <- err
+	}()
+	<-entered
+
+	tr.CloseIdleConnectionsForHost(ts1.Listener.Addr().String())
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	keys := tr.IdleConnKeysForTesting()
+	if e := []string{"|http|" + ts2.Listener.Addr().String()}; !reflect.DeepEqual(keys, e) {
+		t.Errorf("After CloseIdleConnectionsForHost idle conn cache keys = %q; want %q", keys, e)
+	}
+
+	// New conns to the drained host are pooled again.
+	get(t, c, ts1.URL)
+	if e, g := 2, len(tr.IdleConnKeysForTesting()); e != g {
+		t.Errorf("expected %d idle conn cache keys; got %d", e, g)
+	}
+
+	// Once no conn predating the drain is left, the host is forgotten.
+	tr.CloseIdleConnections()
+	if !waitCondition(time.Second, 10*time.Millisecond, func() bool {
+		return tr.DrainedHostCountForTesting() == 0
+	}) {
+		t.Errorf("drained hosts = %d after closing all conns; want 0", tr.DrainedHostCountForTesting())
+	}
+}
+
+func TestTransportConnAffinity(t *testing.T) {
+	defer afterTest(t)
+	ts := th.NewServer(hostPortHandler)
+	defer ts.Close()
+	c := ts.Client()
+	tr := c.Transport.(*Transport)
+
+	get := func(affinity string) string {
+		req, _ := NewRequest(GET, ts.URL, nil)
+		req = req.WithContext(context.WithValue(req.Context(), ConnAffinityKey{}, affinity))
+		res, err := c.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.CloseBody()
+		return string(body)
+	}
+
+	a1 := get("a")
+	a2 := get("a")
+	b := get("b")
+	if a1 != a2 {
+		t.Errorf("requests with the same affinity used different conns: %q, %q", a1, a2)
+	}
+	if a1 == b {
+		t.Errorf("requests with different affinities shared conn %q", b)
+	}
+	keys := tr.IdleConnKeysForTesting()
+	want := []string{"|http|" + ts.Listener.Addr().String() + "|a", "|http|" + ts.Listener.Addr().String() + "|b"}
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("idle conn keys = %q; want %q", keys, want)
+	}
+}
+
+func TestTransportDialerContextKey(t *testing.T) {
+	defer afterTest(t)
+	ts := th.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		io.WriteString(w, r.URL.String())
+	}))
+	defer ts.Close()
+
+	var mu sync.Mutex
+	var transportDials, overrideDials []string
+	var d net.Dialer
+	tr := &Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			mu.Lock()
+			transportDials = append(transportDials, addr)
+			mu.Unlock()
+			return d.DialContext(ctx, network, addr)
+		},
+	}
+	defer tr.CloseIdleConnections()
+	override := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		mu.Lock()
+		overrideDials = append(overrideDials, addr)
+		mu.Unlock()
+		return d.DialContext(ctx, network, addr)
+	}
+
+	get := func(tr *Transport, target string, withOverride bool) string {
+		req, _ := NewRequest(GET, target, nil)
+		if withOverride {
+			req = req.WithContext(context.WithValue(req.Context(), DialerContextKey{}, override))
+		}
+		res, err := tr.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.CloseBody()
+		body, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(body)
+	}
+
+	addr := ts.Listener.Addr().String()
+	get(tr, ts.URL, true)
+	tr.CloseIdleConnections()
+	get(tr, ts.URL, false)
+	if want := []string{addr}; !reflect.DeepEqual(overrideDials, want) || !reflect.DeepEqual(transportDials, want) {
+		t.Errorf("dials: override %q, transport %q; want %q for each", overrideDials, transportDials, want)
+	}
+
+	// The override also dials the proxy.
+	overrideDials, transportDials = nil, nil
+	pu, _ := url.Parse(ts.URL)
+	ptr := &Transport{Proxy: ProxyURL(pu), DialContext: tr.DialContext}
+	defer ptr.CloseIdleConnections()
+	if got, want := get(ptr, "http://example.com/foo", true), "http://example.com/foo"; got != want {
+		t.Errorf("proxied request URL = %q; want %q", got, want)
+	}
+	if want := []string{addr}; !reflect.DeepEqual(overrideDials, want) || len(transportDials) != 0 {
+		t.Errorf("proxy dials: override %q, transport %q; want %q, none", overrideDials, transportDials, want)
+	}
+}
+
 // Tests that the HTTP transport re-uses connections when a client
 // reads to the end of a response Body without closing it.
 func TestTransportReadToEndReusesConn(t *testing.T) {
@@ -354,6 +520,161 @@ func TestTransportMaxPerHostIdleConns(t *testing.T) {
 	}
 }
 
+func TestTransportMaxConnsPerHost(t *testing.T) {
+	defer afterTest(t)
+	resch := make(chan string)
+	gotReq := make(chan bool, 2)
+	ts := th.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		gotReq <- true
+		w.Write([]byte(<-resch))
+	}))
+	defer ts.Close()
+
+	c := ts.Client()
+	tr := c.Transport.(*Transport)
+	tr.MaxConnsPerHost = 1
+	cacheKey := "|http|" + ts.Listener.Addr().String()
+
+	donech := make(chan string)
+	doReq := func(ctx context.Context) {
+		req, _ := NewRequest(GET, ts.URL, nil)
+		resp, err := c.Do(req.WithContext(ctx))
+		if err != nil {
+			donech <- err.Error()
+			return
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.CloseBody()
+		donech <- string(body)
+	}
+
+	go doReq(context.Background())
+	<-gotReq
+	if g, w := tr.ConnCountForTesting(cacheKey), 1; g != w {
+		t.Errorf("conns after first request = %d; want %d", g, w)
+	}
+
+	// The second request has to wait for the first one's connection.
+	go doReq(context.Background())
+	// The third one gives up waiting.
+	ctx, cancel := context.WithCancel(context.Background())
+	go doReq(ctx)
+	select {
+	case <-gotReq:
+		t.Fatal("request reached the server although the conn limit was hit")
+	case <-time.After(100 * time.Millisecond):
+	}
+	cancel()
+	if got := <-donech; !strings.Contains(got, context.Canceled.Error()) {
+		t.Errorf("canceled request error = %q; want it to mention %q", got, context.Canceled)
+	}
+
+	resch <- "res1"
+	if got := <-donech; got != "res1" {
+		t.Errorf("first response = %q; want res1", got)
+	}
+	<-gotReq
+	if g, w := tr.ConnCountForTesting(cacheKey), 1; g != w {
+		t.Errorf("conns during second request = %d; want %d", g, w)
+	}
+	resch <- "res2"
+	if got := <-donech; got != "res2" {
+		t.Errorf("second response = %q; want res2", got)
+	}
+
+	tr.CloseIdleConnections()
+	if g, w := tr.ConnCountForTesting(cacheKey), 0; g != w {
+		t.Errorf("conns after CloseIdleConnections = %d; want %d", g, w)
+	}
+}
+
+func TestTransportForceConnectionClose(t *testing.T) {
+	defer afterTest(t)
+	ts := th.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		w.Header().Set("X-Saw-Close", fmt.Sprint(r.Close))
+	}))
+	defer ts.Close()
+
+	c := ts.Client()
+	tr := c.Transport.(*Transport)
+	for _, force := range []bool{false, true} {
+		tr.CloseIdleConnections()
+		req, _ := NewRequest(GET, ts.URL, nil)
+		if force {
+			req.ForceConnectionClose()
+		}
+		res, err := c.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ioutil.ReadAll(res.Body)
+		res.CloseBody()
+		if got, want := res.Header.Get("X-Saw-Close"), fmt.Sprint(force); got != want {
+			t.Errorf("force=%v: server saw Connection: close = %s; want %s", force, got, want)
+		}
+		if got := res.WillCloseConnection(); got != force {
+			t.Errorf("force=%v: WillCloseConnection = %v", force, got)
+		}
+		wantIdle := 1
+		if force {
+			wantIdle = 0
+		}
+		if got := tr.IdleConnKeyCountForTesting(); got != wantIdle {
+			t.Errorf("force=%v: idle conn keys = %d; want %d", force, got, wantIdle)
+		}
+	}
+
+	res := &Response{
+		StatusCode:    StatusOK,
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		ContentLength: 0,
+		Header:        hdr.Header{},
+	}
+	res.ForceConnectionClose()
+	var buf bytes.Buffer
+	if err := res.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "\r\nConnection: close\r\n") {
+		t.Errorf("forced-close response written as %q; want a Connection: close header", buf.String())
+	}
+	if !res.WillCloseConnection() {
+		t.Error("WillCloseConnection = false after ForceConnectionClose")
+	}
+}
+
+func TestTransportMaxRequestsPerConn(t *testing.T) {
+	defer afterTest(t)
+	ts := th.NewServer(hostPortHandler)
+	defer ts.Close()
+
+	c := ts.Client()
+	tr := c.Transport.(*Transport)
+	tr.MaxRequestsPerConn = 3
+	cacheKey := "|http|" + ts.Listener.Addr().String()
+
+	var addrs []string
+	for i := 0; i < 7; i++ {
+		addrs = append(addrs, get(t, c, ts.URL))
+		want := []int{(i % 3) + 1}
+		if i%3 == 2 {
+			want = nil // retired
+		}
+		if got := tr.ConnRequestCountForTesting(cacheKey); !reflect.DeepEqual(got, want) {
+			t.Errorf("after request %d, idle conn request counts = %v; want %v", i+1, got, want)
+		}
+	}
+	for i := range addrs {
+		if first := addrs[i-i%3]; addrs[i] != first {
+			t.Errorf("request %d used conn %s; want %s", i+1, addrs[i], first)
+		}
+		if i%3 == 0 && i > 0 && addrs[i] == addrs[i-1] {
+			t.Errorf("request %d reused the retired conn %s", i+1, addrs[i])
+		}
+	}
+}
+
 func TestTransportRemovesDeadIdleConnections(t *testing.T) {
 	setParallel(t)
 	defer afterTest(t)
@@ -591,6 +912,86 @@ func TestTransportHeadChunkedResponse(t *testing.T) {
 	}
 }
 
+func TestTransportStrictHead(t *testing.T) {
+	setParallel(t)
+	defer afterTest(t)
+	ts := th.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		conn, bufrw, err := w.(Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		// Misbehave: send a body along with the HEAD response.
+		bufrw.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nhello")
+		bufrw.Flush()
+	}))
+	defer ts.Close()
+
+	for _, strict := range []bool{false, true} {
+		tr := &Transport{StrictHead: strict}
+		c := &cli.Client{Transport: tr}
+		res, err := c.Head(ts.URL)
+		tr.CloseIdleConnections()
+		if !strict {
+			if err != nil {
+				t.Fatalf("lenient: Head = %v", err)
+			}
+			res.CloseBody()
+			continue
+		}
+		if err == nil {
+			res.CloseBody()
+			t.Fatal("strict: Head succeeded; want error")
+		}
+		herr, ok := err.(*url.Error).Err.(*HeadResponseBodyError)
+		if !ok {
+			t.Fatalf("strict: Head error = %v; want *HeadResponseBodyError", err)
+		}
+		if herr.Buffered != 5 {
+			t.Errorf("Buffered = %d; want 5", herr.Buffered)
+		}
+	}
+}
+
+// Test that StrictHead also reports body bytes the server sends in a
+// separate write after the HEAD response headers.
+func TestTransportStrictHeadLateBody(t *testing.T) {
+	setParallel(t)
+	defer afterTest(t)
+	ts := th.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		conn, bufrw, err := w.(Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		bufrw.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\n")
+		bufrw.Flush()
+		time.Sleep(10 * time.Millisecond)
+		bufrw.WriteString("hello")
+		bufrw.Flush()
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer ts.Close()
+
+	tr := &Transport{StrictHead: true}
+	defer tr.CloseIdleConnections()
+	c := &cli.Client{Transport: tr}
+	res, err := c.Head(ts.URL)
+	if err == nil {
+		res.CloseBody()
+		t.Fatal("Head succeeded; want error for a late body")
+	}
+	herr, ok := err.(*url.Error).Err.(*HeadResponseBodyError)
+	if !ok {
+		t.Fatalf("Head error = %v; want *HeadResponseBodyError", err)
+	}
+	if herr.Buffered != 5 {
+		t.Errorf("Buffered = %d; want 5", herr.Buffered)
+	}
+}
+
 // Test that the modification made to the Request by the RoundTripper is cleaned up
 func TestRoundTripGzip(t *testing.T) {
 	setParallel(t)
@@ -839,6 +1240,52 @@ func TestTransportExpect100Continue(t *testing.T) {
 	}
 }
 
+// A request expecting 100-continue with an empty body must not wait out
+// ExpectContinueTimeout before its write completes.
+func TestTransportExpect100ContinueZeroLength(t *testing.T) {
+	setParallel(t)
+	defer afterTest(t)
+	wrote := make(chan bool)
+	ts := th.NewServer(HandlerFunc(func(rw ResponseWriter, req *Request) {
+		// Only answer once the client is done writing the request, so
+		// a client waiting for 100-continue would stall until its timeout.
+		select {
+		case <-wrote:
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer ts.Close()
+
+	tr := &Transport{ExpectContinueTimeout: time.Hour}
+	defer tr.CloseIdleConnections()
+	c := ts.Client()
+	c.Transport = tr
+
+	var waited int32
+	req, err := NewRequest(PUT, ts.URL, bytes.NewReader(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(hdr.Expect, "100-continue")
+	req = req.WithContext(trc.WithClientTrace(req.Context(), &trc.ClientTrace{
+		Wait100Continue: func() { atomic.StoreInt32(&waited, 1) },
+		WroteRequest:    func(trc.WroteRequestInfo) { close(wrote) },
+	}))
+
+	start := time.Now()
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.CloseBody()
+	if d := time.Since(start); d > 4*time.Second {
+		t.Errorf("request took %v; expected no 100-continue wait", d)
+	}
+	if atomic.LoadInt32(&waited) != 0 {
+		t.Error("Wait100Continue called for a request with no body")
+	}
+}
+
 func TestSocks5Proxy(t *testing.T) {
 	defer afterTest(t)
 	ch := make(chan string, 1)
@@ -1062,23 +1509,104 @@ func TestTransportGzipShort(t *testing.T) {
 	}
 }
 
-// tests that persistent goroutine connections shut down when no longer desired.
-func TestTransportPersistConnLeak(t *testing.T) {
-	// Not parallel: counts goroutines
+// A decoder registered with RegisterDecoder is advertised and used like
+// the gzip one.
+func TestTransportRegisterDecoder(t *testing.T) {
 	defer afterTest(t)
-
-	const numReq = 25
-	gotReqCh := make(chan bool, numReq)
-	unblockCh := make(chan bool, numReq)
+	const testString = "The test string aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
 	ts := th.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
-		gotReqCh <- true
-		<-unblockCh
-		w.Header().Set(hdr.ContentLength, "0")
-		w.WriteHeader(204)
+		var buf bytes.Buffer
+		fw, _ := flate.NewWriter(&buf, flate.DefaultCompression)
+		io.WriteString(fw, testString)
+		fw.Close()
+		if r.Header.Get("X-Short") != "" {
+			w.Header().Set(hdr.ContentEncoding, "deflate")
+			w.Write(buf.Bytes()[:buf.Len()/2])
+			return
+		}
+		if ae := r.Header.Get(hdr.AcceptEncoding); ae != "gzip, deflate" {
+			t.Errorf("Accept-Encoding = %q; want \"gzip, deflate\"", ae)
+			io.WriteString(w, testString)
+			return
+		}
+		w.Header().Set(hdr.ContentEncoding, "deflate")
+		w.Write(buf.Bytes())
 	}))
 	defer ts.Close()
+
 	c := ts.Client()
-	tr := c.Transport.(*Transport)
+	c.Transport.(*Transport).RegisterDecoder("deflate", func(r io.Reader) io.Reader {
+		return flate.NewReader(r)
+	})
+
+	res, err := c.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	res.CloseBody()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != testString {
+		t.Errorf("body = %q; want %q", body, testString)
+	}
+	if !res.Uncompressed {
+		t.Error("Uncompressed = false; want true")
+	}
+	if res.ContentLength != -1 {
+		t.Errorf("ContentLength = %d; want -1", res.ContentLength)
+	}
+	if ce := res.Header.Get(hdr.ContentEncoding); ce != "" {
+		t.Errorf("Content-Encoding = %q; want empty", ce)
+	}
+
+	// A caller-provided Accept-Encoding disables transparent decoding.
+	req, _ := NewRequest(GET, ts.URL, nil)
+	req.Header.Set(hdr.AcceptEncoding, "gzip, deflate")
+	res, err = c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err = ioutil.ReadAll(res.Body)
+	res.CloseBody()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Uncompressed || res.Header.Get(hdr.ContentEncoding) != "deflate" || string(body) == testString {
+		t.Errorf("response was decoded although the caller set Accept-Encoding")
+	}
+
+	// A truncated stream is reported as io.ErrUnexpectedEOF.
+	req, _ = NewRequest(GET, ts.URL, nil)
+	req.Header.Set("X-Short", "1")
+	res, err = c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.CloseBody()
+	if _, err = ioutil.ReadAll(res.Body); err != io.ErrUnexpectedEOF {
+		t.Errorf("ReadAll error = %v; want io.ErrUnexpectedEOF", err)
+	}
+}
+
+// tests that persistent goroutine connections shut down when no longer desired.
+func TestTransportPersistConnLeak(t *testing.T) {
+	// Not parallel: counts goroutines
+	defer afterTest(t)
+
+	const numReq = 25
+	gotReqCh := make(chan bool, numReq)
+	unblockCh := make(chan bool, numReq)
+	ts := th.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		gotReqCh <- true
+		<-unblockCh
+		w.Header().Set(hdr.ContentLength, "0")
+		w.WriteHeader(204)
+	}))
+	defer ts.Close()
+	c := ts.Client()
+	tr := c.Transport.(*Transport)
 
 	n0 := runtime.NumGoroutine()
 
@@ -1559,6 +2087,43 @@ func TestCancelRequestWithChannelBeforeDo(t *testing.T) {
 	}
 }
 
+func TestRequestWithTimeout(t *testing.T) {
+	setParallel(t)
+	defer afterTest(t)
+	unblockc := make(chan bool)
+	ts := th.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		<-unblockc
+	}))
+	defer ts.Close()
+	defer close(unblockc)
+
+	c := ts.Client()
+
+	req, _ := NewRequest(GET, ts.URL, nil)
+	req, cancel := req.WithTimeout(50 * time.Millisecond)
+	defer cancel()
+	if _, ok := req.Context().Deadline(); !ok {
+		t.Fatal("request context has no deadline")
+	}
+	_, err := c.Do(req)
+	ue, ok := err.(*url.Error)
+	if !ok {
+		t.Fatalf("Do error = %#v; want *url.Error", err)
+	}
+	if ue.Err != context.DeadlineExceeded {
+		t.Errorf("Do error = %v; want %v", ue.Err, context.DeadlineExceeded)
+	}
+
+	// A deadline in the past aborts before anything is sent.
+	req, _ = NewRequest(GET, ts.URL, nil)
+	req, cancel = req.WithDeadline(time.Now().Add(-time.Second))
+	defer cancel()
+	_, err = c.Do(req)
+	if ue, ok := err.(*url.Error); !ok || ue.Err != context.DeadlineExceeded {
+		t.Errorf("Do error = %v; want %v wrapped in *url.Error", err, context.DeadlineExceeded)
+	}
+}
+
 // golang.org/issue/3672 -- Client can't close HTTP stream
 // Calling Close on a Response.Body used to just read until EOF.
 // Now it actually closes the TCP connection.
@@ -1631,6 +2196,9 @@ func TestTransportAltProto(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
+	if res.Conn != nil {
+		t.Errorf("Response.Conn = %+v; want nil for a registered protocol", res.Conn)
+	}
 	bodyb, err := ioutil.ReadAll(res.Body)
 	if err != nil {
 		t.Fatal(err)
@@ -1669,6 +2237,42 @@ func TestTransportEmptyMethod(t *testing.T) {
 	}
 }
 
+func TestDumpRequestOutRedacted(t *testing.T) {
+	req, _ := NewRequest(POST, "http://foo.com/", strings.NewReader("body"))
+	req.Header.Set(hdr.Authorization, "Bearer secret-token")
+	req.Header.Set(hdr.CookieHeader, "session=secret-cookie")
+	req.Header.Set("X-Api-Key", "secret-key")
+	req.Header.Set("X-Other", "visible")
+
+	got, err := util.DumpRequestOutRedacted(req, true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dump := string(got)
+	for _, secret := range []string{"secret-token", "secret-cookie"} {
+		if strings.Contains(dump, secret) {
+			t.Errorf("dump contains %q:\n%s", secret, dump)
+		}
+	}
+	for _, want := range []string{"Authorization: REDACTED\r\n", "Cookie: REDACTED\r\n", "X-Api-Key: secret-key\r\n", "X-Other: visible\r\n", "\r\n\r\nbody"} {
+		if !strings.Contains(dump, want) {
+			t.Errorf("dump lacks %q:\n%s", want, dump)
+		}
+	}
+	if v := req.Header.Get(hdr.Authorization); v != "Bearer secret-token" {
+		t.Errorf("request Authorization header changed to %q", v)
+	}
+
+	got, err = util.DumpRequestOutRedacted(req, false, []string{"x-api-key"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dump = string(got)
+	if !strings.Contains(dump, "X-Api-Key: REDACTED\r\n") || !strings.Contains(dump, "Bearer secret-token") {
+		t.Errorf("custom redaction list not applied:\n%s", dump)
+	}
+}
+
 func TestTransportSocketLateBinding(t *testing.T) {
 	setParallel(t)
 	defer afterTest(t)
@@ -1832,6 +2436,132 @@ Content-Length: %d
 	}
 }
 
+func TestTransportHandle1xx(t *testing.T) {
+	setParallel(t)
+	defer afterTest(t)
+	ts := th.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		conn, bufrw, err := w.(Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		bufrw.WriteString("HTTP/1.1 123 Sesame Street\r\nFoo: bar\r\n\r\n")
+		bufrw.WriteString("HTTP/1.1 199 Custom\r\n\r\n")
+		bufrw.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 5\r\nConnection: close\r\n\r\nhello")
+		bufrw.Flush()
+	}))
+	defer ts.Close()
+
+	var codes []int
+	var foo string
+	tr := &Transport{
+		Handle1xx: func(code int, h hdr.Header) error {
+			codes = append(codes, code)
+			if code == 123 {
+				foo = h.Get("Foo")
+			}
+			return nil
+		},
+	}
+	defer tr.CloseIdleConnections()
+	c := &cli.Client{Transport: tr}
+	res, err := c.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != 200 || string(body) != "hello" {
+		t.Errorf("got %d %q; want 200 \"hello\"", res.StatusCode, body)
+	}
+	if want := []int{123, 199}; !reflect.DeepEqual(codes, want) {
+		t.Errorf("Handle1xx codes = %v; want %v", codes, want)
+	}
+	if foo != "bar" {
+		t.Errorf("Foo header = %q; want \"bar\"", foo)
+	}
+
+	abort := errors.New("no informational responses please")
+	tr.Handle1xx = func(int, hdr.Header) error { return abort }
+	res, err = c.Get(ts.URL)
+	if err == nil {
+		res.Body.Close()
+		t.Fatal("expected error from Handle1xx")
+	}
+	if !strings.Contains(err.Error(), abort.Error()) {
+		t.Errorf("error = %v; want it to contain %q", err, abort)
+	}
+}
+
+func TestTransportGot1xxResponseTrace(t *testing.T) {
+	setParallel(t)
+	defer afterTest(t)
+	ts := th.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		conn, bufrw, err := w.(Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		bufrw.WriteString("HTTP/1.1 103 Early Hints\r\nLink: </style.css>; rel=preload; as=style\r\nLink: </script.js>; rel=preload; as=script\r\n\r\n")
+		bufrw.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 5\r\nConnection: close\r\n\r\nhello")
+		bufrw.Flush()
+	}))
+	defer ts.Close()
+
+	tr := &Transport{}
+	defer tr.CloseIdleConnections()
+	c := &cli.Client{Transport: tr}
+
+	var codes []int
+	var links []string
+	req, _ := NewRequest(GET, ts.URL, nil)
+	req = req.WithContext(trc.WithClientTrace(req.Context(), &trc.ClientTrace{
+		Got1xxResponse: func(code int, h hdr.Header) error {
+			codes = append(codes, code)
+			links = append(links, h["Link"]...)
+			return nil
+		},
+	}))
+	res, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != 200 || string(body) != "hello" {
+		t.Errorf("got %d %q; want 200 \"hello\"", res.StatusCode, body)
+	}
+	if want := []int{103}; !reflect.DeepEqual(codes, want) {
+		t.Errorf("Got1xxResponse codes = %v; want %v", codes, want)
+	}
+	wantLinks := []string{"</style.css>; rel=preload; as=style", "</script.js>; rel=preload; as=script"}
+	if !reflect.DeepEqual(links, wantLinks) {
+		t.Errorf("Link headers = %q; want %q", links, wantLinks)
+	}
+
+	abort := errors.New("no early hints please")
+	req, _ = NewRequest(GET, ts.URL, nil)
+	req = req.WithContext(trc.WithClientTrace(req.Context(), &trc.ClientTrace{
+		Got1xxResponse: func(int, hdr.Header) error { return abort },
+	}))
+	res, err = c.Do(req)
+	if err == nil {
+		res.Body.Close()
+		t.Fatal("expected error from Got1xxResponse")
+	}
+	if !strings.Contains(err.Error(), abort.Error()) {
+		t.Errorf("error = %v; want it to contain %q", err, abort)
+	}
+}
+
 func TestProxyFromEnvironment(t *testing.T) {
 	ResetProxyEnv()
 	defer ResetProxyEnv()
@@ -2097,6 +2827,74 @@ func TestTLSServerClosesConnection(t *testing.T) {
 // send future requests on the connection because it's then in a
 // questionable state.
 // golang.org/issue/7569
+func TestResponseReusable(t *testing.T) {
+	setParallel(t)
+	defer afterTest(t)
+	ts := th.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		if r.URL.Path == "/close" {
+			w.Header().Set(hdr.Connection, "close")
+		}
+		io.WriteString(w, "some body")
+	}))
+	defer ts.Close()
+	c := ts.Client()
+
+	get := func(path string) *Response {
+		res, err := c.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	res := get("/")
+	if !res.Reusable() {
+		t.Error("keep-alive response: Reusable = false before reading; want true")
+	}
+	io.Copy(ioutil.Discard, res.Body)
+	res.Body.Close()
+	if !res.Reusable() {
+		t.Error("keep-alive response: Reusable = false after EOF; want true")
+	}
+
+	res = get("/close")
+	io.Copy(ioutil.Discard, res.Body)
+	res.Body.Close()
+	if res.Reusable() {
+		t.Error("Connection: close response: Reusable = true; want false")
+	}
+
+	// Closing the body before EOF gives up the connection.
+	res = get("/")
+	res.Body.Close()
+	if res.Reusable() {
+		t.Error("early closed response: Reusable = true; want false")
+	}
+
+	// The Client's body wrappers report the state of the body they wrap.
+	c.Timeout = time.Minute
+	c.MaxResponseBodyBytes = 1 << 20
+	res = get("/")
+	io.Copy(ioutil.Discard, res.Body)
+	res.Body.Close()
+	if !res.Reusable() {
+		t.Error("wrapped keep-alive response: Reusable = false after EOF; want true")
+	}
+	res = get("/")
+	res.Body.Close()
+	if res.Reusable() {
+		t.Error("wrapped early closed response: Reusable = true; want false")
+	}
+
+	// A body that can't tell is not assumed reusable.
+	res = get("/")
+	res.Body.Close()
+	res.Body = ioutil.NopCloser(strings.NewReader(""))
+	if res.Reusable() {
+		t.Error("unknown body: Reusable = true; want false")
+	}
+}
+
 func TestTransportNoReuseAfterEarlyResponse(t *testing.T) {
 	setParallel(t)
 	defer afterTest(t)
@@ -2351,6 +3149,84 @@ Handler
 	}
 }
 
+func TestTransportShouldRetry(t *testing.T) {
+	defer afterTest(t)
+	ts := th.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {}))
+	defer ts.Close()
+
+	failWrites := errors.New("write refused")
+	var dials int32
+	newTransport := func(shouldRetry func(*Request, int, error) bool) *Transport {
+		return &Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				atomic.AddInt32(&dials, 1)
+				c, err := net.Dial(network, ts.Listener.Addr().String())
+				if err != nil {
+					return nil, err
+				}
+				return &writerFuncConn{
+					Conn: c,
+					write: func(p []byte) (int, error) {
+						return 0, failWrites
+					},
+				}, nil
+			},
+			ShouldRetry: shouldRetry,
+		}
+	}
+
+	// The callback overrides the built-in policy, which never retries
+	// on a fresh connection, but the number of attempts is capped.
+	var attempts []int
+	tr := newTransport(func(req *Request, attempt int, err error) bool {
+		attempts = append(attempts, attempt)
+		return true
+	})
+	defer tr.CloseIdleConnections()
+	req, _ := NewRequest(POST, ts.URL, strings.NewReader("body"))
+	if _, err := tr.RoundTrip(req); err == nil {
+		t.Fatal("expected error")
+	}
+	if len(attempts) != 9 || attempts[0] != 1 || attempts[8] != 9 {
+		t.Errorf("ShouldRetry attempts = %v; want 1 through 9", attempts)
+	}
+	if got := atomic.LoadInt32(&dials); got != 10 {
+		t.Errorf("dials = %d; want 10", got)
+	}
+
+	// Returning false stops after the first attempt.
+	atomic.StoreInt32(&dials, 0)
+	tr2 := newTransport(func(req *Request, attempt int, err error) bool { return false })
+	defer tr2.CloseIdleConnections()
+	req, _ = NewRequest(POST, ts.URL, strings.NewReader("body"))
+	if _, err := tr2.RoundTrip(req); err == nil {
+		t.Fatal("expected error")
+	}
+	if got := atomic.LoadInt32(&dials); got != 1 {
+		t.Errorf("dials = %d; want 1", got)
+	}
+
+	// A body that can't be rewound is never retried, whatever the callback says.
+	atomic.StoreInt32(&dials, 0)
+	called := false
+	tr3 := newTransport(func(req *Request, attempt int, err error) bool {
+		called = true
+		return true
+	})
+	defer tr3.CloseIdleConnections()
+	req, _ = NewRequest(POST, ts.URL, strings.NewReader("body"))
+	req.GetBody = nil
+	if _, err := tr3.RoundTrip(req); err == nil {
+		t.Fatal("expected error")
+	}
+	if called {
+		t.Error("ShouldRetry called for a request whose body can't be rewound")
+	}
+	if got := atomic.LoadInt32(&dials); got != 1 {
+		t.Errorf("dials = %d; want 1", got)
+	}
+}
+
 // Issue 6981
 func TestTransportClosesBodyOnError(t *testing.T) {
 	setParallel(t)
@@ -2437,27 +3313,130 @@ func TestTransportDialTLS(t *testing.T) {
 	}
 }
 
-// Test for issue 8755
-// Ensure that if a proxy returns an error, it is exposed by RoundTrip
-func TestRoundTripReturnsProxyError(t *testing.T) {
-	badProxy := func(*Request) (*url.URL, error) {
-		return nil, errors.New("errorMessage")
-	}
-
-	tr := &Transport{Proxy: badProxy}
+func TestTransportEventLog(t *testing.T) {
+	setParallel(t)
+	defer afterTest(t)
+	wrote := make(chan bool)
+	ts := th.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		// Respond only once the write was reported, to keep the order stable.
+		<-wrote
+		io.WriteString(w, "hello")
+	}))
+	defer ts.Close()
 
-	req, _ := NewRequest(GET, "http://example.com", nil)
+	var (
+		mu     sync.Mutex
+		events []string
+	)
+	req, _ := NewRequest(GET, ts.URL, nil)
+	tr := &Transport{
+		EventLog: func(event string, r *Request) {
+			if r != req {
+				t.Errorf("event %q reported for request %p; want %p", event, r, req)
+			}
+			mu.Lock()
+			events = append(events, event)
+			mu.Unlock()
+			if event == EventWroteRequest {
+				close(wrote)
+			}
+		},
+	}
+	defer tr.CloseIdleConnections()
+	c := &cli.Client{Transport: tr}
 
-	_, err := tr.RoundTrip(req)
+	res, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ioutil.ReadAll(res.Body); err != nil {
+		t.Fatal(err)
+	}
+	res.CloseBody()
 
-	if err == nil {
-		t.Error("Expected proxy error to be returned by RoundTrip")
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{EventDial, EventWroteRequest, EventGotResponse, EventPutIdle}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events = %q; want %q", events, want)
 	}
 }
 
-// tests that putting an idle conn after a call to CloseIdleConns does return it
-func TestTransportCloseIdleConnsThenReturn(t *testing.T) {
-	tr := &Transport{}
+func TestTransportDialTLSContext(t *testing.T) {
+	setParallel(t)
+	defer afterTest(t)
+	ts := th.NewTLSServer(HandlerFunc(func(w ResponseWriter, r *Request) {}))
+	defer ts.Close()
+	c := ts.Client()
+	tr := c.Transport.(*Transport)
+	tr.DialTLS = func(netw, addr string) (net.Conn, error) {
+		t.Error("DialTLS called while DialTLSContext is set")
+		return nil, errors.New("unexpected DialTLS")
+	}
+	type ctxKey struct{}
+	var gotValue interface{}
+	tr.DialTLSContext = func(ctx context.Context, netw, addr string) (net.Conn, error) {
+		gotValue = ctx.Value(ctxKey{})
+		c, err := tls.Dial(netw, addr, tr.TLSClientConfig)
+		if err != nil {
+			return nil, err
+		}
+		return c, c.Handshake()
+	}
+
+	req, _ := NewRequest(GET, ts.URL, nil)
+	req = req.WithContext(context.WithValue(req.Context(), ctxKey{}, "dial-value"))
+	res, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.CloseBody()
+	if gotValue != "dial-value" {
+		t.Errorf("DialTLSContext context value = %v; want %q", gotValue, "dial-value")
+	}
+
+	// A handshake that never completes is abandoned with the request context.
+	tr.CloseIdleConnections()
+	tr.DialTLSContext = func(ctx context.Context, netw, addr string) (net.Conn, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, _ = NewRequest(GET, ts.URL, nil)
+	req = req.WithContext(ctx)
+	start := time.Now()
+	_, err = c.Do(req)
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("canceled dial took %v", d)
+	}
+	uerr, ok := err.(*url.Error)
+	if !ok || uerr.Err != context.DeadlineExceeded {
+		t.Errorf("Do error = %#v; want *url.Error wrapping context.DeadlineExceeded", err)
+	}
+}
+
+// Test for issue 8755
+// Ensure that if a proxy returns an error, it is exposed by RoundTrip
+func TestRoundTripReturnsProxyError(t *testing.T) {
+	badProxy := func(*Request) (*url.URL, error) {
+		return nil, errors.New("errorMessage")
+	}
+
+	tr := &Transport{Proxy: badProxy}
+
+	req, _ := NewRequest(GET, "http://example.com", nil)
+
+	_, err := tr.RoundTrip(req)
+
+	if err == nil {
+		t.Error("Expected proxy error to be returned by RoundTrip")
+	}
+}
+
+// tests that putting an idle conn after a call to CloseIdleConns does return it
+func TestTransportCloseIdleConnsThenReturn(t *testing.T) {
+	tr := &Transport{}
 	wantIdle := func(when string, n int) bool {
 		got := tr.IdleConnCountForTesting("|http|example.com") // key used by PutIdleTestConn
 		if got == n {
@@ -2602,6 +3581,251 @@ func TestTransportContentEncodingCaseInsensitive(t *testing.T) {
 }
 
 // Issue 6574
+func TestWroteRequestTraceByteCounts(t *testing.T) {
+	var got []trc.WroteRequestInfo
+	trace := &trc.ClientTrace{
+		WroteRequest: func(info trc.WroteRequestInfo) { got = append(got, info) },
+	}
+
+	// Fixed length body.
+	req, _ := NewRequest(POST, "http://dummy.tld/", strings.NewReader("hello world"))
+	req = req.WithContext(trc.WithClientTrace(req.Context(), trace))
+	var buf bytes.Buffer
+	if err := req.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	wire := buf.String()
+	headerLen := strings.Index(wire, "\r\n\r\n") + 4
+	if len(got) != 1 {
+		t.Fatalf("WroteRequest called %d times; want 1", len(got))
+	}
+	if got[0].Err != nil || got[0].HeaderBytes != int64(headerLen) || got[0].BodyBytes != 11 {
+		t.Errorf("info = %+v; want HeaderBytes=%d BodyBytes=11", got[0], headerLen)
+	}
+	if int(got[0].HeaderBytes+got[0].BodyBytes) != len(wire) {
+		t.Errorf("counted %d bytes; wrote %d", got[0].HeaderBytes+got[0].BodyBytes, len(wire))
+	}
+
+	// Body failing part way, sent chunked.
+	got = nil
+	bodyErr := errors.New("body broke")
+	body := io.MultiReader(strings.NewReader("12345"), &errorReader{bodyErr})
+	req, _ = NewRequest(POST, "http://dummy.tld/", ioutil.NopCloser(body))
+	req = req.WithContext(trc.WithClientTrace(req.Context(), trace))
+	buf.Reset()
+	if err := req.Write(&buf); err == nil {
+		t.Fatal("expected error writing request")
+	}
+	if len(got) != 1 {
+		t.Fatalf("WroteRequest called %d times; want 1", len(got))
+	}
+	if got[0].Err == nil || got[0].BodyBytes != 5 || got[0].HeaderBytes == 0 {
+		t.Errorf("info = %+v; want an error after 5 body bytes", got[0])
+	}
+}
+
+// The Transport reports WroteRequest once the request is flushed, so an
+// error flushing a request small enough to be buffered shows up in it.
+func TestTransportWroteRequestFlushError(t *testing.T) {
+	defer afterTest(t)
+	writeErr := errors.New("write failed")
+	tr := &Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			failed := make(chan struct{})
+			var once sync.Once
+			return funcConn{
+				read: func([]byte) (int, error) {
+					<-failed
+					return 0, io.EOF
+				},
+				write: func([]byte) (int, error) {
+					once.Do(func() { close(failed) })
+					return 0, writeErr
+				},
+			}, nil
+		},
+	}
+	defer tr.CloseIdleConnections()
+
+	var mu sync.Mutex
+	var got []trc.WroteRequestInfo
+	req, _ := NewRequest(POST, "http://dummy.tld/", strings.NewReader("hello"))
+	req = req.WithContext(trc.WithClientTrace(req.Context(), &trc.ClientTrace{
+		WroteRequest: func(info trc.WroteRequestInfo) {
+			mu.Lock()
+			defer mu.Unlock()
+			got = append(got, info)
+		},
+	}))
+	res, err := tr.RoundTrip(req)
+	if err == nil {
+		res.CloseBody()
+		t.Fatal("RoundTrip succeeded; want the write error")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(got) == 0 {
+		t.Fatal("WroteRequest not called")
+	}
+	for _, info := range got {
+		if info.Err != writeErr || info.HeaderBytes == 0 || info.BodyBytes != 5 {
+			t.Errorf("info = %+v; want Err %v after the header and 5 body bytes", info, writeErr)
+		}
+	}
+}
+
+func TestTransportBodyHash(t *testing.T) {
+	setParallel(t)
+	defer afterTest(t)
+	const body = "some upload body, hashed while it is sent"
+	var mu sync.Mutex
+	var serverSum []byte
+	ts := th.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		h := sha256.New()
+		io.Copy(h, r.Body)
+		mu.Lock()
+		serverSum = h.Sum(nil)
+		mu.Unlock()
+	}))
+	defer ts.Close()
+	c := ts.Client()
+
+	for _, chunk := range []bool{false, true} {
+		var rd io.Reader = strings.NewReader(body)
+		if chunk {
+			rd = ioutil.NopCloser(rd) // hide the length
+		}
+		req, _ := NewRequest(POST, ts.URL, rd)
+		if req.BodyHashSum() != nil {
+			t.Fatal("BodyHashSum without WithBodyHash should be nil")
+		}
+		req = req.WithBodyHash(sha256.New())
+		res, err := c.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.CloseBody()
+		want := sha256.Sum256([]byte(body))
+		if got := req.BodyHashSum(); !bytes.Equal(got, want[:]) {
+			t.Errorf("chunked=%v: BodyHashSum = %x; want %x", chunk, got, want)
+		}
+		mu.Lock()
+		if !bytes.Equal(serverSum, want[:]) {
+			t.Errorf("chunked=%v: server hash = %x; want %x", chunk, serverSum, want)
+		}
+		mu.Unlock()
+	}
+}
+
+func TestTransportTLSNextProtos(t *testing.T) {
+	defer afterTest(t)
+	offered := make(chan []string, 1)
+	ts := th.NewUnstartedServer(HandlerFunc(func(w ResponseWriter, r *Request) {}))
+	ts.TLS = &tls.Config{
+		NextProtos: []string{"x-test", "http/1.1"},
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			offered <- hello.SupportedProtos
+			return nil, nil
+		},
+	}
+	ts.StartTLS()
+	defer ts.Close()
+
+	tests := []struct {
+		nextProtos []string
+		wantOffer  string
+		wantProto  string
+		wantErr    bool
+	}{
+		{nil, "http/1.1", "http/1.1", false},
+		{[]string{}, "", "", false},
+		{[]string{"http/1.1", "x-other"}, "http/1.1,x-other", "http/1.1", false},
+		{[]string{"x-test", "http/1.1"}, "x-test,http/1.1", "", true},
+	}
+	for _, tt := range tests {
+		tr := &Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			TLSNextProtos:   tt.nextProtos,
+		}
+		res, err := (&cli.Client{Transport: tr}).Get(ts.URL)
+		if got := strings.Join(<-offered, ","); got != tt.wantOffer {
+			t.Errorf("TLSNextProtos %q: ClientHello offered %q; want %q", tt.nextProtos, got, tt.wantOffer)
+		}
+		if tt.wantErr {
+			if err == nil {
+				res.CloseBody()
+				t.Errorf("TLSNextProtos %q: Get succeeded; want an unsupported protocol error", tt.nextProtos)
+			} else if !strings.Contains(err.Error(), "unsupported protocol") {
+				t.Errorf("TLSNextProtos %q: error = %v; want an unsupported protocol error", tt.nextProtos, err)
+			}
+		} else if err != nil {
+			t.Errorf("TLSNextProtos %q: %v", tt.nextProtos, err)
+		} else {
+			res.CloseBody()
+			if res.TLS == nil {
+				t.Errorf("TLSNextProtos %q: Response.TLS not set", tt.nextProtos)
+			} else if got := res.TLS.NegotiatedProtocol; got != tt.wantProto {
+				t.Errorf("TLSNextProtos %q: negotiated protocol = %q; want %q", tt.nextProtos, got, tt.wantProto)
+			}
+		}
+		tr.CloseIdleConnections()
+	}
+}
+
+func TestTransportBufferSizes(t *testing.T) {
+	setParallel(t)
+	defer afterTest(t)
+	chunk := strings.Repeat("0123456789", 1000)
+	const chunks = 100
+	ts := th.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		w.Header().Set(hdr.Trailer, "X-Sum")
+		w.Header().Set("X-Some-Rather-Long-Header-Name", strings.Repeat("v", 100))
+		for i := 0; i < chunks; i++ {
+			io.WriteString(w, chunk)
+			w.(Flusher).Flush()
+		}
+		w.Header().Set("X-Sum", "done")
+	}))
+	defer ts.Close()
+
+	writes := 0
+	tr := &Transport{
+		ReadBufferSize:  16, // the bufio minimum
+		WriteBufferSize: 64 << 10,
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			c, err := net.Dial(network, addr)
+			if err == nil {
+				c = &writeCountingConn{c, &writes}
+			}
+			return c, err
+		},
+	}
+	defer tr.CloseIdleConnections()
+	c := &cli.Client{Transport: tr}
+
+	res, err := c.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(body) != chunks*len(chunk) || string(body[:len(chunk)]) != chunk {
+		t.Errorf("read %d bytes; want %d", len(body), chunks*len(chunk))
+	}
+	if got := res.Header.Get("X-Some-Rather-Long-Header-Name"); len(got) != 100 {
+		t.Errorf("long header value of %d bytes; want 100", len(got))
+	}
+	if got := res.Trailer.Get("X-Sum"); got != "done" {
+		t.Errorf("trailer X-Sum = %q; want done", got)
+	}
+	if writes != 1 {
+		t.Errorf("Get request did %d Write calls, want 1", writes)
+	}
+}
+
 func TestTransportFlushesBodyChunks(t *testing.T) {
 	defer afterTest(t)
 	resBody := make(chan io.Reader, 1)
@@ -2632,33 +3856,322 @@ func TestTransportFlushesBodyChunks(t *testing.T) {
 			close(resc)
 			return
 		}
-		resc <- res
+		resc <- res
+
+	}()
+	// Fully consume the request before checking the Write log vs. want.
+	req, err := ReadRequest(bufio.NewReader(connr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(ioutil.Discard, req.Body)
+
+	// Unblock the transport's roundTrip goroutine.
+	resBody <- strings.NewReader("HTTP/1.1 204 No Content\r\nConnection: close\r\n\r\n")
+	res, ok := <-resc
+	if !ok {
+		return
+	}
+	defer res.CloseBody()
+
+	want := []string{
+		"POST / HTTP/1.1\r\nHost: localhost:8080\r\nUser-Agent: x\r\nTransfer-Encoding: chunked\r\nAccept-Encoding: gzip\r\n\r\n" +
+			"5\r\nnum0\n\r\n",
+		"5\r\nnum1\n\r\n",
+		"5\r\nnum2\n\r\n",
+		"0\r\n\r\n",
+	}
+	if !reflect.DeepEqual(lw.writes, want) {
+		t.Errorf("Writes differed.\n Got: %q\nWant: %q\n", lw.writes, want)
+	}
+}
+
+func TestTransportFlushRequestWrites(t *testing.T) {
+	defer afterTest(t)
+	resBody := make(chan io.Reader, 1)
+	connr, connw := io.Pipe() // connection pipe pair
+	lw := &logWritesConn{
+		rch: resBody,
+		w:   connw,
+	}
+	tr := &Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return lw, nil
+		},
+		FlushRequestWrites: true,
+	}
+	bodyr, bodyw := io.Pipe() // body pipe pair
+	go func() {
+		defer bodyw.Close()
+		for i := 0; i < 3; i++ {
+			fmt.Fprintf(bodyw, "num%d\n", i)
+		}
+	}()
+	resc := make(chan *Response)
+	go func() {
+		req, _ := NewRequest(POST, "http://localhost:8080", bodyr)
+		req.ContentLength = 15 // not chunked
+		req.Header.Set(hdr.UserAgent, "x") // known value for test
+		res, err := tr.RoundTrip(req)
+		if err != nil {
+			t.Errorf("RoundTrip: %v", err)
+			close(resc)
+			return
+		}
+		resc <- res
+	}()
+	// Fully consume the request before checking the Write log vs. want.
+	req, err := ReadRequest(bufio.NewReader(connr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(ioutil.Discard, req.Body)
+
+	// Unblock the transport's roundTrip goroutine.
+	resBody <- strings.NewReader("HTTP/1.1 204 No Content\r\nConnection: close\r\n\r\n")
+	res, ok := <-resc
+	if !ok {
+		return
+	}
+	defer res.CloseBody()
+
+	want := []string{
+		"POST / HTTP/1.1\r\nHost: localhost:8080\r\nUser-Agent: x\r\nContent-Length: 15\r\nAccept-Encoding: gzip\r\n\r\n",
+		"num0\n",
+		"num1\n",
+		"num2\n",
+	}
+	if !reflect.DeepEqual(lw.writes, want) {
+		t.Errorf("Writes differed.\n Got: %q\nWant: %q\n", lw.writes, want)
+	}
+}
+
+func TestTransportWriteChunkBytes(t *testing.T) {
+	defer afterTest(t)
+	const chunk = 1000
+	resBody := make(chan io.Reader, 1)
+	connr, connw := io.Pipe() // connection pipe pair
+	lw := &logWritesConn{
+		rch: resBody,
+		w:   connw,
+	}
+	tr := &Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return lw, nil
+		},
+		WriteChunkBytes: chunk,
+	}
+	body := strings.Repeat("x", 10*chunk+123)
+	resc := make(chan *Response)
+	go func() {
+		req, _ := NewRequest(POST, "http://localhost:8080", strings.NewReader(body))
+		res, err := tr.RoundTrip(req)
+		if err != nil {
+			t.Errorf("RoundTrip: %v", err)
+			close(resc)
+			return
+		}
+		resc <- res
+	}()
+	req, err := ReadRequest(bufio.NewReader(connr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != body {
+		t.Errorf("server got a %d byte body; want %d bytes", len(got), len(body))
+	}
+
+	resBody <- strings.NewReader("HTTP/1.1 204 No Content\r\nConnection: close\r\n\r\n")
+	res, ok := <-resc
+	if !ok {
+		return
+	}
+	defer res.CloseBody()
+
+	if len(lw.writes) < len(body)/chunk {
+		t.Errorf("got %d writes; want at least %d", len(lw.writes), len(body)/chunk)
+	}
+	for i, w := range lw.writes {
+		if len(w) > chunk {
+			t.Errorf("write %d is %d bytes; want at most %d", i, len(w), chunk)
+		}
+	}
+}
+
+func TestTransportWriteChunkTimeout(t *testing.T) {
+	defer afterTest(t)
+	var peers []net.Conn
+	var mu sync.Mutex
+	tr := &Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			// The peer never reads, so every write blocks until its deadline.
+			c, peer := net.Pipe()
+			mu.Lock()
+			peers = append(peers, peer)
+			mu.Unlock()
+			return c, nil
+		},
+		WriteChunkBytes:   1000,
+		WriteChunkTimeout: 50 * time.Millisecond,
+	}
+	defer func() {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, c := range peers {
+			c.Close()
+		}
+	}()
+	defer tr.CloseIdleConnections()
+	req, _ := NewRequest(POST, "http://localhost:8080", strings.NewReader(strings.Repeat("x", 1<<20)))
+	errc := make(chan error, 1)
+	go func() {
+		res, err := tr.RoundTrip(req)
+		if err == nil {
+			res.CloseBody()
+		}
+		errc <- err
+	}()
+	select {
+	case err := <-errc:
+		if err == nil {
+			t.Fatal("RoundTrip succeeded; want a write timeout error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("RoundTrip did not time out writing to a peer that stopped reading")
+	}
+}
+
+func TestMultiplexedConn(t *testing.T) {
+	setParallel(t)
+	defer afterTest(t)
+	ts := th.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		conn, bufrw, err := w.(Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		bufrw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: x-mux\r\n\r\n")
+		bufrw.Flush()
+
+		// Read both requests, then answer them in reverse order.
+		type framed struct {
+			id  uint32
+			req *Request
+		}
+		var reqs []framed
+		for len(reqs) < 2 {
+			id, payload, err := ReadFrame(bufrw)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			req, err := ReadRequest(bufio.NewReader(bytes.NewReader(payload)))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			reqs = append(reqs, framed{id, req})
+		}
+		for i := len(reqs) - 1; i >= 0; i-- {
+			body := "reply to " + reqs[i].req.URL.Path
+			res := fmt.Sprintf("HTTP/1.1 200 OK\r\nContent-Length: %d\r\n\r\n%s", len(body), body)
+			if err := WriteFrame(conn, reqs[i].id, []byte(res)); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}))
+	defer ts.Close()
+
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(conn, "GET /mux HTTP/1.1\r\nHost: example.com\r\nConnection: Upgrade\r\nUpgrade: x-mux\r\n\r\n")
+	br := bufio.NewReader(conn)
+	res, err := ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != StatusSwitchingProtocols {
+		t.Fatalf("upgrade status = %d; want %d", res.StatusCode, StatusSwitchingProtocols)
+	}
+	if br.Buffered() != 0 {
+		t.Fatalf("%d unexpected bytes after the upgrade response", br.Buffered())
+	}
+
+	mc := NewMultiplexedConn(conn)
+	defer mc.Close()
+	sent := map[uint32]*Request{}
+	for id, path := range map[uint32]string{7: "/a", 9: "/b"} {
+		req, err := NewRequest(GET, ts.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := mc.Send(id, req); err != nil {
+			t.Fatal(err)
+		}
+		sent[id] = req
+	}
+	if err := mc.Send(7, sent[7]); err == nil {
+		t.Error("Send with a pending ID succeeded")
+	}
+
+	for i := 0; i < 2; i++ {
+		mr, ok := <-mc.Responses()
+		if !ok {
+			t.Fatalf("Responses closed early: %v", mc.Err())
+		}
+		req := sent[mr.ID]
+		if req == nil || mr.Response.Request != req {
+			t.Fatalf("response with ID %d doesn't match a request", mr.ID)
+		}
+		body, err := ioutil.ReadAll(mr.Response.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "reply to " + req.URL.Path; string(body) != want {
+			t.Errorf("ID %d: body = %q; want %q", mr.ID, body, want)
+		}
+		delete(sent, mr.ID)
+	}
 
-	}()
-	// Fully consume the request before checking the Write log vs. want.
-	req, err := ReadRequest(bufio.NewReader(connr))
-	if err != nil {
-		t.Fatal(err)
+	// The server closes the connection after answering.
+	if _, ok := <-mc.Responses(); ok {
+		t.Error("unexpected extra response")
 	}
-	io.Copy(ioutil.Discard, req.Body)
+	if mc.Err() == nil {
+		t.Error("Err = nil after the connection ended")
+	}
+}
 
-	// Unblock the transport's roundTrip goroutine.
-	resBody <- strings.NewReader("HTTP/1.1 204 No Content\r\nConnection: close\r\n\r\n")
-	res, ok := <-resc
-	if !ok {
-		return
+func TestMultiplexedConnFrameTooLarge(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteFrame(&buf, 1, make([]byte, MaxFrameSize+1)); err != ErrFrameTooLarge {
+		t.Errorf("WriteFrame = %v; want ErrFrameTooLarge", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("WriteFrame wrote %d bytes of an oversized frame", buf.Len())
 	}
-	defer res.CloseBody()
 
-	want := []string{
-		"POST / HTTP/1.1\r\nHost: localhost:8080\r\nUser-Agent: x\r\nTransfer-Encoding: chunked\r\nAccept-Encoding: gzip\r\n\r\n" +
-			"5\r\nnum0\n\r\n",
-		"5\r\nnum1\n\r\n",
-		"5\r\nnum2\n\r\n",
-		"0\r\n\r\n",
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	go io.Copy(ioutil.Discard, c2)
+	mc := NewMultiplexedConn(c1)
+	defer mc.Close()
+	req, _ := NewRequest(POST, "http://example.com/", bytes.NewReader(make([]byte, MaxFrameSize)))
+	if err := mc.Send(1, req); err != ErrFrameTooLarge {
+		t.Fatalf("Send = %v; want ErrFrameTooLarge", err)
 	}
-	if !reflect.DeepEqual(lw.writes, want) {
-		t.Errorf("Writes differed.\n Got: %q\nWant: %q\n", lw.writes, want)
+	// The ID is free again and the connection still usable.
+	req, _ = NewRequest(GET, "http://example.com/", nil)
+	if err := mc.Send(1, req); err != nil {
+		t.Errorf("Send after an oversized request = %v", err)
 	}
 }
 
@@ -2720,7 +4233,6 @@ func TestTransportPrefersResponseOverWriteError(t *testing.T) {
 func TestTransportReuseConnEmptyResponseBody(t *testing.T) {
 	defer afterTest(t)
 	cst := newClientServerTest(t, HandlerFunc(func(w ResponseWriter, r *Request) {
-		w.Header().Set("X-Addr", r.RemoteAddr)
 		// Empty response body.
 	}))
 	defer cst.close()
@@ -2734,7 +4246,10 @@ func TestTransportReuseConnEmptyResponseBody(t *testing.T) {
 		if err != nil {
 			log.Fatal(err)
 		}
-		addr := res.Header.Get("X-Addr")
+		if res.Conn == nil {
+			t.Fatalf("On request %d, Response.Conn is nil", i+1)
+		}
+		addr := res.Conn.LocalAddr.String()
 		if i == 0 {
 			firstAddr = addr
 		} else if addr != firstAddr {
@@ -2744,6 +4259,44 @@ func TestTransportReuseConnEmptyResponseBody(t *testing.T) {
 	}
 }
 
+func TestTransportResponseConn(t *testing.T) {
+	setParallel(t)
+	defer afterTest(t)
+	ts := th.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		w.Header().Set("X-Addr", r.RemoteAddr)
+		io.WriteString(w, "hello")
+	}))
+	defer ts.Close()
+	tr := &Transport{}
+	defer tr.CloseIdleConnections()
+	c := &cli.Client{Transport: tr}
+
+	var conns []*ConnInfo
+	for i := 0; i < 2; i++ {
+		res, err := c.Get(ts.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ioutil.ReadAll(res.Body); err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.Conn == nil {
+			t.Fatalf("request %d: Response.Conn is nil", i+1)
+		}
+		if got, want := res.Conn.LocalAddr.String(), res.Header.Get("X-Addr"); got != want {
+			t.Errorf("request %d: LocalAddr = %q; server saw %q", i+1, got, want)
+		}
+		if got, want := res.Conn.RemoteAddr.String(), ts.Listener.Addr().String(); got != want {
+			t.Errorf("request %d: RemoteAddr = %q; want %q", i+1, got, want)
+		}
+		conns = append(conns, res.Conn)
+	}
+	if a, b := conns[0].LocalAddr.String(), conns[1].LocalAddr.String(); a != b {
+		t.Errorf("keep-alive requests used different connections: %q, %q", a, b)
+	}
+}
+
 func TestTransportReuseConnectionGzipChunked(t *testing.T) {
 	testTransportReuseConnectionGzip(t, true)
 }
@@ -2841,6 +4394,63 @@ func TestTransportRejectsAlphaPort(t *testing.T) {
 
 // Test the trace.TLSHandshake{Start,Done} hooks with a https http1
 // connections. The http2 test is done in TestTransportEventTrace_h2
+func TestTransportDNSTrace(t *testing.T) {
+	defer afterTest(t)
+	ts := th.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {}))
+	defer ts.Close()
+	_, port, err := net.SplitHostPort(ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var events []string
+	var startHost string
+	var doneInfo trc.DNSDoneInfo
+	tracer := &trc.ClientTrace{
+		DNSStart: func(info trc.DNSStartInfo) {
+			mu.Lock()
+			defer mu.Unlock()
+			events = append(events, "DNSStart")
+			startHost = info.Host
+		},
+		DNSDone: func(info trc.DNSDoneInfo) {
+			mu.Lock()
+			defer mu.Unlock()
+			events = append(events, "DNSDone")
+			doneInfo = info
+		},
+		GotConn: func(trc.GotConnInfo) {
+			mu.Lock()
+			defer mu.Unlock()
+			events = append(events, "GotConn")
+		},
+	}
+
+	tr := &Transport{}
+	defer tr.CloseIdleConnections()
+	c := &cli.Client{Transport: tr}
+	req, _ := NewRequest(GET, "http://localhost:"+port+"/", nil)
+	req = req.WithContext(trc.WithClientTrace(req.Context(), tracer))
+	res, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.CloseBody()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []string{"DNSStart", "DNSDone", "GotConn"}; !reflect.DeepEqual(events, want) {
+		t.Errorf("events = %q; want %q", events, want)
+	}
+	if startHost != "localhost" {
+		t.Errorf("DNSStart host = %q; want \"localhost\"", startHost)
+	}
+	if doneInfo.Err != nil || len(doneInfo.Addrs) == 0 {
+		t.Errorf("DNSDone = %+v; want resolved addresses", doneInfo)
+	}
+}
+
 func TestTLSHandshakeTrace(t *testing.T) {
 	defer afterTest(t)
 	ts := th.NewTLSServer(HandlerFunc(func(w ResponseWriter, r *Request) {}))
@@ -2886,6 +4496,82 @@ func TestTLSHandshakeTrace(t *testing.T) {
 	}
 }
 
+func TestTransportWroteHeaderFields(t *testing.T) {
+	defer afterTest(t)
+	ts := th.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {}))
+	defer ts.Close()
+
+	var got []hdr.KV
+	req, _ := NewRequest(GET, ts.URL, nil)
+	req.Header.Set(hdr.UserAgent, "x")
+	req.Header.Set("X-Foo", "bar")
+	req = req.WithContext(trc.WithClientTrace(req.Context(), &trc.ClientTrace{
+		WroteHeaderFields: func(fields []hdr.KV) {
+			got = fields
+		},
+	}))
+	res, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.CloseBody()
+
+	want := []hdr.KV{
+		{Key: hdr.Host, Value: strings.TrimPrefix(ts.URL, "http://")},
+		{Key: hdr.UserAgent, Value: "x"},
+		{Key: "X-Foo", Value: "bar"},
+		{Key: hdr.AcceptEncoding, Value: "gzip"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("WroteHeaderFields got %q; want %q", got, want)
+	}
+}
+
+func TestTransportConnReusedTrace(t *testing.T) {
+	setParallel(t)
+	defer afterTest(t)
+	ts := th.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer ts.Close()
+	c := ts.Client()
+
+	var infos []trc.ReusedConnInfo
+	var gotConns int
+	for i := 0; i < 3; i++ {
+		req, _ := NewRequest(GET, ts.URL, nil)
+		req = req.WithContext(trc.WithClientTrace(req.Context(), &trc.ClientTrace{
+			GotConn:    func(trc.GotConnInfo) { gotConns++ },
+			ConnReused: func(info trc.ReusedConnInfo) { infos = append(infos, info) },
+		}))
+		res, err := c.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(ioutil.Discard, res.Body)
+		res.Body.Close()
+		time.Sleep(10 * time.Millisecond)
+	}
+	if gotConns != 3 {
+		t.Fatalf("GotConn called %d times; want 3", gotConns)
+	}
+	// The first request dials; the others come from the idle pool.
+	if len(infos) != 2 {
+		t.Fatalf("ConnReused called %d times; want 2", len(infos))
+	}
+	for i, info := range infos {
+		if info.Conn == nil || !info.Reused || !info.WasIdle {
+			t.Errorf("info[%d] = %+v; want reused idle conn", i, info)
+		}
+		if info.IdleTime <= 0 {
+			t.Errorf("info[%d].IdleTime = %v; want > 0", i, info.IdleTime)
+		}
+		if info.IdleConns != 0 {
+			t.Errorf("info[%d].IdleConns = %d; want 0", i, info.IdleConns)
+		}
+	}
+}
+
 func TestTransportIdleConnTimeout(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping in short mode")
@@ -2943,6 +4629,90 @@ func TestTransportIdleConnTimeout(t *testing.T) {
 	}
 }
 
+func TestTransportStats(t *testing.T) {
+	defer afterTest(t)
+	cst := newClientServerTest(t, HandlerFunc(func(w ResponseWriter, r *Request) {
+		// No body for convenience.
+	}))
+	defer cst.close()
+	tr := cst.tr
+	defer tr.CloseIdleConnections()
+	c := &cli.Client{Transport: tr}
+
+	get := func() {
+		res, err := c.Get(cst.ts.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.CloseBody()
+	}
+	for i := 0; i < 3; i++ {
+		get()
+	}
+	if got, want := tr.Stats(), (TransportStats{Dials: 1, Reuses: 2}); got != want {
+		t.Errorf("after 3 requests, Stats = %+v; want %+v", got, want)
+	}
+	tr.CloseIdleConnections()
+	if got, want := tr.Stats(), (TransportStats{Dials: 1, Reuses: 2, IdleCloses: 1}); got != want {
+		t.Errorf("after CloseIdleConnections, Stats = %+v; want %+v", got, want)
+	}
+
+	tr.ResetStats()
+	if got := tr.Stats(); got != (TransportStats{}) {
+		t.Errorf("after ResetStats, Stats = %+v; want zero", got)
+	}
+
+	tr.IdleConnTimeout = 50 * time.Millisecond
+	get()
+	deadline := time.Now().Add(5 * time.Second)
+	for tr.Stats().IdleTimeouts == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got, want := tr.Stats(), (TransportStats{Dials: 1, IdleTimeouts: 1}); got != want {
+		t.Errorf("after idle timeout, Stats = %+v; want %+v", got, want)
+	}
+}
+
+func TestTransportIdleConnTimeoutForHost(t *testing.T) {
+	defer afterTest(t)
+	h := HandlerFunc(func(w ResponseWriter, r *Request) {})
+	fast := th.NewServer(h)
+	defer fast.Close()
+	slow := th.NewServer(h)
+	defer slow.Close()
+
+	const timeout = 100 * time.Millisecond
+	tr := &Transport{
+		IdleConnTimeout: time.Hour,
+		IdleConnTimeoutForHost: map[string]time.Duration{
+			fast.Listener.Addr().String(): timeout,
+		},
+	}
+	defer tr.CloseIdleConnections()
+	c := &cli.Client{Transport: tr}
+	for _, u := range []string{fast.URL, slow.URL} {
+		res, err := c.Get(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ioutil.ReadAll(res.Body)
+		res.CloseBody()
+	}
+	if got := tr.IdleConnStrsForTesting(); len(got) != 2 {
+		t.Fatalf("idle conns = %q; want 2", got)
+	}
+
+	var got []string
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(timeout / 2) {
+		if got = tr.IdleConnStrsForTesting(); len(got) < 2 {
+			break
+		}
+	}
+	if len(got) != 1 || !strings.HasSuffix(got[0], "/"+slow.Listener.Addr().String()) {
+		t.Errorf("idle conns = %q; want only the one to %s", got, slow.Listener.Addr())
+	}
+}
+
 // Issue 16465: Transport.RoundTrip should return the raw net.Conn.Read error from Peek
 // back to the caller.
 func TestTransportReturnsPeekError(t *testing.T) {
@@ -3016,3 +4786,137 @@ func TestTransportProxyConnectHeader(t *testing.T) {
 		}
 	}
 }
+
+// The credentials of the proxy URL are sent to the proxy, in CONNECT and
+// absolute-form requests, but not to the origin server.
+func TestTransportProxyAuthorization(t *testing.T) {
+	defer afterTest(t)
+	const wantAuth = "Basic YWxpY2U6czNjcmV0" // alice:s3cret
+	originAuth := make(chan string, 1)
+	origin := th.NewTLSServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		originAuth <- r.Header.Get(ProxyAuthorization)
+	}))
+	defer origin.Close()
+	proxyAuth := make(chan string, 2)
+	proxy := th.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		proxyAuth <- r.Method + " " + r.Header.Get(ProxyAuthorization)
+		if r.Method != CONNECT {
+			io.WriteString(w, "proxied")
+			return
+		}
+		upstream, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			t.Errorf("dialing %s: %v", r.Host, err)
+			return
+		}
+		conn, brw, err := w.(Hijacker).Hijack()
+		if err != nil {
+			upstream.Close()
+			t.Errorf("Hijack: %v", err)
+			return
+		}
+		io.WriteString(conn, "HTTP/1.1 200 OK\r\n\r\n")
+		go func() {
+			io.Copy(upstream, brw)
+			upstream.Close()
+		}()
+		io.Copy(conn, upstream)
+		conn.Close()
+	}))
+	defer proxy.Close()
+
+	pu, err := url.Parse(proxy.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pu.User = url.UserPassword("alice", "s3cret")
+	c := origin.Client()
+	tr := c.Transport.(*Transport)
+	tr.Proxy = ProxyURL(pu)
+	tr.DisableKeepAlives = true
+
+	res, err := c.Get(origin.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.CloseBody()
+	if got, want := <-proxyAuth, CONNECT+" "+wantAuth; got != want {
+		t.Errorf("proxy got %q; want %q", got, want)
+	}
+	if got := <-originAuth; got != "" {
+		t.Errorf("origin server got Proxy-Authorization %q; want none", got)
+	}
+
+	res, err = c.Get("http://origin.tld/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.CloseBody()
+	if got, want := <-proxyAuth, GET+" "+wantAuth; got != want {
+		t.Errorf("proxy got %q; want %q", got, want)
+	}
+}
+
+func TestTransportGetProxyConnectHeader(t *testing.T) {
+	defer afterTest(t)
+	reqc := make(chan *Request, 1)
+	ts := th.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		if r.Method != CONNECT {
+			t.Errorf("method = %q; want CONNECT", r.Method)
+		}
+		reqc <- r
+		c, _, err := w.(Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("Hijack: %v", err)
+			return
+		}
+		c.Close()
+	}))
+	defer ts.Close()
+
+	c := ts.Client()
+	tr := c.Transport.(*Transport)
+	tr.Proxy = func(r *Request) (*url.URL, error) {
+		return url.Parse(ts.URL)
+	}
+	tr.ProxyConnectHeader = hdr.Header{
+		"Static": {"ignored"},
+	}
+	tr.GetProxyConnectHeader = func(ctx context.Context, proxyURL *url.URL, target string) (hdr.Header, error) {
+		if proxyURL.String() != ts.URL {
+			t.Errorf("proxyURL = %q; want %q", proxyURL, ts.URL)
+		}
+		if target == "fail.tld:443" {
+			return nil, errors.New("no token for target")
+		}
+		return hdr.Header{
+			hdr.UserAgent: {"foo"},
+			"Token":       {target},
+		}, nil
+	}
+
+	res, err := c.Get("https://dummy.tld/") // https to force a CONNECT
+	if err == nil {
+		res.CloseBody()
+		t.Errorf("unexpected success")
+	}
+	select {
+	case <-time.After(3 * time.Second):
+		t.Fatal("timeout")
+	case r := <-reqc:
+		if got, want := r.Header.Get(hdr.UserAgent), "foo"; got != want {
+			t.Errorf("CONNECT request User-Agent = %q; want %q", got, want)
+		}
+		if got, want := r.Header.Get("Token"), "dummy.tld:443"; got != want {
+			t.Errorf("CONNECT request Token = %q; want %q", got, want)
+		}
+		if got := r.Header.Get("Static"); got != "" {
+			t.Errorf("CONNECT request Static = %q; want ProxyConnectHeader to be ignored", got)
+		}
+	}
+
+	_, err = c.Get("https://fail.tld/")
+	if ue, ok := err.(*url.Error); !ok || ue.Err == nil || ue.Err.Error() != "no token for target" {
+		t.Errorf("Get error = %#v; want *url.Error wrapping the callback's error", err)
+	}
+}
@@ -112,6 +112,12 @@ type (
 		count   int
 		off     int
 	}
+
+	// memIdempotencyStore is an in-memory IdempotencyStore.
+	memIdempotencyStore struct {
+		mu sync.Mutex
+		m  map[string]*RecordedResponse
+	}
 )
 
 var (
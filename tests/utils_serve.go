@@ -311,3 +311,19 @@ func get(t *testing.T, c *cli.Client, url string) string {
 	}
 	return string(slurp)
 }
+
+func (s *memIdempotencyStore) Get(key string) (*RecordedResponse, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	resp, ok := s.m[key]
+	return resp, ok
+}
+
+func (s *memIdempotencyStore) Put(key string, resp *RecordedResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.m == nil {
+		s.m = make(map[string]*RecordedResponse)
+	}
+	s.m[key] = resp
+}
@@ -127,6 +127,10 @@ func (c funcConn) Write(p []byte) (int, error) { return c.write(p) }
 
 func (c funcConn) Close() error { return nil }
 
+func (c funcConn) LocalAddr() net.Addr { return nil }
+
+func (c funcConn) RemoteAddr() net.Addr { return nil }
+
 func (c *logWritesConn) Write(p []byte) (n int, err error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -143,6 +147,10 @@ func (c *logWritesConn) Read(p []byte) (n int, err error) {
 
 func (c *logWritesConn) Close() error { return nil }
 
+func (c *logWritesConn) LocalAddr() net.Addr { return nil }
+
+func (c *logWritesConn) RemoteAddr() net.Addr { return nil }
+
 // some tests use this to manage raw tcp connections for later inspection
 func makeTestDial(t *testing.T) (*testConnSet, func(ctx context.Context, network, addr string) (net.Conn, error)) {
 	connSet := &testConnSet{
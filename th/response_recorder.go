@@ -95,6 +95,13 @@ func (rw *ResponseRecorder) Flush() {
 	rw.Flushed = true
 }
 
+// SetTrailer sets the trailer key to value, the same way as setting the
+// TrailerPrefix prefixed key in the Header map. Result returns it in the
+// Response's Trailer.
+func (rw *ResponseRecorder) SetTrailer(key, value string) {
+	rw.Header()[TrailerPrefix+hdr.CanonicalHeaderKey(key)] = []string{value}
+}
+
 // Result returns the response generated by the handler.
 //
 // The returned Response will have at least its StatusCode,
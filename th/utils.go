@@ -8,6 +8,7 @@ package th
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"crypto/tls"
 	"fmt"
 	"io"
@@ -15,6 +16,7 @@ import (
 	"net"
 	"strconv"
 	"strings"
+	"time"
 
 	. "github.com/badu/http"
 	"github.com/badu/http/hdr"
@@ -96,6 +98,16 @@ func NewTRequest(method, target string, body io.Reader) *Request {
 	return req
 }
 
+// NewTRequestCtx is like NewTRequest, but the context of the returned
+// Request expires after timeout.
+func NewTRequestCtx(method, target string, body io.Reader, timeout time.Duration) *Request {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	// There's no way to hand cancel to the caller: the context is
+	// released by its own timer, once the timeout expires.
+	_ = cancel
+	return NewTRequest(method, target, body).WithContext(ctx)
+}
+
 // NewRecorder returns an initialized ResponseRecorder.
 func NewRecorder() *ResponseRecorder {
 	return &ResponseRecorder{
@@ -6,6 +6,7 @@
 package http
 
 import (
+	"context"
 	"io"
 	"time"
 
@@ -21,8 +22,25 @@ func (h *timeoutHandler) errorBody() string {
 
 func (h *timeoutHandler) ServeHTTP(w ResponseWriter, r *Request) {
 	var t *time.Timer
+	// deadline is closed when the request context given to the handler
+	// expires; it stays nil unless withContext is set.
+	var deadline <-chan struct{}
 	timeout := h.testTimeout
-	if timeout == nil {
+	if h.withContext {
+		var ctx context.Context
+		var cancelCtx context.CancelFunc
+		if timeout == nil {
+			// Time out on the context itself, so the handler always
+			// observes context.DeadlineExceeded once it timed out.
+			ctx, cancelCtx = context.WithTimeout(r.Context(), h.dt)
+			deadline = ctx.Done()
+		} else {
+			ctx, cancelCtx = context.WithCancel(r.Context())
+		}
+		defer cancelCtx()
+		r = r.WithContext(ctx)
+	}
+	if timeout == nil && deadline == nil {
 		t = time.NewTimer(h.dt)
 		timeout = t.C
 	}
@@ -37,6 +55,13 @@ func (h *timeoutHandler) ServeHTTP(w ResponseWriter, r *Request) {
 	}()
 	select {
 	case <-done:
+		select {
+		case <-deadline:
+			// The handler gave up on its expired context.
+			h.timeOut(w, timeOutWriter)
+			return
+		default:
+		}
 		timeOutWriter.mu.Lock()
 		defer timeOutWriter.mu.Unlock()
 		dst := w.Header()
@@ -52,11 +77,18 @@ func (h *timeoutHandler) ServeHTTP(w ResponseWriter, r *Request) {
 			t.Stop()
 		}
 	case <-timeout:
-		timeOutWriter.mu.Lock()
-		defer timeOutWriter.mu.Unlock()
-		w.WriteHeader(StatusServiceUnavailable)
-		io.WriteString(w, h.errorBody())
-		timeOutWriter.timedOut = true
-		return
+		h.timeOut(w, timeOutWriter)
+	case <-deadline:
+		h.timeOut(w, timeOutWriter)
 	}
 }
+
+// timeOut replies to w with the error body once the handler writing to
+// tw ran out of time.
+func (h *timeoutHandler) timeOut(w ResponseWriter, tw *timeoutWriter) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	w.WriteHeader(StatusServiceUnavailable)
+	io.WriteString(w, h.errorBody())
+	tw.timedOut = true
+}
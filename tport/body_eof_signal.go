@@ -53,3 +53,17 @@ func (es *bodyEOFSignal) condfn(err error) error {
 	es.fn = nil
 	return err
 }
+
+// Reusable reports whether the connection goes back to the idle pool:
+// it must be kept alive and the body must not fail or be closed before EOF.
+func (es *bodyEOFSignal) Reusable() bool {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	if !es.keepAlive {
+		return false
+	}
+	if es.rerr != nil {
+		return es.rerr == io.EOF
+	}
+	return !es.closed
+}
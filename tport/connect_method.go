@@ -37,9 +37,10 @@ func (m *connectMethod) key() connectMethodKey {
 		}
 	}
 	return connectMethodKey{
-		proxy:  proxyStr,
-		scheme: m.targetScheme,
-		addr:   targetAddr,
+		proxy:    proxyStr,
+		scheme:   m.targetScheme,
+		addr:     targetAddr,
+		affinity: m.affinity,
 	}
 }
 
@@ -50,7 +51,7 @@ func (m *connectMethod) Key() connectMethodKey {
 
 //TODO : @badu - exported because tests / "exported function with unexported return type"
 func NewConnectMethod(proxy *url.URL, scheme, addr string) connectMethod {
-	return connectMethod{proxy, scheme, addr}
+	return connectMethod{proxyURL: proxy, targetScheme: scheme, targetAddr: addr}
 }
 
 // addr returns the first hop "host:port" to which we need to TCP connect.
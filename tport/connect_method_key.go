@@ -5,9 +5,25 @@
 
 package tport
 
-import "fmt"
+import (
+	"fmt"
+	"net"
+)
 
 func (k connectMethodKey) String() string {
 	// Only used by tests.
+	if k.affinity != "" {
+		return fmt.Sprintf("%s|%s|%s|%s", k.proxy, k.scheme, k.addr, k.affinity)
+	}
 	return fmt.Sprintf("%s|%s|%s", k.proxy, k.scheme, k.addr)
 }
+
+// matchesHost reports whether the key's address is host, given either
+// as "host:port" or as a bare host name matching any port.
+func (k connectMethodKey) matchesHost(host string) bool {
+	if k.addr == host {
+		return true
+	}
+	h, _, err := net.SplitHostPort(k.addr)
+	return err == nil && h == host
+}
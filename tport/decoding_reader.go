@@ -0,0 +1,31 @@
+/*
+ * Copyright (c) 2018 The Go Authors. All rights reserved.
+ * Use of this source code is governed by a BSD-style license that can be found in the LICENSE file.
+ */
+
+package tport
+
+func (dr *decodingReader) Read(p []byte) (n int, err error) {
+	if dr.r == nil {
+		dr.r = dr.newReader(dr.body)
+	}
+
+	dr.body.mu.Lock()
+	if dr.body.closed {
+		err = errReadOnClosedResBody
+	}
+	dr.body.mu.Unlock()
+
+	if err != nil {
+		return 0, err
+	}
+	return dr.r.Read(p)
+}
+
+func (dr *decodingReader) Close() error {
+	return dr.body.Close()
+}
+
+func (dr *decodingReader) Reusable() bool {
+	return dr.body.Reusable()
+}
@@ -0,0 +1,60 @@
+/*
+ * Copyright (c) 2018 The Go Authors. All rights reserved.
+ * Use of this source code is governed by a BSD-style license that can be found in the LICENSE file.
+ */
+
+package tport
+
+import (
+	"context"
+	"net"
+)
+
+// lookup resolves host, joining a lookup of the same host already in
+// flight, in which case coalesced is true. The shared lookup is not
+// bound to the ctx of the caller that started it, so that this caller
+// giving up does not fail the others sharing it; instead it is canceled
+// once every caller waiting for it gave up, so that their cancellation
+// and deadlines still stop it.
+func (g *dnsLookupGroup) lookup(ctx context.Context, host string) (addrs []net.IPAddr, coalesced bool, err error) {
+	g.mu.Lock()
+	c, coalesced := g.calls[host]
+	if !coalesced {
+		lookupCtx, cancel := context.WithCancel(context.Background())
+		c = &dnsLookupCall{done: make(chan struct{}), cancel: cancel}
+		g.calls[host] = c
+		go g.resolve(lookupCtx, c, host)
+	}
+	c.waiters++
+	g.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return c.addrs, coalesced, c.err
+	case <-ctx.Done():
+		g.mu.Lock()
+		c.waiters--
+		if c.waiters == 0 {
+			// Nobody wants the result anymore: stop the lookup, and
+			// don't let a new caller join it.
+			c.cancel()
+			if g.calls[host] == c {
+				delete(g.calls, host)
+			}
+		}
+		g.mu.Unlock()
+		return nil, coalesced, ctx.Err()
+	}
+}
+
+// resolve performs the lookup of c, then releases its waiters.
+func (g *dnsLookupGroup) resolve(ctx context.Context, c *dnsLookupCall, host string) {
+	c.addrs, c.err = net.DefaultResolver.LookupIPAddr(ctx, host)
+	c.cancel()
+	g.mu.Lock()
+	if g.calls[host] == c {
+		delete(g.calls, host)
+	}
+	g.mu.Unlock()
+	close(c.done)
+}
@@ -32,3 +32,7 @@ func (gz *gzipReader) Read(p []byte) (n int, err error) {
 func (gz *gzipReader) Close() error {
 	return gz.body.Close()
 }
+
+func (gz *gzipReader) Reusable() bool {
+	return gz.body.Reusable()
+}
@@ -0,0 +1,12 @@
+/*
+ * Copyright (c) 2018 The Go Authors. All rights reserved.
+ * Use of this source code is governed by a BSD-style license that can be found in the LICENSE file.
+ */
+
+package tport
+
+import "fmt"
+
+func (e *HeadResponseBodyError) Error() string {
+	return fmt.Sprintf("github.com/badu/http/tport: server sent %d body bytes in response to HEAD", e.Buffered)
+}
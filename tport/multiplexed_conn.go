@@ -0,0 +1,107 @@
+/*
+ * Copyright (c) 2018 The Go Authors. All rights reserved.
+ * Use of this source code is governed by a BSD-style license that can be found in the LICENSE file.
+ */
+
+package tport
+
+import (
+	"bufio"
+	"bytes"
+
+	. "github.com/badu/http"
+)
+
+// Send writes req, body included, in a frame carrying id. The response
+// is delivered on Responses with the same ID. It's an error to reuse an
+// id while its response is pending. A request that doesn't fit in
+// MaxFrameSize fails with ErrFrameTooLarge, leaving the connection usable.
+func (mc *MultiplexedConn) Send(id uint32, req *Request) error {
+	mc.mu.Lock()
+	if mc.err != nil {
+		err := mc.err
+		mc.mu.Unlock()
+		return err
+	}
+	if _, ok := mc.pending[id]; ok {
+		mc.mu.Unlock()
+		return errMultiplexedIDPending
+	}
+	mc.pending[id] = req
+	mc.mu.Unlock()
+
+	var buf bytes.Buffer
+	err := req.Write(&buf)
+	if err == nil {
+		mc.wmu.Lock()
+		err = WriteFrame(mc.conn, id, buf.Bytes())
+		mc.wmu.Unlock()
+	}
+	if err != nil {
+		mc.mu.Lock()
+		delete(mc.pending, id)
+		mc.mu.Unlock()
+	}
+	return err
+}
+
+// Responses returns the channel the responses are delivered on. It is
+// closed once the connection fails or is closed, see Err.
+func (mc *MultiplexedConn) Responses() <-chan MultiplexedResponse { return mc.responses }
+
+// Err returns the error that ended the connection, if any.
+func (mc *MultiplexedConn) Err() error {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	return mc.err
+}
+
+// Close closes the connection.
+func (mc *MultiplexedConn) Close() error {
+	err := errMultiplexedConnClosed
+	mc.closeOnce.Do(func() {
+		mc.fail(errMultiplexedConnClosed)
+		close(mc.closed)
+		err = mc.conn.Close()
+	})
+	return err
+}
+
+// fail records err as the sticky error of the connection, unless there
+// is one already.
+func (mc *MultiplexedConn) fail(err error) {
+	mc.mu.Lock()
+	if mc.err == nil {
+		mc.err = err
+	}
+	mc.mu.Unlock()
+}
+
+// readLoop reads the frames of the peer and delivers the responses until
+// the connection fails or is closed.
+func (mc *MultiplexedConn) readLoop() {
+	defer close(mc.responses)
+	for {
+		id, payload, err := ReadFrame(mc.br)
+		if err != nil {
+			mc.fail(err)
+			return
+		}
+		mc.mu.Lock()
+		req := mc.pending[id]
+		delete(mc.pending, id)
+		mc.mu.Unlock()
+
+		res, err := ReadResponse(bufio.NewReader(bytes.NewReader(payload)), req)
+		if err != nil {
+			mc.fail(err)
+			mc.conn.Close()
+			return
+		}
+		select {
+		case mc.responses <- MultiplexedResponse{ID: id, Response: res}:
+		case <-mc.closed:
+			return
+		}
+	}
+}
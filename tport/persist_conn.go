@@ -58,6 +58,20 @@ func (p *persistConn) shouldRetryRequest(req *Request, err error) bool {
 	return false // conservatively
 }
 
+// canRetryRequest reports whether a failed request may be sent again at
+// all, whatever the retry policy: no response bytes were read from the
+// server and the body, if any, can be rewound with GetBody.
+func canRetryRequest(req *Request, err error) bool {
+	switch err.(type) {
+	case nothingWrittenError, transportReadFromServerError:
+	default:
+		if err != ErrServerClosedIdle {
+			return false
+		}
+	}
+	return req.OutgoingLength() == 0 || req.GetBody != nil
+}
+
 func (p *persistConn) maxHeaderResponseSize() int64 {
 	if v := p.transport.MaxResponseHeaderBytes; v != 0 {
 		return v
@@ -80,6 +94,19 @@ func (p *persistConn) Read(from []byte) (int, error) {
 	return n, err
 }
 
+// headBodyBytes returns the number of bytes that followed the response
+// to a HEAD request, waiting up to strictHeadWait for some to arrive if
+// none came along with the headers.
+func (p *persistConn) headBodyBytes() int {
+	if n := p.br.Buffered(); n > 0 {
+		return n
+	}
+	p.conn.SetReadDeadline(time.Now().Add(strictHeadWait))
+	defer p.conn.SetReadDeadline(time.Time{})
+	p.br.Peek(1)
+	return p.br.Buffered()
+}
+
 // isBroken reports whether this connection is in a known broken state.
 func (p *persistConn) isBroken() bool {
 	p.mu.Lock()
@@ -117,6 +144,21 @@ func (p *persistConn) gotIdleConnTrace(idleAt time.Time) trc.GotConnInfo {
 	return t
 }
 
+func (p *persistConn) reusedConnTrace(idleAt time.Time, idleConns int) trc.ReusedConnInfo {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	t := trc.ReusedConnInfo{
+		Conn:      p.conn,
+		Reused:    p.reused,
+		WasIdle:   true,
+		IdleConns: idleConns,
+	}
+	if !idleAt.IsZero() {
+		t.IdleTime = time.Since(idleAt)
+	}
+	return t
+}
+
 func (p *persistConn) cancelRequest(err error) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
@@ -137,6 +179,7 @@ func (p *persistConn) closeConnIfStillIdle() {
 	}
 	t.removeIdleConnLocked(p)
 	p.close(errIdleConnTimeout)
+	t.stats.IdleTimeouts++
 }
 
 // mapRoundTripError returns the appropriate error value for
@@ -176,6 +219,11 @@ func (p *persistConn) mapRoundTripError(req *transportRequest, startBytesWritten
 		// Don't decorate
 		return err
 	}
+
+	if _, ok := err.(*HeadResponseBodyError); ok {
+		// Don't decorate
+		return err
+	}
 	if p.isBroken() {
 		<-p.writeLoopDone
 		if p.nwrite == startBytesWritten {
@@ -193,7 +241,7 @@ func (p *persistConn) readLoop() {
 		p.transport.removeIdleConn(p)
 	}()
 
-	tryPutIdleConn := func(trace *trc.ClientTrace) bool {
+	tryPutIdleConn := func(req *Request, trace *trc.ClientTrace) bool {
 		if err := p.transport.tryPutIdleConn(p); err != nil {
 			closeErr = err
 			if trace != nil && trace.PutIdleConn != nil && err != errKeepAlivesDisabled {
@@ -204,6 +252,7 @@ func (p *persistConn) readLoop() {
 		if trace != nil && trace.PutIdleConn != nil {
 			trace.PutIdleConn(nil)
 		}
+		p.transport.logEvent(EventPutIdle, req)
 		return true
 	}
 
@@ -232,6 +281,12 @@ func (p *persistConn) readLoop() {
 		var resp *Response
 		if err == nil {
 			resp, err = p.readResponse(rc, trace)
+			if err == nil && rc.req.Method == HEAD && p.transport.StrictHead {
+				if n := p.headBodyBytes(); n > 0 {
+					err = &HeadResponseBodyError{Buffered: n}
+					closeErr = err
+				}
+			}
 		} else {
 			err = transportReadFromServerError{err}
 			closeErr = err
@@ -250,6 +305,7 @@ func (p *persistConn) readLoop() {
 			return
 		}
 		p.readLimit = MaxInt64 // effictively no limit for response bodies
+		p.transport.logEvent(EventGotResponse, rc.req)
 
 		p.mu.Lock()
 		p.numExpectedResponses--
@@ -276,7 +332,7 @@ func (p *persistConn) readLoop() {
 			alive = alive &&
 				!p.sawEOF &&
 				p.wroteRequest() &&
-				tryPutIdleConn(trace)
+				tryPutIdleConn(rc.req, trace)
 
 			select {
 			case rc.ch <- responseAndError{res: resp}:
@@ -293,7 +349,8 @@ func (p *persistConn) readLoop() {
 
 		waitForBodyRead := make(chan bool, 2)
 		body := &bodyEOFSignal{
-			body: resp.Body,
+			body:      resp.Body,
+			keepAlive: alive && p.transport.keepAlivesEnabled(),
 			earlyCloseFn: func() error {
 				waitForBodyRead <- false
 				return nil
@@ -320,6 +377,12 @@ func (p *persistConn) readLoop() {
 			resp.Header.Del(hdr.ContentLength)
 			resp.ContentLength = -1
 			resp.Uncompressed = true
+		} else if dec := findDecoder(rc.addedDecoders, resp.Header.Get(hdr.ContentEncoding)); dec != nil {
+			resp.Body = &decodingReader{body: body, newReader: dec.newReader}
+			resp.Header.Del(hdr.ContentEncoding)
+			resp.Header.Del(hdr.ContentLength)
+			resp.ContentLength = -1
+			resp.Uncompressed = true
 		}
 
 		select {
@@ -338,7 +401,7 @@ func (p *persistConn) readLoop() {
 				bodyEOF &&
 				!p.sawEOF &&
 				p.wroteRequest() &&
-				tryPutIdleConn(trace)
+				tryPutIdleConn(rc.req, trace)
 			if bodyEOF {
 				eofc <- struct{}{}
 			}
@@ -381,6 +444,17 @@ func (p *persistConn) readResponse(rc requestAndChan, trace *trc.ClientTrace) (*
 	if err != nil {
 		return resp, err
 	}
+	if resp, err = p.handle1xx(resp, rc, trace); err != nil {
+		return resp, err
+	}
+	if resp.StatusCode == 100 && trace != nil && trace.Got1xxResponse != nil {
+		if err := trace.Got1xxResponse(resp.StatusCode, resp.Header); err != nil {
+			if rc.continueCh != nil {
+				close(rc.continueCh) // don't send the body
+			}
+			return nil, err
+		}
+	}
 	if rc.continueCh != nil {
 		if resp.StatusCode == 100 {
 			if trace != nil && trace.Got100Continue != nil {
@@ -397,11 +471,54 @@ func (p *persistConn) readResponse(rc requestAndChan, trace *trc.ClientTrace) (*
 		if err != nil {
 			return resp, err
 		}
+		if resp, err = p.handle1xx(resp, rc, trace); err != nil {
+			return resp, err
+		}
 	}
 	resp.TLS = p.tlsState
+	resp.Conn = p.connInfo
+	if p.transport.MaxTrailerBytes > 0 {
+		LimitTrailer(resp.Body, p.transport.MaxTrailerBytes)
+	}
 	return resp, err
 }
 
+// handle1xx passes informational responses other than 100 Continue and
+// 101 Switching Protocols to the Got1xxResponse hook of trace and to
+// Transport.Handle1xx, and reads the responses that follow them. Without
+// any of the hooks, resp is returned as is.
+func (p *persistConn) handle1xx(resp *Response, rc requestAndChan, trace *trc.ClientTrace) (*Response, error) {
+	var got1xx func(int, hdr.Header) error
+	if trace != nil {
+		got1xx = trace.Got1xxResponse
+	}
+	if p.transport.Handle1xx == nil && got1xx == nil {
+		return resp, nil
+	}
+	for num1xx := 0; is1xxInterim(resp.StatusCode); num1xx++ {
+		if num1xx >= max1xxResponses {
+			return nil, errTooMany1xx
+		}
+		if got1xx != nil {
+			if err := got1xx(resp.StatusCode, resp.Header); err != nil {
+				return nil, err
+			}
+		}
+		if p.transport.Handle1xx != nil {
+			if err := p.transport.Handle1xx(resp.StatusCode, resp.Header); err != nil {
+				return nil, err
+			}
+		}
+		p.readLimit = p.maxHeaderResponseSize() // reset the limit
+		var err error
+		resp, err = ReadResponse(p.br, rc.req)
+		if err != nil {
+			return resp, err
+		}
+	}
+	return resp, nil
+}
+
 // waitForContinue returns the function to block until
 // any response, timeout or connection close. After any of them,
 // the function returns a bool which indicates if the body should be sent.
@@ -430,7 +547,12 @@ func (p *persistConn) writeLoop() {
 		select {
 		case wr := <-p.writech:
 			startBytesWritten := p.nwrite
-			err := wr.req.Request.IWrite(p.bw, p.isProxy, wr.req.extra, p.waitForContinue(wr.continueCh))
+			var w io.Writer = p.bw
+			if p.transport.FlushRequestWrites {
+				w = &FlushAfterWriteWriter{Writer: p.bw}
+			}
+			var wrote trc.WroteRequestInfo
+			err := wr.req.Request.IWrite(w, p.isProxy, wr.req.extra, p.waitForContinue(wr.continueCh), &wrote)
 			if _, ok := err.(RequestBodyReadError); ok {
 				//err = bre.error
 				// Errors reading from the user's
@@ -445,6 +567,14 @@ func (p *persistConn) writeLoop() {
 			if err == nil {
 				err = p.bw.Flush()
 			}
+			if trace := wr.req.trace; trace != nil && trace.WroteRequest != nil {
+				// reported only now that the request reached the connection
+				wrote.Err = err
+				trace.WroteRequest(wrote)
+			}
+			if err == nil {
+				p.transport.logEvent(EventWroteRequest, wr.req.Request)
+			}
 			if err != nil {
 				wr.req.Request.CloseBody()
 				if p.nwrite == startBytesWritten {
@@ -502,6 +632,7 @@ func (p *persistConn) roundTrip(req *transportRequest) (*Response, error) {
 	}
 	p.mu.Lock()
 	p.numExpectedResponses++
+	p.numRequests++
 	headerFn := p.mutateHeaderFunc
 	p.mu.Unlock()
 
@@ -514,6 +645,7 @@ func (p *persistConn) roundTrip(req *transportRequest) (*Response, error) {
 	// uncompress the gzip stream if we were the layer that
 	// requested it.
 	requestedGzip := false
+	var requestedDecoders []contentDecoder
 	if !p.transport.DisableCompression &&
 		req.Header.Get(hdr.AcceptEncoding) == "" &&
 		req.Header.Get("Range") == "" &&
@@ -531,11 +663,15 @@ func (p *persistConn) roundTrip(req *transportRequest) (*Response, error) {
 		// auto-decoding a portion of a gzipped document will just fail
 		// anyway. See https://golang.org/issue/8923
 		requestedGzip = true
-		req.extraHeaders().Set(hdr.AcceptEncoding, "gzip")
+		requestedDecoders = p.transport.contentDecoders()
+		req.extraHeaders().Set(hdr.AcceptEncoding, acceptEncoding(requestedDecoders))
 	}
 
 	var continueCh chan struct{}
-	if req.ProtoAtLeast(1, 1) && req.Body != nil && req.ExpectsContinue() {
+	// A request with provably no body has nothing to hold back, so its
+	// (empty) body is sent right away instead of waiting for a
+	// 100-continue response or the ExpectContinueTimeout.
+	if req.ProtoAtLeast(1, 1) && req.OutgoingLength() != 0 && req.ExpectsContinue() {
 		continueCh = make(chan struct{}, 1)
 	}
 
@@ -563,11 +699,12 @@ func (p *persistConn) roundTrip(req *transportRequest) (*Response, error) {
 
 	resc := make(chan responseAndError)
 	p.reqch <- requestAndChan{
-		req:        req.Request,
-		ch:         resc,
-		addedGzip:  requestedGzip,
-		continueCh: continueCh,
-		callerGone: gone,
+		req:           req.Request,
+		ch:            resc,
+		addedGzip:     requestedGzip,
+		addedDecoders: requestedDecoders,
+		continueCh:    continueCh,
+		callerGone:    gone,
 	}
 
 	var respHeaderTimer <-chan time.Time
@@ -616,11 +753,20 @@ func (p *persistConn) roundTrip(req *transportRequest) (*Response, error) {
 			}
 			return re.res, nil
 		case <-ctxDoneChan:
+			p.transport.cancelRequest(req.Request, req.Context().Err())
 			ctxDoneChan = nil
 		}
 	}
 }
 
+// requestCount returns the number of requests written on this connection.
+func (p *persistConn) requestCount() int {
+	p.mu.Lock()
+	n := p.numRequests
+	p.mu.Unlock()
+	return n
+}
+
 // markReused marks this connection as having been successfully used for a
 // request and response.
 func (p *persistConn) markReused() {
@@ -660,6 +806,8 @@ func (p *persistConn) closeLocked(err error) {
 		p.conn.Close()
 		close(p.closech)
 		//}
+		p.transport.decHostConnCount(p.cacheKey)
+		p.transport.releaseDrainSeq(p.drainSeq)
 	}
 	p.mutateHeaderFunc = nil
 }
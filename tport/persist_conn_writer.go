@@ -5,7 +5,37 @@
 
 package tport
 
+import "time"
+
 func (w persistConnWriter) Write(p []byte) (n int, err error) {
+	max := w.pc.transport.WriteChunkBytes
+	if max <= 0 {
+		n, err = w.write(p)
+		return
+	}
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > max {
+			chunk = chunk[:max]
+		}
+		var nn int
+		nn, err = w.write(chunk)
+		n += nn
+		if err != nil {
+			return
+		}
+		p = p[nn:]
+	}
+	return
+}
+
+// write writes p to the conn in a single Write, bounded by the Transport's
+// WriteChunkTimeout if set.
+func (w persistConnWriter) write(p []byte) (n int, err error) {
+	if d := w.pc.transport.WriteChunkTimeout; d > 0 {
+		w.pc.conn.SetWriteDeadline(time.Now().Add(d))
+		defer w.pc.conn.SetWriteDeadline(time.Time{})
+	}
 	n, err = w.pc.conn.Write(p)
 	w.pc.nwrite += int64(n)
 	return
@@ -6,8 +6,12 @@
 package tport
 
 import (
+	"bufio"
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
+	"net"
 	"os"
 
 	. "github.com/badu/http"
@@ -78,3 +82,57 @@ func ProxyURL(fixedURL *url.URL) func(*Request) (*url.URL, error) {
 func UseProxy(addr string) bool {
 	return useProxy(addr)
 }
+
+// NewMultiplexedConn returns a MultiplexedConn sending requests over c and
+// starts reading the responses of the peer. The caller must not otherwise
+// use c, and should Close the MultiplexedConn when done.
+func NewMultiplexedConn(c net.Conn) *MultiplexedConn {
+	mc := &MultiplexedConn{
+		conn:      c,
+		br:        bufio.NewReader(c),
+		pending:   make(map[uint32]*Request),
+		responses: make(chan MultiplexedResponse, 16),
+		closed:    make(chan struct{}),
+	}
+	go mc.readLoop()
+	return mc
+}
+
+// WriteFrame writes payload to w in a frame carrying id: the id and the
+// length of the payload as 4-byte big-endian integers, then the payload.
+// MultiplexedConn sends requests, and expects responses, in HTTP/1.1 wire
+// format in such frames. Payloads larger than MaxFrameSize are rejected
+// with ErrFrameTooLarge, without writing anything.
+func WriteFrame(w io.Writer, id uint32, payload []byte) error {
+	if len(payload) > MaxFrameSize {
+		return ErrFrameTooLarge
+	}
+	var head [8]byte
+	binary.BigEndian.PutUint32(head[:4], id)
+	binary.BigEndian.PutUint32(head[4:], uint32(len(payload)))
+	if _, err := w.Write(head[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
+
+// ReadFrame reads a frame written by WriteFrame from r.
+func ReadFrame(r io.Reader) (id uint32, payload []byte, err error) {
+	var head [8]byte
+	if _, err = io.ReadFull(r, head[:]); err != nil {
+		return 0, nil, err
+	}
+	n := binary.BigEndian.Uint32(head[4:])
+	if n > MaxFrameSize {
+		return 0, nil, ErrFrameTooLarge
+	}
+	payload = make([]byte, n)
+	if _, err = io.ReadFull(r, payload); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, nil, err
+	}
+	return binary.BigEndian.Uint32(head[:4]), payload, nil
+}
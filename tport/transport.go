@@ -11,6 +11,7 @@ import (
 	"crypto/tls"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"sort"
@@ -75,7 +76,7 @@ func (t *Transport) RoundTrip(req *Request) (*Response, error) {
 		return nil, errors.New("http: no Host in request URL")
 	}
 
-	for {
+	for attempt := 1; ; attempt++ {
 		// treq gets modified by roundTrip, so we need to recreate for each retry.
 		treq := &transportRequest{Request: req, trace: trace}
 		cm, err := t.connectMethodForRequest(treq)
@@ -108,7 +109,13 @@ func (t *Transport) RoundTrip(req *Request) (*Response, error) {
 			return resp, nil
 		}
 
-		if !pconn.shouldRetryRequest(req, err) {
+		var retry bool
+		if t.ShouldRetry != nil {
+			retry = attempt < maxRetryAttempts && canRetryRequest(req, err) && t.ShouldRetry(req, attempt, err)
+		} else {
+			retry = pconn.shouldRetryRequest(req, err)
+		}
+		if !retry {
 			// Issue 16465: return underlying net.Conn.Read error from peek,
 			// as we've historically done.
 			if e, ok := err.(transportReadFromServerError); ok {
@@ -118,6 +125,7 @@ func (t *Transport) RoundTrip(req *Request) (*Response, error) {
 		}
 
 		TestEventsEmitter.Dispatch(RoundTripRetriedEvent)
+		t.logEvent(EventRetried, req)
 
 		// Rewind the body if we're able to.  (HTTP/2 does this itself so we only
 		// need to do it for HTTP/1.1 connections.)
@@ -160,6 +168,35 @@ func (t *Transport) RegisterProtocol(scheme string, rt RoundTripper) {
 	t.altProto.Store(newMap)
 }
 
+// RegisterDecoder registers newReader to decode response bodies with
+// the Content-Encoding encoding, such as "br" for brotli. The Transport
+// then advertises encoding after gzip in the Accept-Encoding header it
+// adds on its own, and transparently decodes such responses the same
+// way it does gzip ones: the Content-Encoding and Content-Length
+// headers are removed and Response.Uncompressed is set. As with gzip,
+// nothing is advertised nor decoded if DisableCompression is set or
+// the Request carries its own Accept-Encoding value.
+//
+// The reader newReader returns should report a truncated stream as
+// io.ErrUnexpectedEOF, as the gzip decoding does.
+func (t *Transport) RegisterDecoder(encoding string, newReader func(io.Reader) io.Reader) {
+	t.decMu.Lock()
+	defer t.decMu.Unlock()
+	old, _ := t.decoders.Load().([]contentDecoder)
+	if strings.EqualFold(encoding, "gzip") || findDecoder(old, encoding) != nil {
+		panic("decoder " + encoding + " already registered")
+	}
+	decoders := make([]contentDecoder, len(old), len(old)+1)
+	copy(decoders, old)
+	t.decoders.Store(append(decoders, contentDecoder{encoding: encoding, newReader: newReader}))
+}
+
+// contentDecoders returns the decoders registered with RegisterDecoder.
+func (t *Transport) contentDecoders() []contentDecoder {
+	decoders, _ := t.decoders.Load().([]contentDecoder)
+	return decoders
+}
+
 // CloseIdleConnections closes any connections which were previously
 // connected from previous requests but are now sitting idle in
 // a "keep-alive" state. It does not interrupt any connections currently
@@ -167,6 +204,9 @@ func (t *Transport) RegisterProtocol(scheme string, rt RoundTripper) {
 func (t *Transport) CloseIdleConnections() {
 	t.idleMu.Lock()
 	m := t.idleConn
+	for _, conns := range m {
+		t.stats.IdleCloses += uint64(len(conns))
+	}
 	t.idleConn = nil
 	t.idleConnCh = nil
 	t.wantIdle = true
@@ -179,6 +219,111 @@ func (t *Transport) CloseIdleConnections() {
 	}
 }
 
+// CloseIdleConnectionsForHost closes the idle connections to host,
+// leaving the pools of other hosts intact. The host is matched against
+// the address of each connection, either as "host:port" or as a bare
+// host name matching any port. Connections to host that are currently
+// in use are closed, instead of being returned to the idle pool, once
+// their request is done.
+func (t *Transport) CloseIdleConnectionsForHost(host string) {
+	var closing []*persistConn
+	t.idleMu.Lock()
+	t.drainMu.Lock()
+	t.drainSeq++
+	// Only conns alive now can predate this call; without any, there
+	// is nothing to remember.
+	if len(t.liveDrainSeqs) > 0 {
+		if t.drainedHosts == nil {
+			t.drainedHosts = make(map[string]uint64)
+		}
+		t.drainedHosts[host] = t.drainSeq
+	}
+	t.drainMu.Unlock()
+	for key, conns := range t.idleConn {
+		if !key.matchesHost(host) {
+			continue
+		}
+		for _, pconn := range conns {
+			if pconn.idleTimer != nil {
+				pconn.idleTimer.Stop()
+			}
+			t.idleLRU.remove(pconn)
+		}
+		closing = append(closing, conns...)
+		delete(t.idleConn, key)
+	}
+	t.stats.IdleCloses += uint64(len(closing))
+	t.idleMu.Unlock()
+	for _, pconn := range closing {
+		pconn.close(errCloseIdleConns)
+	}
+}
+
+// Stats returns a snapshot of the connection counters of t.
+func (t *Transport) Stats() TransportStats {
+	t.idleMu.Lock()
+	defer t.idleMu.Unlock()
+	return t.stats
+}
+
+// ResetStats sets all the connection counters of t back to zero.
+func (t *Transport) ResetStats() {
+	t.idleMu.Lock()
+	t.stats = TransportStats{}
+	t.idleMu.Unlock()
+}
+
+// isDrainedLocked reports whether pconn was dialed before the last
+// CloseIdleConnectionsForHost call matching its host.
+// t.idleMu must be held.
+func (t *Transport) isDrainedLocked(pconn *persistConn) bool {
+	t.drainMu.Lock()
+	defer t.drainMu.Unlock()
+	for host, seq := range t.drainedHosts {
+		if pconn.drainSeq < seq && pconn.cacheKey.matchesHost(host) {
+			return true
+		}
+	}
+	return false
+}
+
+// acquireDrainSeq records a conn being dialed at the current drain
+// sequence, and returns that sequence. Every call must be paired with
+// a releaseDrainSeq once the dial fails or the conn is closed.
+func (t *Transport) acquireDrainSeq() uint64 {
+	t.drainMu.Lock()
+	defer t.drainMu.Unlock()
+	if t.liveDrainSeqs == nil {
+		t.liveDrainSeqs = make(map[uint64]int)
+	}
+	t.liveDrainSeqs[t.drainSeq]++
+	return t.drainSeq
+}
+
+// releaseDrainSeq forgets a conn acquired at seq. Once no conn is left
+// at seq, the drained hosts that no live conn predates anymore are
+// removed, so drainedHosts only holds entries that still matter.
+func (t *Transport) releaseDrainSeq(seq uint64) {
+	t.drainMu.Lock()
+	defer t.drainMu.Unlock()
+	t.liveDrainSeqs[seq]--
+	if t.liveDrainSeqs[seq] > 0 {
+		return
+	}
+	delete(t.liveDrainSeqs, seq)
+	oldest := t.drainSeq
+	for s := range t.liveDrainSeqs {
+		if s < oldest {
+			oldest = s
+		}
+	}
+	for host, s := range t.drainedHosts {
+		if s <= oldest {
+			delete(t.drainedHosts, host)
+		}
+	}
+}
+
 // Cancel an in-flight request, recording the error value.
 func (t *Transport) cancelRequest(req *Request, err error) {
 	t.reqMu.Lock()
@@ -196,6 +341,7 @@ func (t *Transport) connectMethodForRequest(treq *transportRequest) (cm connectM
 	}
 	cm.targetScheme = treq.URL.Scheme
 	cm.targetAddr = canonicalAddr(treq.URL)
+	cm.affinity, _ = treq.Context().Value(ConnAffinityKey{}).(string)
 	if t.Proxy != nil {
 		cm.proxyURL, err = t.Proxy(treq.Request)
 		if err == nil && cm.proxyURL != nil {
@@ -220,18 +366,54 @@ func (t *Transport) maxIdleConnsPerHost() int {
 	return DefaultMaxIdleConnsPerHost
 }
 
+func (t *Transport) writeBufferSize() int {
+	if t.WriteBufferSize > 0 {
+		return t.WriteBufferSize
+	}
+	return defaultBufferSize
+}
+
+func (t *Transport) readBufferSize() int {
+	if t.ReadBufferSize > 0 {
+		return t.ReadBufferSize
+	}
+	return defaultBufferSize
+}
+
+// idleConnTimeout returns how long the connections of key may stay idle,
+// per IdleConnTimeoutForHost or else IdleConnTimeout.
+func (t *Transport) idleConnTimeout(key connectMethodKey) time.Duration {
+	if d, ok := t.IdleConnTimeoutForHost[key.addr]; ok {
+		return d
+	}
+	if h, _, err := net.SplitHostPort(key.addr); err == nil {
+		if d, ok := t.IdleConnTimeoutForHost[h]; ok {
+			return d
+		}
+	}
+	return t.IdleConnTimeout
+}
+
+// keepAlivesEnabled reports whether connections may be put in the idle pool.
+func (t *Transport) keepAlivesEnabled() bool {
+	return !t.DisableKeepAlives && t.MaxIdleConnsPerHost >= 0
+}
+
 // tryPutIdleConn adds pconn to the list of idle persistent connections awaiting
 // a new request.
 // If pconn is no longer needed or not in a good state, tryPutIdleConn returns
 // an error explaining why it wasn't registered.
 // tryPutIdleConn does not close pconn. Use putOrCloseIdleConn instead for that.
 func (t *Transport) tryPutIdleConn(pconn *persistConn) error {
-	if t.DisableKeepAlives || t.MaxIdleConnsPerHost < 0 {
+	if !t.keepAlivesEnabled() {
 		return errKeepAlivesDisabled
 	}
 	if pconn.isBroken() {
 		return errConnBroken
 	}
+	if t.MaxRequestsPerConn > 0 && pconn.requestCount() >= t.MaxRequestsPerConn {
+		return errTooManyRequests
+	}
 	// @comment : HTTP/2 is disabled - we don't need TLSNextProto
 	//if pconn.alt != nil {
 	//	return errNotCachingH2Conn
@@ -242,6 +424,10 @@ func (t *Transport) tryPutIdleConn(pconn *persistConn) error {
 	t.idleMu.Lock()
 	defer t.idleMu.Unlock()
 
+	if t.isDrainedLocked(pconn) {
+		return errHostDrained
+	}
+
 	waitingDialer := t.idleConnCh[key]
 	select {
 	case waitingDialer <- pconn:
@@ -250,6 +436,7 @@ func (t *Transport) tryPutIdleConn(pconn *persistConn) error {
 		// actively dialing, but this conn is ready
 		// first). Chrome calls this socket late binding. See
 		// https://insouciant.org/tech/connection-management-in-chromium/
+		t.stats.Reuses++
 		return nil
 	default:
 		if waitingDialer != nil {
@@ -279,12 +466,13 @@ func (t *Transport) tryPutIdleConn(pconn *persistConn) error {
 		oldest := t.idleLRU.removeOldest()
 		oldest.close(errTooManyIdle)
 		t.removeIdleConnLocked(oldest)
+		t.stats.IdleCloses++
 	}
-	if t.IdleConnTimeout > 0 {
+	if d := t.idleConnTimeout(key); d > 0 {
 		if pconn.idleTimer != nil {
-			pconn.idleTimer.Reset(t.IdleConnTimeout)
+			pconn.idleTimer.Reset(d)
 		} else {
-			pconn.idleTimer = time.AfterFunc(t.IdleConnTimeout, pconn.closeConnIfStillIdle)
+			pconn.idleTimer = time.AfterFunc(d, pconn.closeConnIfStillIdle)
 		}
 	}
 	pconn.idleAt = time.Now()
@@ -346,10 +534,18 @@ func (t *Transport) getIdleConn(cm connectMethod) (pconn *persistConn, idleSince
 			// itself in another goroutine. Don't use it.
 			continue
 		}
+		t.stats.Reuses++
 		return pconn, pconn.idleAt
 	}
 }
 
+// idleConnCount returns the number of idle connections cached for key.
+func (t *Transport) idleConnCount(key connectMethodKey) int {
+	t.idleMu.Lock()
+	defer t.idleMu.Unlock()
+	return len(t.idleConn[key])
+}
+
 // removeIdleConn marks pconn as dead.
 func (t *Transport) removeIdleConn(pconn *persistConn) {
 	t.idleMu.Lock()
@@ -419,12 +615,71 @@ func (t *Transport) replaceReqCanceler(r *Request, fn func(error)) bool {
 }
 
 func (t *Transport) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	if dial, ok := ctx.Value(DialerContextKey{}).(func(context.Context, string, string) (net.Conn, error)); ok && dial != nil {
+		return dial(ctx, network, addr)
+	}
 	if t.DialContext != nil {
 		return t.DialContext(ctx, network, addr)
 	}
+	if trace := trc.ContextClientTrace(ctx); trace != nil && (trace.DNSStart != nil || trace.DNSDone != nil) {
+		return dialTraced(ctx, trace, network, addr)
+	}
 	return zeroDialer.DialContext(ctx, network, addr)
 }
 
+// dialTraced resolves the host of addr itself, reporting the lookup to
+// the trace, then dials the resolved addresses in turn with zeroDialer,
+// which only accepts those of the family network asks for.
+// IP literals are dialed directly, without a lookup.
+func dialTraced(ctx context.Context, trace *trc.ClientTrace, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || net.ParseIP(host) != nil {
+		return zeroDialer.DialContext(ctx, network, addr)
+	}
+	if trace.DNSStart != nil {
+		trace.DNSStart(trc.DNSStartInfo{Host: host})
+	}
+	addrs, coalesced, err := dnsLookups.lookup(ctx, host)
+	if trace.DNSDone != nil {
+		trace.DNSDone(trc.DNSDoneInfo{Addrs: addrs, Err: err, Coalesced: coalesced})
+	}
+	if err != nil {
+		return nil, err
+	}
+	var firstErr error
+	for _, ip := range addrs {
+		conn, err := zeroDialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if firstErr == nil {
+		firstErr = &net.AddrError{Err: "no suitable address found", Addr: host}
+	}
+	return nil, firstErr
+}
+
+// logEvent reports a lifecycle event of req to EventLog, if set.
+func (t *Transport) logEvent(event string, req *Request) {
+	if t.EventLog != nil {
+		t.EventLog(event, req)
+	}
+}
+
+// customDialTLS dials with DialTLSContext, or with DialTLS if the former is nil.
+func (t *Transport) customDialTLS(ctx context.Context, network, addr string) (net.Conn, error) {
+	if t.DialTLSContext != nil {
+		return t.DialTLSContext(ctx, network, addr)
+	}
+	return t.DialTLS(network, addr)
+}
+
 // getConn dials and creates a new persistConn to the target as
 // specified in the connectMethod. This includes doing a proxy CONNECT
 // and/or setting up TLS.  If this doesn't return an error, the persistConn
@@ -437,6 +692,9 @@ func (t *Transport) getConn(treq *transportRequest, cm connectMethod) (*persistC
 		tracer.GetConn(cm.addr())
 	}
 	if pc, idleSince := t.getIdleConn(cm); pc != nil {
+		if tracer != nil && tracer.ConnReused != nil {
+			tracer.ConnReused(pc.reusedConnTrace(idleSince, t.idleConnCount(cm.key())))
+		}
 		if tracer != nil && tracer.GotConn != nil {
 			tracer.GotConn(pc.gotIdleConnTrace(idleSince))
 		}
@@ -452,12 +710,15 @@ func (t *Transport) getConn(treq *transportRequest, cm connectMethod) (*persistC
 		err error
 	}
 	dialc := make(chan dialRes)
+	cmKey := cm.key()
 
 	handlePendingDial := func() {
 		TestEventsEmitter.Dispatch(PrePendingDialEvent)
 		go func() {
 			if v := <-dialc; v.err == nil {
 				t.putOrCloseIdleConn(v.pc)
+			} else {
+				t.decHostConnCount(cmKey)
 			}
 			TestEventsEmitter.Dispatch(PostPendingDialEvent)
 		}()
@@ -466,8 +727,37 @@ func (t *Transport) getConn(treq *transportRequest, cm connectMethod) (*persistC
 	cancelc := make(chan error, 1)
 	t.setReqCanceler(req, func(err error) { cancelc <- err })
 
+	// Wait for a free connection slot, if the Transport limits them.
+	if waitc := t.incHostConnCount(cmKey); waitc != nil {
+		select {
+		case <-waitc:
+			// a slot was handed over to us; proceed with the dial
+		case pc := <-t.getIdleConnCh(cm):
+			t.cancelHostConnWait(cmKey, waitc)
+			if tracer != nil && tracer.GotConn != nil {
+				tracer.GotConn(trc.GotConnInfo{Conn: pc.conn, Reused: pc.isReused()})
+			}
+			return pc, nil
+		case <-req.Context().Done():
+			t.cancelHostConnWait(cmKey, waitc)
+			return nil, req.Context().Err()
+		case err := <-cancelc:
+			t.cancelHostConnWait(cmKey, waitc)
+			if err == ErrRequestCanceled {
+				err = ErrRequestCanceledConn
+			}
+			return nil, err
+		}
+	}
+
+	t.logEvent(EventDial, req)
 	go func() {
 		pc, err := t.dialConn(ctx, cm)
+		if err == nil {
+			t.idleMu.Lock()
+			t.stats.Dials++
+			t.idleMu.Unlock()
+		}
 		dialc <- dialRes{pc, err}
 	}()
 
@@ -485,6 +775,7 @@ func (t *Transport) getConn(treq *transportRequest, cm connectMethod) (*persistC
 		}
 		// Our dial failed. See why to return a nicer error
 		// value.
+		t.decHostConnCount(cmKey)
 		select {
 		// It was an error due to cancelation, so prioritize that
 		// error value. (Issue 16049)
@@ -524,6 +815,76 @@ func (t *Transport) getConn(treq *transportRequest, cm connectMethod) (*persistC
 	}
 }
 
+// incHostConnCount reserves a connection slot for key. It returns nil when the slot
+// was granted right away (or there is no MaxConnsPerHost limit), otherwise a channel
+// which receives once decHostConnCount hands a slot over to the caller.
+func (t *Transport) incHostConnCount(key connectMethodKey) chan struct{} {
+	if t.MaxConnsPerHost <= 0 {
+		return nil
+	}
+	t.connCountMu.Lock()
+	defer t.connCountMu.Unlock()
+	if t.connPerHostCount == nil {
+		t.connPerHostCount = make(map[connectMethodKey]int)
+	}
+	if t.connPerHostCount[key] < t.MaxConnsPerHost {
+		t.connPerHostCount[key]++
+		return nil
+	}
+	if t.connPerHostWait == nil {
+		t.connPerHostWait = make(map[connectMethodKey][]chan struct{})
+	}
+	// buffered, so decHostConnCount never blocks handing the slot over
+	ch := make(chan struct{}, 1)
+	t.connPerHostWait[key] = append(t.connPerHostWait[key], ch)
+	return ch
+}
+
+// decHostConnCount releases a connection slot for key, handing it over to the
+// oldest waiting getConn, if any.
+func (t *Transport) decHostConnCount(key connectMethodKey) {
+	if t.MaxConnsPerHost <= 0 {
+		return
+	}
+	t.connCountMu.Lock()
+	defer t.connCountMu.Unlock()
+	if waiters := t.connPerHostWait[key]; len(waiters) > 0 {
+		waiters[0] <- struct{}{}
+		if len(waiters) == 1 {
+			delete(t.connPerHostWait, key)
+		} else {
+			t.connPerHostWait[key] = waiters[1:]
+		}
+		return
+	}
+	if t.connPerHostCount[key] <= 1 {
+		delete(t.connPerHostCount, key)
+		return
+	}
+	t.connPerHostCount[key]--
+}
+
+// cancelHostConnWait gives up waiting on ch, returned by incHostConnCount.
+// A slot that was handed over in the meantime is released again.
+func (t *Transport) cancelHostConnWait(key connectMethodKey, ch chan struct{}) {
+	t.connCountMu.Lock()
+	waiters := t.connPerHostWait[key]
+	for i, w := range waiters {
+		if w == ch {
+			t.connPerHostWait[key] = append(waiters[:i:i], waiters[i+1:]...)
+			if len(t.connPerHostWait[key]) == 0 {
+				delete(t.connPerHostWait, key)
+			}
+			t.connCountMu.Unlock()
+			return
+		}
+	}
+	t.connCountMu.Unlock()
+	// not waiting anymore: the slot is ours, give it back
+	<-ch
+	t.decHostConnCount(key)
+}
+
 func (t *Transport) dialConn(ctx context.Context, cm connectMethod) (*persistConn, error) {
 	pconn := &persistConn{
 		transport:     t,
@@ -534,16 +895,23 @@ func (t *Transport) dialConn(ctx context.Context, cm connectMethod) (*persistCon
 		writeErrCh:    make(chan error, 1),
 		writeLoopDone: make(chan struct{}),
 	}
+	pconn.drainSeq = t.acquireDrainSeq()
+	dialed := false
+	defer func() {
+		if !dialed {
+			t.releaseDrainSeq(pconn.drainSeq)
+		}
+	}()
 	tracer := trc.ContextClientTrace(ctx)
-	tlsDial := t.DialTLS != nil && cm.targetScheme == HTTPS && cm.proxyURL == nil
+	tlsDial := (t.DialTLSContext != nil || t.DialTLS != nil) && cm.targetScheme == HTTPS && cm.proxyURL == nil
 	if tlsDial {
 		var err error
-		pconn.conn, err = t.DialTLS("tcp", cm.addr())
+		pconn.conn, err = t.customDialTLS(ctx, "tcp", cm.addr())
 		if err != nil {
 			return nil, err
 		}
 		if pconn.conn == nil {
-			return nil, errors.New("github.com/badu/http/tport: Transport.DialTLS returned (nil, nil)")
+			return nil, errors.New("github.com/badu/http/tport: Transport.DialTLS or DialTLSContext returned (nil, nil)")
 		}
 		if tc, ok := pconn.conn.(*tls.Conn); ok {
 			// Handshake here, in case DialTLS didn't. TLSNextProto below
@@ -607,6 +975,14 @@ func (t *Transport) dialConn(ctx context.Context, cm connectMethod) (*persistCon
 	case cm.targetScheme == HTTPS:
 		conn := pconn.conn
 		header := t.ProxyConnectHeader
+		if t.GetProxyConnectHeader != nil {
+			var err error
+			header, err = t.GetProxyConnectHeader(ctx, cm.proxyURL, cm.targetAddr)
+			if err != nil {
+				conn.Close()
+				return nil, err
+			}
+		}
 		if header == nil {
 			header = make(hdr.Header)
 		}
@@ -643,6 +1019,11 @@ func (t *Transport) dialConn(ctx context.Context, cm connectMethod) (*persistCon
 		if cfg.ServerName == "" {
 			cfg.ServerName = cm.tlsHost()
 		}
+		if t.TLSNextProtos != nil {
+			cfg.NextProtos = t.TLSNextProtos
+		} else if len(cfg.NextProtos) == 0 {
+			cfg.NextProtos = defaultTLSNextProtos
+		}
 		plainConn := pconn.conn
 		tlsConn := tls.Client(plainConn, cfg)
 		errc := make(chan error, 2)
@@ -679,6 +1060,10 @@ func (t *Transport) dialConn(ctx context.Context, cm connectMethod) (*persistCon
 		if tracer != nil && tracer.TLSHandshakeDone != nil {
 			tracer.TLSHandshakeDone(cs, nil)
 		}
+		if p := cs.NegotiatedProtocol; p != "" && p != "http/1.1" {
+			plainConn.Close()
+			return nil, fmt.Errorf("github.com/badu/http/tport: server negotiated unsupported protocol %q", p)
+		}
 		pconn.tlsState = &cs
 		pconn.conn = tlsConn
 	}
@@ -690,10 +1075,12 @@ func (t *Transport) dialConn(ctx context.Context, cm connectMethod) (*persistCon
 			}
 		}
 	**/
-	pconn.br = bufio.NewReader(pconn)
-	pconn.bw = bufio.NewWriter(persistConnWriter{pconn})
+	pconn.connInfo = connInfoOf(pconn.conn)
+	pconn.br = bufio.NewReaderSize(pconn, t.readBufferSize())
+	pconn.bw = bufio.NewWriterSize(persistConnWriter{pconn}, t.writeBufferSize())
 	go pconn.readLoop()
 	go pconn.writeLoop()
+	dialed = true
 	return pconn, nil
 }
 
@@ -709,6 +1096,13 @@ func (t *Transport) IdleConnKeysForTesting() (keys []string) {
 	return
 }
 
+//TODO : @badu - this is exported for tests
+func (t *Transport) DrainedHostCountForTesting() int {
+	t.drainMu.Lock()
+	defer t.drainMu.Unlock()
+	return len(t.drainedHosts)
+}
+
 //TODO : @badu - this is exported for tests
 func (t *Transport) IdleConnKeyCountForTesting() int {
 	t.idleMu.Lock()
@@ -742,6 +1136,34 @@ func (t *Transport) IdleConnCountForTesting(cacheKey string) int {
 	return 0
 }
 
+//TODO : @badu - this is exported for tests
+func (t *Transport) ConnCountForTesting(cacheKey string) int {
+	t.connCountMu.Lock()
+	defer t.connCountMu.Unlock()
+	for k, n := range t.connPerHostCount {
+		if k.String() == cacheKey {
+			return n
+		}
+	}
+	return 0
+}
+
+//TODO : @badu - this is exported for tests
+func (t *Transport) ConnRequestCountForTesting(cacheKey string) []int {
+	var counts []int
+	t.idleMu.Lock()
+	defer t.idleMu.Unlock()
+	for k, conns := range t.idleConn {
+		if k.String() == cacheKey {
+			for _, pc := range conns {
+				counts = append(counts, pc.requestCount())
+			}
+		}
+	}
+	sort.Ints(counts)
+	return counts
+}
+
 //TODO : @badu - this is exported for tests
 func (t *Transport) IdleConnChMapSizeForTesting() int {
 	t.idleMu.Lock()
@@ -758,7 +1180,7 @@ func (t *Transport) IsIdleForTesting() bool {
 
 //TODO : @badu - this is exported for tests
 func (t *Transport) RequestIdleConnChForTesting() {
-	t.getIdleConnCh(connectMethod{nil, HTTP, "example.com"})
+	t.getIdleConnCh(connectMethod{targetScheme: HTTP, targetAddr: "example.com"})
 }
 
 //TODO : @badu - this is exported for tests
@@ -768,6 +1190,7 @@ func (t *Transport) PutIdleTestConn() bool {
 		transport: t,
 		conn:      c,                   // dummy
 		closech:   make(chan struct{}), // so it can be closed
-		cacheKey:  connectMethodKey{"", HTTP, "example.com"},
+		cacheKey:  connectMethodKey{scheme: HTTP, addr: "example.com"},
+		drainSeq:  t.acquireDrainSeq(),
 	}) == nil
 }
@@ -28,6 +28,35 @@ const (
 	// DefaultMaxIdleConnsPerHost is the default value of Transport's
 	// MaxIdleConnsPerHost.
 	DefaultMaxIdleConnsPerHost = 2
+
+	// Names of the request lifecycle events reported to Transport.EventLog.
+	EventDial         = "dial"          // a new connection is being dialed for the request
+	EventWroteRequest = "wrote-request" // the request was written to the connection
+	EventGotResponse  = "got-response"  // the response headers were read
+	EventPutIdle      = "put-idle"      // the connection went back to the idle pool
+	EventRetried      = "retried"       // the request is sent again on another connection
+
+	// maxRetryAttempts caps how many times RoundTrip sends a request
+	// when Transport.ShouldRetry keeps asking for retries.
+	maxRetryAttempts = 10
+
+	// MaxFrameSize is the largest payload WriteFrame writes and ReadFrame accepts.
+	MaxFrameSize = 16 << 20
+
+	// defaultBufferSize is the size of the connection buffers when
+	// Transport.ReadBufferSize or Transport.WriteBufferSize is zero,
+	// the bufio default.
+	defaultBufferSize = 4 << 10
+
+	// max1xxResponses caps how many informational responses
+	// Transport.Handle1xx and ClientTrace.Got1xxResponse accept
+	// before the final one.
+	max1xxResponses = 5
+
+	// strictHeadWait is how long a Transport with StrictHead set waits
+	// for body bytes following the response to a HEAD request before
+	// reusing the connection.
+	strictHeadWait = 50 * time.Millisecond
 )
 
 var (
@@ -69,6 +98,8 @@ var (
 	errWantIdle           = errors.New("http: putIdleConn: CloseIdleConnections was called")
 	errTooManyIdle        = errors.New("http: putIdleConn: too many idle connections")
 	errTooManyIdleHost    = errors.New("http: putIdleConn: too many idle connections for host")
+	errTooManyRequests    = errors.New("http: putIdleConn: connection served MaxRequestsPerConn requests")
+	errHostDrained        = errors.New("http: putIdleConn: host drained by CloseIdleConnectionsForHost")
 	errCloseIdleConns     = errors.New("http: CloseIdleConnections called")
 	errReadLoopExiting    = errors.New("http: persistConn.readLoop exiting")
 
@@ -79,6 +110,9 @@ var (
 
 	zeroDialer net.Dialer
 
+	// dnsLookups coalesces the traced DNS lookups of the same host.
+	dnsLookups = &dnsLookupGroup{calls: make(map[string]*dnsLookupCall)}
+
 	errTimeout error = &httpError{err: "net/http: timeout awaiting response headers", timeout: true}
 
 	//TODO : @badu - exported, so tests can access it
@@ -94,6 +128,18 @@ var (
 	}
 
 	errReadOnClosedResBody = errors.New("http: read on closed response body")
+
+	// ErrFrameTooLarge is returned by WriteFrame and ReadFrame for frames larger than MaxFrameSize.
+	ErrFrameTooLarge = errors.New("http: frame too large")
+
+	errMultiplexedConnClosed = errors.New("http: use of closed MultiplexedConn")
+	errMultiplexedIDPending  = errors.New("http: MultiplexedConn request ID already pending")
+
+	errTooMany1xx = errors.New("http: too many 1xx informational responses")
+
+	// defaultTLSNextProtos is advertised with ALPN when neither
+	// Transport.TLSNextProtos nor TLSClientConfig.NextProtos is set.
+	defaultTLSNextProtos = []string{"http/1.1"}
 )
 
 type (
@@ -149,12 +195,30 @@ type (
 		idleConnCh map[connectMethodKey]chan *persistConn
 		idleLRU    connLRU
 
+		// guarded by idleMu:
+		stats TransportStats // see Stats
+
+		// drainMu guards the fields below. No other lock is acquired
+		// while it is held, so it may be taken under idleMu or a
+		// persistConn's mu.
+		drainMu       sync.Mutex
+		drainSeq      uint64            // incremented by every CloseIdleConnectionsForHost
+		drainedHosts  map[string]uint64 // host -> drainSeq of its last CloseIdleConnectionsForHost, while a conn predates it
+		liveDrainSeqs map[uint64]int    // drainSeq -> number of dialing or open conns acquired at it
+
 		reqMu       sync.Mutex
 		reqCanceler map[*Request]func(error)
 
+		connCountMu      sync.Mutex
+		connPerHostCount map[connectMethodKey]int             // live (active + idle) conns; only if MaxConnsPerHost > 0
+		connPerHostWait  map[connectMethodKey][]chan struct{} // getConn calls waiting for a free slot, oldest first
+
 		altMu    sync.Mutex   // guards changing altProto only
 		altProto atomic.Value // of nil or map[string]RoundTripper, key is URI scheme
 
+		decMu    sync.Mutex   // guards changing decoders only
+		decoders atomic.Value // of nil or []contentDecoder, in registration order
+
 		// Proxy specifies a function to return a proxy for a given
 		// Request. If the function returns a non-nil error, the
 		// request is aborted with the provided error.
@@ -169,6 +233,10 @@ type (
 		// DialContext specifies the dial function for creating unencrypted TCP connections.
 		// If DialContext is nil (and the deprecated Dial below is also nil),
 		// then the transport dials using package net.
+		//
+		// The ClientTrace DNSStart and DNSDone hooks are only called
+		// by the transport's own dialer: a custom DialContext has to
+		// resolve the host and call them itself.
 		DialContext func(ctx context.Context, network, addr string) (net.Conn, error)
 
 		// DialTLS specifies an optional dial function for creating
@@ -182,12 +250,32 @@ type (
 		// past the TLS handshake.
 		DialTLS func(network, addr string) (net.Conn, error)
 
+		// DialTLSContext specifies an optional dial function for creating
+		// TLS connections for non-proxied HTTPS requests, like DialTLS,
+		// but receives the request's context so that a dial or handshake
+		// in progress can be abandoned when the request is canceled.
+		//
+		// If DialTLSContext is set, DialTLS is not used.
+		DialTLSContext func(ctx context.Context, network, addr string) (net.Conn, error)
+
 		// TLSClientConfig specifies the TLS configuration to use with
 		// tls.Client.
 		// If nil, the default configuration is used.
 		// If non-nil, HTTP/2 support may not be enabled by default.
 		TLSClientConfig *tls.Config
 
+		// TLSNextProtos lists the protocols the Transport advertises
+		// with ALPN on the HTTPS connections it dials, overriding the
+		// NextProtos of TLSClientConfig. If both are empty, only
+		// "http/1.1" is advertised; a non-nil empty TLSNextProtos
+		// advertises no protocol at all. As the Transport speaks nothing
+		// else, a connection on which the server picks another
+		// protocol fails. The negotiated protocol is reported in the
+		// Response's TLS.NegotiatedProtocol.
+		// Connections dialed by DialTLS or DialTLSContext are left
+		// as is.
+		TLSNextProtos []string
+
 		// TLSHandshakeTimeout specifies the maximum amount of time waiting to
 		// wait for a TLS handshake. Zero means no timeout.
 		TLSHandshakeTimeout time.Duration
@@ -201,12 +289,37 @@ type (
 		// DefaultMaxIdleConnsPerHost is used.
 		MaxIdleConnsPerHost int
 
+		// MaxConnsPerHost optionally limits the total number of
+		// connections per host cache key, including connections in
+		// the dialing, active, and idle states. On limit violation,
+		// RoundTrip blocks until a connection is freed or the
+		// request's context is done.
+		//
+		// Zero means no limit.
+		MaxConnsPerHost int
+
+		// MaxRequestsPerConn, if non-zero, is the number of requests
+		// after which a connection is retired instead of being
+		// returned to the idle pool, forcing new connections to be
+		// dialed periodically (for instance to rebalance across the
+		// backends of a load balancer).
+		//
+		// Zero means no limit.
+		MaxRequestsPerConn int
+
 		// IdleConnTimeout is the maximum amount of time an idle
 		// (keep-alive) connection will remain idle before closing
 		// itself.
 		// Zero means no limit.
 		IdleConnTimeout time.Duration
 
+		// IdleConnTimeoutForHost optionally overrides IdleConnTimeout
+		// for the connections to some hosts. Keys are matched against
+		// the address of each connection, either as "host:port" or as
+		// a bare host name matching any port, the former taking
+		// precedence. A zero value means no limit for that host.
+		IdleConnTimeoutForHost map[string]time.Duration
+
 		// ResponseHeaderTimeout, if non-zero, specifies the amount of
 		// time to wait for a server's response headers after fully
 		// writing the request (including its body, if any). This
@@ -239,12 +352,48 @@ type (
 		// proxies during CONNECT requests.
 		ProxyConnectHeader hdr.Header
 
+		// GetProxyConnectHeader optionally specifies a func to return
+		// the headers to send to proxyURL during a CONNECT request to
+		// the target (host:port). It is called for every CONNECT and,
+		// if non-nil, takes precedence over ProxyConnectHeader.
+		// If it returns an error, the Transport's RoundTrip fails with
+		// that error.
+		GetProxyConnectHeader func(ctx context.Context, proxyURL *url.URL, target string) (hdr.Header, error)
+
 		// MaxResponseHeaderBytes specifies a limit on how many
 		// response bytes are allowed in the server's response
 		// header.
 		//
 		// Zero means to use a default limit.
 		MaxResponseHeaderBytes int64
+
+		// MaxTrailerBytes, if positive, limits the size of the
+		// trailer following a chunked response body. Reading a
+		// Body whose trailer is larger fails with ErrTrailerTooLarge.
+		// Independently of it, a trailer can't be larger than the
+		// connection's read buffer, see ReadBufferSize.
+		MaxTrailerBytes int64
+
+		// WriteBufferSize specifies the size of the write buffer used
+		// when writing to the connection.
+		// If zero, a default (currently 4KB) is used.
+		WriteBufferSize int
+
+		// ReadBufferSize specifies the size of the read buffer used
+		// when reading from the connection.
+		// If zero, a default (currently 4KB) is used.
+		ReadBufferSize int
+
+		// Handle1xx, if non-nil, is called for every informational
+		// (1xx) response other than 100 Continue and 101 Switching
+		// Protocols. The response is then discarded and the transport
+		// keeps reading until the final response. Returning an error
+		// aborts the request with that error.
+		// If nil, and the request has no ClientTrace.Got1xxResponse
+		// hook, such a response is returned to the caller as the
+		// final one and the connection is not reused.
+		Handle1xx func(code int, header hdr.Header) error
+
 		// DisableKeepAlives, if true, prevents re-use of TCP connections
 		// between different HTTP requests.
 		DisableKeepAlives bool
@@ -259,6 +408,80 @@ type (
 		// explicitly requested gzip it is not automatically
 		// uncompressed.
 		DisableCompression bool
+
+		// FlushRequestWrites, if true, makes the Transport flush the
+		// request headers and every Write of the request body to the
+		// network as soon as it happens, instead of buffering them.
+		// It is meant for streaming uploads, where the body is
+		// produced slowly and the peer should see it progressively.
+		FlushRequestWrites bool
+
+		// WriteChunkBytes, if positive, caps the size of each write of
+		// the request to the network at that many bytes: larger writes,
+		// typically of a big request body, are split. Together with
+		// WriteChunkTimeout, this lets a peer that stops reading be
+		// detected after one chunk rather than after one large write.
+		// Zero means writes are not split.
+		WriteChunkBytes int
+
+		// WriteChunkTimeout, if non-zero, specifies the amount of time
+		// each write of the request to the network, of at most
+		// WriteChunkBytes bytes if that is set, may take. A write that
+		// does not complete in time fails the request.
+		// Zero means no write deadline.
+		WriteChunkTimeout time.Duration
+
+		// ShouldRetry optionally specifies the policy for retrying a
+		// request that failed on a connection. If non-nil, it is
+		// called instead of the Transport's built-in policy with the
+		// request, the number of the attempt that failed (starting at
+		// 1) and the error; returning true sends the request again on
+		// another connection.
+		// Regardless of ShouldRetry, a request is only retried if no
+		// response bytes were read and its body, if any, can be
+		// rewound with GetBody, and never more than 10 times in total.
+		ShouldRetry func(req *Request, attempt int, err error) bool
+
+		// EventLog optionally specifies a func reporting the major
+		// lifecycle events of each request (see the Event constants),
+		// as a lightweight alternative to a full trc.ClientTrace.
+		// It may be called concurrently from different goroutines.
+		EventLog func(event string, req *Request)
+
+		// StrictHead, if true, makes the response to a HEAD request
+		// fail with a *HeadResponseBodyError when the server sent body
+		// bytes along with it, instead of silently ignoring them, in
+		// order to surface misbehaving servers. The connection is not
+		// reused in that case.
+		//
+		// Body bytes sent separately from the headers are detected by
+		// waiting briefly for them, which delays the response to every
+		// HEAD request by up to 50ms when the server behaves.
+		StrictHead bool
+	}
+
+	// TransportStats holds counters about how a Transport opened, reused
+	// and discarded its connections. The counters only grow, until
+	// Transport.ResetStats is called.
+	TransportStats struct {
+		// Dials is the number of connections successfully dialed,
+		// including the TLS handshake and proxy setup.
+		Dials uint64
+
+		// Reuses is the number of times a request got a connection
+		// from the idle pool, or one handed over on its way back to
+		// the pool, instead of dialing its own.
+		Reuses uint64
+
+		// IdleCloses is the number of idle connections closed by
+		// CloseIdleConnections, CloseIdleConnectionsForHost or to
+		// keep the pool within MaxIdleConns.
+		IdleCloses uint64
+
+		// IdleTimeouts is the number of idle connections closed
+		// because they stayed idle longer than IdleConnTimeout or
+		// IdleConnTimeoutForHost allow.
+		IdleTimeouts uint64
 	}
 
 	// transportRequest is a wrapper around a *Request that adds
@@ -326,13 +549,14 @@ type (
 		proxyURL     *url.URL // nil for no proxy, else full proxy URL
 		targetScheme string   // "http" or "https"
 		targetAddr   string   // Not used if http proxy + http targetScheme (4th example in table)
+		affinity     string   // optional ConnAffinityKey value of the request, empty if none
 	}
 
 	// connectMethodKey is the map key version of connectMethod, with a
 	// stringified proxy URL (or the empty string) instead of a pointer to
 	// a URL.
 	connectMethodKey struct {
-		proxy, scheme, addr string
+		proxy, scheme, addr, affinity string
 	}
 
 	// persistConn wraps a connection, usually a persistent one
@@ -347,6 +571,7 @@ type (
 		transport *Transport
 		conn      net.Conn
 		tlsState  *tls.ConnectionState
+		connInfo  *ConnInfo           // address pair of conn, set once dialed
 		br        *bufio.Reader       // from conn
 		bw        *bufio.Writer       // to conn
 		nwrite    int64               // bytes written
@@ -367,6 +592,7 @@ type (
 
 		mu                   sync.Mutex // guards following fields
 		numExpectedResponses int
+		numRequests          int   // requests written on this conn so far
 		closed               error // set non-nil when conn is closed, before closech is closed
 		canceledErr          error // set non-nil if conn is canceled
 		// mutateHeaderFunc is an optional func to modify extra
@@ -375,11 +601,12 @@ type (
 		mutateHeaderFunc func(hdr.Header)
 		cacheKey         connectMethodKey
 		// guarded by Transport.idleMu:
-		idleAt  time.Time // time it last become idle
-		isProxy bool
-		sawEOF  bool // whether we've seen EOF from conn; owned by readLoop
-		broken  bool // an error has happened on this connection; marked broken so it's not reused.
-		reused  bool // whether conn has had successful request/response and is being reused.
+		idleAt   time.Time // time it last become idle
+		drainSeq uint64    // Transport.drainSeq when the conn was dialed
+		isProxy  bool
+		sawEOF   bool // whether we've seen EOF from conn; owned by readLoop
+		broken   bool // an error has happened on this connection; marked broken so it's not reused.
+		reused   bool // whether conn has had successful request/response and is being reused.
 	}
 
 	// nothingWrittenError wraps a write errors which ended up writing zero bytes.
@@ -403,6 +630,10 @@ type (
 		// set it, only then do we transparently decode the gzip.
 		addedGzip bool
 
+		// the decoders registered with RegisterDecoder the Transport
+		// also advertised in the Accept-Encoding header it added.
+		addedDecoders []contentDecoder
+
 		// Optional blocking chan for Expect: 100-continue (for send).
 		// If the request has an "Expect: 100-continue" header and
 		// the server responds 100 Continue, readLoop send a value
@@ -434,6 +665,19 @@ type (
 	// TLogKey is a context WithValue key for test debugging contexts containing
 	// a t.Logf func. See export_test.go's Request.WithT method.
 	TLogKey struct{}
+	// ConnAffinityKey is a context WithValue key for an opaque string used as
+	// an additional component of the connection cache key. Requests carrying
+	// the same value prefer the same pooled connection (for instance, to stick
+	// a session to one backend), while requests with different values never
+	// share a connection. Requests without it are pooled as usual.
+	ConnAffinityKey struct{}
+	// DialerContextKey is a context WithValue key for a
+	// func(ctx context.Context, network, addr string) (net.Conn, error)
+	// used instead of Transport.DialContext to dial the connections of that
+	// request, including the connection to a proxy. Since the dialer is not
+	// part of the connection cache key, combine it with ConnAffinityKey to
+	// keep connections dialed differently from being shared.
+	DialerContextKey struct{}
 	// bodyEOFSignal is used by the HTTP/1 transport when reading response
 	// bodies to make sure we see the end of a response body before
 	// proceeding and reading on the connection again.
@@ -452,6 +696,23 @@ type (
 		rerr         error             // sticky Read error
 		fn           func(error) error // err will be nil on Read io.EOF
 		earlyCloseFn func() error      // optional alt Close func used if io.EOF not seen
+		keepAlive    bool              // whether the connection is pooled once the body is read
+	}
+
+	// dnsLookupGroup resolves host names for traced dials, sharing
+	// the result of a lookup among the callers resolving the same
+	// host at the same time.
+	dnsLookupGroup struct {
+		mu    sync.Mutex
+		calls map[string]*dnsLookupCall // in flight lookups, by host
+	}
+
+	dnsLookupCall struct {
+		done    chan struct{}      // closed when addrs and err are set
+		cancel  context.CancelFunc // stops the lookup
+		waiters int                // callers waiting for done, guarded by dnsLookupGroup.mu
+		addrs   []net.IPAddr
+		err     error
 	}
 
 	// gzipReader wraps a response body so it can lazily
@@ -462,8 +723,52 @@ type (
 		zerr error          // any error from gzip.NewHeaderReader; sticky
 	}
 
+	// contentDecoder is a decoder registered with Transport.RegisterDecoder.
+	contentDecoder struct {
+		encoding  string
+		newReader func(io.Reader) io.Reader
+	}
+
+	// decodingReader wraps a response body so it can lazily
+	// call the newReader of a contentDecoder on the first call to Read
+	decodingReader struct {
+		body      *bodyEOFSignal // underlying HTTP/1 response body framing
+		newReader func(io.Reader) io.Reader
+		r         io.Reader // lazily-initialized decoding reader
+	}
+
 	tlsHandshakeTimeoutError struct{}
 
+	// HeadResponseBodyError is returned by a Transport with StrictHead set
+	// when the server sent body bytes after the response to a HEAD request.
+	HeadResponseBodyError struct {
+		Buffered int // number of unexpected bytes received
+	}
+
+	// MultiplexedConn sends requests over a single connection, typically
+	// a hijacked one, in frames carrying a correlation ID, and delivers
+	// the responses on the Responses channel in whatever order the peer
+	// sends them. See WriteFrame for the framing.
+	MultiplexedConn struct {
+		conn      net.Conn
+		br        *bufio.Reader
+		wmu       sync.Mutex // serializes frame writes
+		mu        sync.Mutex // guards following 2 fields
+		pending   map[uint32]*Request
+		err       error // sticky error of the connection
+		responses chan MultiplexedResponse
+		closed    chan struct{}
+		closeOnce sync.Once
+	}
+
+	// MultiplexedResponse is a response read by a MultiplexedConn, with
+	// the ID of the request it answers. Response.Request is the request
+	// sent with that ID, if any.
+	MultiplexedResponse struct {
+		ID       uint32
+		Response *Response
+	}
+
 	connLRU struct {
 		ll *list.List // list.Element.Value type is of *persistConn
 		m  map[*persistConn]*list.Element
@@ -128,3 +128,38 @@ func isReplayable(r *Request) bool {
 	}
 	return false
 }
+
+// is1xxInterim reports whether code is an informational status that is
+// followed by another response; 100 Continue is handled separately and
+// 101 Switching Protocols is final.
+func is1xxInterim(code int) bool {
+	return code > 100 && code <= 199 && code != StatusSwitchingProtocols
+}
+
+// findDecoder returns the decoder of decoders for encoding, if any.
+func findDecoder(decoders []contentDecoder, encoding string) *contentDecoder {
+	for i := range decoders {
+		if strings.EqualFold(decoders[i].encoding, encoding) {
+			return &decoders[i]
+		}
+	}
+	return nil
+}
+
+// acceptEncoding returns the Accept-Encoding value the Transport adds:
+// gzip, then the encodings of decoders.
+func acceptEncoding(decoders []contentDecoder) string {
+	v := "gzip"
+	for _, d := range decoders {
+		v += ", " + d.encoding
+	}
+	return v
+}
+
+// connInfoOf returns the address pair of c, or nil if c is nil.
+func connInfoOf(c net.Conn) *ConnInfo {
+	if c == nil {
+		return nil
+	}
+	return &ConnInfo{LocalAddr: c.LocalAddr(), RemoteAddr: c.RemoteAddr()}
+}
@@ -191,25 +191,31 @@ func (t *transferWriter) WriteBody(w io.Writer) error {
 
 	// Write body
 	if t.Body != nil {
-		var body = transferBodyReader{t}
+		var body io.Reader = transferBodyReader{t}
+		if t.bodyHash != nil {
+			t.bodyHash.Reset()
+			body = io.TeeReader(body, t.bodyHash)
+		}
 		if chunked(t.TransferEncoding) {
 			if bw, ok := w.(*bufio.Writer); ok && !t.IsResponse {
 				w = &FlushAfterChunkWriter{Writer: bw}
 			}
 			cw := &chunkedWriter{w}
-			_, err = io.Copy(cw, body)
+			t.bodyBytes, err = io.Copy(cw, body)
 			if err == nil {
 				err = cw.Close()
 			}
 		} else if t.ContentLength == -1 {
 			ncopy, err = io.Copy(w, body)
+			t.bodyBytes = ncopy
 		} else {
 			ncopy, err = io.Copy(w, io.LimitReader(body, t.ContentLength))
+			t.bodyBytes = ncopy
 			if err != nil {
 				return err
 			}
 			var nextra int64
-			nextra, err = io.Copy(ioutil.Discard, body)
+			nextra, err = io.Copy(ioutil.Discard, transferBodyReader{t})
 			ncopy += nextra
 		}
 		if err != nil {
@@ -9,6 +9,8 @@ import (
 	"crypto/tls"
 	"net"
 	"time"
+
+	"github.com/badu/http/hdr"
 )
 
 // TraceKey is a context.Context Value key. Its associated value should
@@ -84,6 +86,14 @@ type ClientTrace struct {
 	// For HTTP/2, this hook is not currently used.
 	PutIdleConn func(err error)
 
+	// ConnReused is called when a connection is taken from the
+	// idle pool, right before GotConn. It reports how long the
+	// connection idled and how many idle connections remain in
+	// the pool for the same host. ConnReused is not called for
+	// freshly dialed connections.
+	// For HTTP/2, this hook is not currently used.
+	ConnReused func(ReusedConnInfo)
+
 	// GotFirstResponseByte is called when the first byte of the response
 	// headers is available.
 	GotFirstResponseByte func()
@@ -92,6 +102,15 @@ type ClientTrace struct {
 	// Continue" response.
 	Got100Continue func()
 
+	// Got1xxResponse is called for each informational (1xx) response
+	// header received before the final response, other than
+	// "101 Switching Protocols". It is called for "100 Continue"
+	// responses too, before Got100Continue. Returning an error aborts
+	// the request with that error. When set, the informational
+	// responses are not returned as the final one; see
+	// Transport.Handle1xx.
+	Got1xxResponse func(code int, header hdr.Header) error
+
 	// DNSStart is called when a DNS lookup begins.
 	DNSStart func(DNSStartInfo)
 
@@ -120,6 +139,12 @@ type ClientTrace struct {
 	// failure.
 	TLSHandshakeDone func(tls.ConnectionState, error)
 
+	// WroteHeaderFields is called after the Transport has written
+	// the request headers, with the header fields in the exact order
+	// they were serialized, including the ones added by the Transport
+	// itself (Host, User-Agent, Accept-Encoding, ...).
+	WroteHeaderFields func(fields []hdr.KV)
+
 	// WroteHeaders is called after the Transport has written
 	// the request headers.
 	WroteHeaders func()
@@ -131,7 +156,9 @@ type ClientTrace struct {
 	Wait100Continue func()
 
 	// WroteRequest is called with the result of writing the
-	// request and any body. It may be called multiple times
+	// request and any body. The Transport calls it once the
+	// request is flushed to the connection, with the error of
+	// the flush if it failed. It may be called multiple times
 	// in the case of retried requests.
 	WroteRequest func(WroteRequestInfo)
 }
@@ -141,6 +168,15 @@ type ClientTrace struct {
 type WroteRequestInfo struct {
 	// Err is any error encountered while writing the Request.
 	Err error
+
+	// HeaderBytes is the number of bytes written for the request
+	// line and the header, including the blank line ending it.
+	HeaderBytes int64
+
+	// BodyBytes is the number of body bytes written, not counting
+	// the chunked transfer encoding framing. On error it reports
+	// how much of the body was written before the failure.
+	BodyBytes int64
 }
 
 // DNSStartInfo contains information about a DNS request.
@@ -182,3 +218,27 @@ type GotConnInfo struct {
 	// idle, if WasIdle is true.
 	IdleTime time.Duration
 }
+
+// ReusedConnInfo is the argument to the ClientTrace.ConnReused function
+// and describes a connection taken from the idle pool.
+type ReusedConnInfo struct {
+	// Conn is the connection that was taken from the pool. It is
+	// owned by the http.Transport and should not be read, written
+	// or closed by users of ClientTrace.
+	Conn net.Conn
+
+	// Reused is whether this connection has been previously
+	// used for another HTTP request.
+	Reused bool
+
+	// WasIdle is whether this connection was obtained from an
+	// idle pool. It is always true for ConnReused.
+	WasIdle bool
+
+	// IdleTime reports how long the connection was idle.
+	IdleTime time.Duration
+
+	// IdleConns is the number of idle connections left in the
+	// pool for the same connection key after this one was taken.
+	IdleConns int
+}
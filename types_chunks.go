@@ -38,4 +38,13 @@ type (
 	FlushAfterChunkWriter struct {
 		*bufio.Writer
 	}
+
+	// FlushAfterWriteWriter signals from the Transport to Request.write
+	// that the request headers and every Write of a non-chunked request
+	// body should be flushed to the network immediately, instead of
+	// being accumulated in the buffer. Chunked bodies are already
+	// flushed per chunk. See Transport.FlushRequestWrites.
+	FlushAfterWriteWriter struct {
+		*bufio.Writer
+	}
 )
@@ -9,6 +9,7 @@ import (
 	"context"
 	"crypto/tls"
 	"errors"
+	"hash"
 	"io"
 	"sync"
 
@@ -146,6 +147,15 @@ type (
 		// for the Request.Write method.
 		Header hdr.Header
 
+		// RawHeaders holds the header fields of a server request as
+		// they were received, in their original order and casing,
+		// before canonicalization into Header. Fields sharing a key are
+		// kept as separate entries. It is intended for proxies that
+		// forward headers verbatim and is unused for client requests.
+		// ReadRequest sets it; a Server only does when its
+		// KeepRawHeaders is set.
+		RawHeaders []hdr.KV
+
 		// Body is the request's body.
 		//
 		// For client requests a nil body means the request has no
@@ -280,6 +290,10 @@ type (
 		// It is unexported to prevent people from using Context wrong
 		// and mutating the contexts held by callers of the same request.
 		ctx context.Context
+
+		// bodyHash, if non-nil, is updated with the body bytes as the
+		// request is written. It is set via WithBodyHash.
+		bodyHash hash.Hash
 	}
 	// RequestBodyReadError wraps an error from (*Request).write to indicate
 	// that the error came from a Read call on the Request.Body.
@@ -9,6 +9,8 @@ import (
 	"crypto/tls"
 	"errors"
 	"io"
+	"net"
+	"time"
 
 	"github.com/badu/http/hdr"
 )
@@ -22,6 +24,9 @@ var (
 	// ErrNoLocation is returned by Response's Location method
 	// when no Location header is present.
 	ErrNoLocation = errors.New("http: no Location header in response")
+	// ErrNoTrailer is returned by Response's TrailerInt and TrailerTime
+	// methods when the named trailer is absent or has not been read yet.
+	ErrNoTrailer = errors.New("http: named trailer not present")
 )
 
 type (
@@ -107,5 +112,43 @@ type (
 		// The pointer is shared between responses and should not be
 		// modified.
 		TLS *tls.ConnectionState
+
+		// Conn describes the connection on which the response was
+		// received. Two responses carrying the same LocalAddr were read
+		// from the same persistent connection. It is nil for responses
+		// produced by a RoundTripper registered with
+		// Transport.RegisterProtocol. The pointer is shared between
+		// responses and should not be modified.
+		// This is only populated for Client requests.
+		Conn *ConnInfo
+
+		// RedirectTimings records, for every redirect the Client followed
+		// to obtain this Response, the time it took from sending that hop's
+		// request until its redirect response headers arrived. Oldest first.
+		// It is empty when no redirect was followed.
+		// This is only populated for Client requests.
+		RedirectTimings []time.Duration
+
+		// Via holds the requests the Client sent before Request while
+		// following redirects to obtain this Response, oldest first,
+		// starting with the original request. It is empty when no
+		// redirect was followed.
+		// This is only populated for Client requests.
+		Via []*Request
+	}
+
+	// ConnInfo holds the address pair of the connection a Response was
+	// read from.
+	ConnInfo struct {
+		LocalAddr  net.Addr
+		RemoteAddr net.Addr
+	}
+
+	// reusableBody is implemented by response bodies that know whether
+	// the connection they are read from goes back to the idle pool.
+	// The Transport's bodies, and the Client's wrappers of them,
+	// implement it; see Response.Reusable.
+	reusableBody interface {
+		Reusable() bool
 	}
 )
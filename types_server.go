@@ -20,6 +20,8 @@ import (
 	"time"
 
 	"github.com/badu/http/hdr"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
 )
 
 const (
@@ -31,6 +33,10 @@ const (
 	// with a verbose logging wrapper.
 	debugServerConnections = false
 
+	// maxRejectLogBytes is how many bytes of a rejected request are
+	// given to Server.RejectLog.
+	maxRejectLogBytes = 4 << 10
+
 	// DefaultMaxHeaderBytes is the maximum permitted size of the headers
 	// in an HTTP request.
 	// This can be overridden by setting Server.MaxHeaderBytes.
@@ -63,6 +69,14 @@ const (
 	// This RST seems to occur mostly on BSD systems. (And Windows?)
 	// This timeout is somewhat arbitrary (~latency around the planet).
 	rstAvoidanceDelay = 500 * time.Millisecond
+
+	// h2cInitialWindowSize is the HTTP/2 flow control window of a new
+	// connection or stream, before any SETTINGS or WINDOW_UPDATE frame.
+	h2cInitialWindowSize = 65535
+
+	// h2cDefaultMaxFrameSize is the HTTP/2 maximum frame payload size,
+	// before the client's SETTINGS say otherwise.
+	h2cDefaultMaxFrameSize = 16384
 )
 
 const (
@@ -134,6 +148,13 @@ var (
 	// The associated value will be of type net.Addr.
 	LocalAddrContextKey = &contextKey{"local-addr"}
 
+	// ConnBytesContextKey is a context key. It can be used in
+	// HTTP handlers with context.WithValue to access the byte counts
+	// of the connection the request arrived on, when the server's
+	// CountConnBytes is set. The associated value will be of type
+	// *ConnBytes.
+	ConnBytesContextKey = &contextKey{"conn-bytes"}
+
 	colonSpace = []byte(": ")
 
 	bufioReaderPool   sync.Pool
@@ -188,6 +209,9 @@ var (
 		"'", "&#39;",
 	)
 
+	// quoteEscaper escapes the quoted-string parameters of header values.
+	quoteEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
 	// shutdownPollInterval is how often we poll for quiescence
 	// during Server.Shutdown. This is lower during tests, to
 	// speed up tests.
@@ -197,6 +221,10 @@ var (
 	// exercise for the reader.
 	shutdownPollInterval = 500 * time.Millisecond
 
+	// verifyContentLengthWait is how long Server.VerifyContentLength
+	// waits for bytes past the declared length of a request body.
+	verifyContentLengthWait = 50 * time.Millisecond
+
 	stateName = map[ConnState]string{
 		StateNew:      "new",
 		StateActive:   "active",
@@ -206,9 +234,35 @@ var (
 	}
 
 	// ErrServerClosed is returned by the Server's Serve, ServeTLS, ListenAndServe,
-	// and ListenAndServeTLS methods after a call to Shutdown or Close.
+	// and ListenAndServeTLS methods after a call to Shutdown or Close, or after
+	// their listener was stopped by ShutdownListener.
 	ErrServerClosed = errors.New("http: Server closed")
 
+	errListenerNotServed = errors.New("http: listener is not being served by this Server")
+
+	errH2CStreamReset = errors.New("http: h2c stream reset by the client")
+
+	// ErrBadHandshake is returned by Upgrade when the request is not
+	// a valid WebSocket opening handshake.
+	ErrBadHandshake = errors.New("http: bad WebSocket handshake")
+
+	// ErrNotFlusher is returned by NewEventStreamWriter when the
+	// ResponseWriter can't flush, so events wouldn't reach the client
+	// as they are sent.
+	ErrNotFlusher = errors.New("http: ResponseWriter does not implement Flusher")
+
+	// ErrNotHijacker is returned by Upgrade when the ResponseWriter
+	// can't hand over its connection, as for HTTP/2 requests.
+	ErrNotHijacker = errors.New("http: ResponseWriter does not implement Hijacker")
+
+	// errEventName is returned by EventStreamWriter.Send for event
+	// names spanning several lines.
+	errEventName = errors.New("http: event name contains a line break")
+
+	// errConnRejected is returned by Server.acquireConnSlot when a
+	// connection waited longer than MaxConnsGrace for a slot.
+	errConnRejected = errors.New("http: too many concurrent connections")
+
 	// ErrHandlerTimeout is returned on ResponseWriter Write calls
 	// in handlers which have timed out.
 	ErrHandlerTimeout = errors.New("http: Handler timeout")
@@ -325,6 +379,52 @@ type (
 		Flush()
 	}
 
+	// The EarlyHinter interface is implemented by ResponseWriters that allow
+	// an HTTP handler to send 103 Early Hints informational responses
+	// (RFC 8297) before the final response.
+	//
+	// The default HTTP/1.x ResponseWriter supports EarlyHinter, but
+	// ResponseWriter wrappers may not. Handlers should always test for
+	// this ability at runtime.
+	EarlyHinter interface {
+		// WriteEarlyHints writes a 103 response carrying the given
+		// header (usually one or more Link fields) and flushes it to the
+		// client. It may be called multiple times, but only before
+		// WriteHeader or Write; afterwards it only logs a warning.
+		WriteEarlyHints(hdr.Header)
+	}
+
+	// The ContextWriter interface is implemented by ResponseWriters that
+	// allow an HTTP handler to write with a context, so that a streaming
+	// handler stops promptly once the context is done, typically the
+	// request's context when the client went away.
+	//
+	// The default HTTP/1.x ResponseWriter supports ContextWriter, but
+	// ResponseWriter wrappers may not. Handlers should always test for
+	// this ability at runtime.
+	ContextWriter interface {
+		// WriteContext is like Write, but gives up when ctx is done,
+		// including while blocked on a client that stopped reading,
+		// and then returns ctx's error. The connection is not reused
+		// after such an abort.
+		WriteContext(ctx context.Context, p []byte) (int, error)
+	}
+
+	// The TrailerWriter interface is implemented by ResponseWriters that
+	// allow an HTTP handler to set trailers without declaring them in the
+	// Trailer header beforehand.
+	//
+	// The default HTTP/1.x ResponseWriter supports TrailerWriter, but
+	// ResponseWriter wrappers may not. Handlers should always test for
+	// this ability at runtime.
+	TrailerWriter interface {
+		// SetTrailer sets the trailer key to value, replacing any
+		// previous value. It is the same as setting the TrailerPrefix
+		// prefixed key in the Header map, and, like it, may be called
+		// until the handler returns.
+		SetTrailer(key, value string)
+	}
+
 	// The Hijacker interface is implemented by ResponseWriters that allow
 	// an HTTP handler to take over the connection.
 	//
@@ -383,6 +483,9 @@ type (
 		// cancelCtx cancels the connection-level context.
 		cancelCtx context.CancelFunc
 
+		// listener is the net.Listener that accepted this connection.
+		listener net.Listener
+
 		// netConIface is the underlying network connection.
 		// This is never wrapped by other types and is the value given out
 		// to CloseNotifier callers. It is usually of type *net.TCPConn or *tls.Conn.
@@ -421,6 +524,33 @@ type (
 		// by a Handler with the Hijacker interface.
 		// It is guarded by mu.
 		wasHijacked bool
+
+		// bytes counts the bytes read from and written to netConIface.
+		// nil unless Server.CountConnBytes is set.
+		bytes *ConnBytes
+
+		// rawHead holds the first bytes of the request being read,
+		// while capturing is set. See Server.RejectLog.
+		rawHead   []byte
+		capturing bool
+
+		// holdsSlot is whether this connection holds one of the
+		// slots of Server.MaxConcurrentConns.
+		holdsSlot bool
+
+		// draining is non-zero once ShutdownListener stopped the
+		// listener of this connection. Accessed atomically.
+		draining int32
+	}
+
+	// ConnBytes holds the number of bytes read from and written to
+	// a server connection, see Server.CountConnBytes. The counts
+	// grow as the connection is used, so they must be loaded
+	// atomically. Bytes moved on a hijacked connection after the
+	// Hijack call are counted too.
+	ConnBytes struct {
+		Read    int64 // accessed atomically
+		Written int64 // accessed atomically
 	}
 
 	// chunkWriter writes to a response's conn buffer, and is the writer
@@ -468,6 +598,9 @@ type (
 		// trailers are the headers to be sent after the handler finishes writing the body. This field is initialized from
 		// the Trailer response header when the response header is written.
 		trailers []string
+		// omitTrailers is set when Server.StrictTE is set and the client
+		// didn't send "TE: trailers", so that no trailers are written.
+		omitTrailers bool
 
 		written        int64 // number of bytes written in body
 		contentLength  int64 // explicitly-declared Content-Length; or -1
@@ -601,6 +734,46 @@ type (
 		// If zero, DefaultMaxHeaderBytes is used.
 		MaxHeaderBytes int
 
+		// MaxTrailerBytes, if positive, limits the size of the
+		// trailer following a chunked request body. Reading a body
+		// whose trailer is larger fails with ErrTrailerTooLarge.
+		// Independently of it, a trailer can't be larger than the
+		// connection's read buffer, 4KB.
+		MaxTrailerBytes int64
+
+		// RejectBareLF, if true, makes the server reply with
+		// 400 Bad Request to requests whose request line or header
+		// lines are terminated by a bare LF instead of CRLF.
+		// By default bare LF line endings are accepted.
+		RejectBareLF bool
+
+		// KeepRawHeaders, if true, makes the server set the
+		// RawHeaders of each request, for proxies that forward
+		// headers verbatim. It is off by default, as it copies every
+		// header field of every request.
+		KeepRawHeaders bool
+
+		// CountConnBytes, if true, makes the server count the bytes
+		// read from and written to each connection. Handlers access
+		// the counts of their connection through the request
+		// context, with ConnBytesContextKey. For TLS connections
+		// the counts are of the decrypted bytes. The connection
+		// returned by Hijack keeps counting; it is then not a
+		// *tls.Conn for TLS connections.
+		CountConnBytes bool
+
+		// EnableH2C, if true, makes the server honor the requests
+		// asking to upgrade a cleartext connection to HTTP/2 (h2c,
+		// RFC 7540 section 3.2). The server replies 101 Switching
+		// Protocols and serves the upgrade request itself over
+		// HTTP/2, as stream 1, then closes the connection: no other
+		// stream is accepted. Requests with a body, and those
+		// without the Upgrade: h2c and HTTP2-Settings headers, are
+		// served over HTTP/1.1 as usual.
+		// The ResponseWriter of the upgraded request implements
+		// Flusher but not Hijacker.
+		EnableH2C bool
+
 		// TLSNextProto optionally specifies a function to take over
 		// ownership of the provided TLS connection when an NPN/ALPN
 		// protocol upgrade has occurred. The map key is the protocol
@@ -617,21 +790,90 @@ type (
 		// ConnState type and associated constants for details.
 		ConnState func(net.Conn, ConnState)
 
+		// BaseContext optionally specifies a function that returns
+		// the base context for incoming requests on this server.
+		// The provided Listener is the specific Listener that's
+		// about to start accepting requests.
+		// If BaseContext is nil, the default is context.Background().
+		// If non-nil, it must return a non-nil context.
+		BaseContext func(net.Listener) context.Context
+
+		// ConnContext optionally specifies a function that modifies
+		// the context used for a new connection c. The provided ctx
+		// is derived from the base context and has a SrvCtxtKey
+		// value.
+		ConnContext func(ctx context.Context, c net.Conn) context.Context
+
 		// ErrorLog specifies an optional logger for errors accepting
 		// connections and unexpected behavior from handlers.
 		// If nil, logging goes to os.Stderr via the log package's
 		// standard logger.
 		ErrorLog *log.Logger
 
+		// RejectLog, if non-nil, is called when a malformed request is
+		// rejected before reaching the handler: a bad request line or
+		// header, an attempt at request smuggling, a request header too
+		// large, etc. It gets the remote address of the client, the
+		// reason of the rejection and the first bytes of the offending
+		// request, up to 4KB. The raw bytes must not be retained after
+		// RejectLog returns.
+		RejectLog func(remoteAddr string, reason string, raw []byte)
+
+		// NowFunc, if non-nil, returns the time used to stamp the Date
+		// header of the responses, instead of time.Now, for instance to
+		// get deterministic responses in tests. Deadlines of the
+		// connections always use the system clock.
+		NowFunc func() time.Time
+
+		// StrictTE makes the server send the trailers of a response only
+		// if the request has a TE header listing "trailers", as RFC 7230
+		// section 4.3 recommends. The Trailer header is then left out of
+		// the response too. By default, trailers are always sent.
+		StrictTE bool
+
+		// VerifyContentLength makes the server check request bodies
+		// against their declared Content-Length. A body cut short
+		// fails with io.ErrUnexpectedEOF, as it always does. The body
+		// of a request closing the connection fails with
+		// ErrContentLengthExceeded once the declared length is read,
+		// if more bytes were buffered along with it or arrive within
+		// a short wait (50ms) after it. That wait delays the EOF of
+		// such bodies when nothing follows. Extra bytes of keep-alive
+		// requests can't be told apart from a pipelined request, so
+		// they are not checked.
+		VerifyContentLength bool
+
+		// MaxConcurrentConns, if positive, limits the number of
+		// connections served at once. When the limit is reached,
+		// Serve waits for a served connection to be closed or
+		// hijacked before serving the next accepted one; with a
+		// MaxConnsGrace, Serve keeps accepting and every accepted
+		// connection waits for a slot on its own.
+		// Shutdown and Close stop the wait.
+		MaxConcurrentConns int
+
+		// MaxConnsGrace, if positive, is how long an accepted
+		// connection waits for a slot when MaxConcurrentConns is
+		// reached, counted from its own Accept. Past it, the
+		// connection gets a 503 Service Unavailable response and is
+		// closed. If zero, the connection waits as long as needed.
+		MaxConnsGrace time.Duration
+
 		disableKeepAlives int32 // accessed atomically.
 		inShutdown        int32 // accessed atomically (non-zero means we're in Shutdown)
 
-		mu       sync.Mutex
-		listener net.Listener
+		mu        sync.Mutex
+		listeners map[net.Listener]struct{}
+		boundAddr net.Addr // address of the last listener served
 
 		activeConn map[*conn]struct{}
+		connSlots  chan struct{} // semaphore of MaxConcurrentConns
 		doneChan   chan struct{}
 		onShutdown []func()
+
+		// encoders holds the content encoders registered with
+		// RegisterEncoder, keyed by lower-cased encoding name.
+		encoders map[string]func(io.Writer) io.WriteCloser
 	}
 
 	// A ConnState represents the state of a client connection to a server.
@@ -651,6 +893,77 @@ type (
 		handler     Handler
 		body        string
 		dt          time.Duration
+		// withContext makes the handler run with a request context
+		// that is canceled on timeout. See ContextTimeoutHandler.
+		withContext bool
+	}
+
+	// IdempotencyStore keeps the responses recorded by the handler
+	// returned by NewIdempotencyMiddleware, keyed by Request.DedupKey.
+	//
+	// Implementations must be safe for concurrent use by multiple
+	// goroutines.
+	IdempotencyStore interface {
+		// Get returns the response stored for key, if any.
+		Get(key string) (*RecordedResponse, bool)
+
+		// Put stores the response for key.
+		Put(key string, resp *RecordedResponse)
+	}
+
+	// RecordedResponse is a response kept by an IdempotencyStore,
+	// to be replayed for duplicate submissions.
+	RecordedResponse struct {
+		StatusCode int
+		Header     hdr.Header
+		Body       []byte
+	}
+
+	idempotencyHandler struct {
+		handler Handler
+		store   IdempotencyStore
+	}
+
+	// idempotencyWriter writes through to respWriter, recording
+	// the response as it goes.
+	idempotencyWriter struct {
+		respWriter  ResponseWriter
+		header      hdr.Header // snapshot taken when the header was written
+		wbuf        bytes.Buffer
+		wroteHeader bool
+		code        int
+	}
+
+	encodeHandler struct {
+		handler Handler
+	}
+
+	// encodeWriter writes through to respWriter, encoding the body
+	// with the negotiated encoding unless the handler already set
+	// a Content-Encoding of its own.
+	encodeWriter struct {
+		respWriter     ResponseWriter
+		encoding       string
+		newWriter      func(io.Writer) io.WriteCloser
+		skipCompressed bool           // leave the already compressed content types as is
+		enc            io.WriteCloser // nil until the header is written, and if not encoding
+		wroteHeader    bool
+	}
+
+	// GzipResponseWriter is a ResponseWriter compressing the response
+	// body with gzip, as returned by WrapGzip. It implements Flusher.
+	// The handler must call Close once done writing, to finish the
+	// gzip stream.
+	GzipResponseWriter struct {
+		encodeWriter
+	}
+
+	// EventStreamWriter writes Server-Sent Events (a text/event-stream
+	// response) and flushes each one to the client as it is sent.
+	// It is created with NewEventStreamWriter.
+	EventStreamWriter struct {
+		respWriter ResponseWriter
+		flusher    Flusher
 	}
 
 	timeoutWriter struct {
@@ -682,6 +995,50 @@ type (
 		handler serverHandler
 	}
 
+	// h2cConn is a connection upgraded to HTTP/2 by an h2c upgrade
+	// request, which it serves as its single stream.
+	h2cConn struct {
+		conn   *conn
+		cancel context.CancelFunc // cancels the request of the stream
+
+		// wmu serializes the frame writes, and guards henc and hbuf.
+		wmu    sync.Mutex
+		framer *http2.Framer
+		henc   *hpack.Encoder
+		hbuf   bytes.Buffer
+
+		// mu guards the following, cond is signaled when they change.
+		mu            sync.Mutex
+		cond          *sync.Cond
+		connWindow    int64  // send window of the connection
+		streamWindow  int64  // send window of the stream
+		initialWindow int64  // SETTINGS_INITIAL_WINDOW_SIZE of the client
+		maxFrameSize  uint32 // SETTINGS_MAX_FRAME_SIZE of the client
+		err           error  // set when the stream can't be written anymore
+	}
+
+	// h2cResponseWriter is the ResponseWriter of the request served
+	// over an h2cConn.
+	h2cResponseWriter struct {
+		sc          *h2cConn
+		srv         *Server
+		header      hdr.Header
+		status      int
+		isHEAD      bool  // the request is a HEAD: the body is discarded
+		written     int64 // body bytes written by the handler
+		wroteHeader bool  // WriteHeader was called
+		sentHeader  bool  // the HEADERS frame was sent
+		finished    bool  // the stream was ended
+	}
+
+	// countingConn is a net.Conn adding the bytes read and written
+	// through it to bytes. It is the connection handed out by Hijack
+	// when Server.CountConnBytes is set.
+	countingConn struct {
+		net.Conn
+		bytes *ConnBytes
+	}
+
 	// loggingConn is used for debugging.
 	loggingConn struct {
 		name string
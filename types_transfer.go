@@ -8,6 +8,7 @@ package http
 import (
 	"bufio"
 	"errors"
+	"hash"
 	"io"
 	"sync"
 
@@ -24,6 +25,15 @@ var (
 	// ResponseWriter.
 	ErrBodyReadAfterClose = errors.New("http: invalid Read on closed Body")
 
+	// ErrTrailerTooLarge is returned by reads of a chunked body whose
+	// trailer exceeds the MaxTrailerBytes of the Server or Transport.
+	ErrTrailerTooLarge = errors.New("http: trailer too large")
+
+	// ErrContentLengthExceeded is returned by reads of a request body
+	// followed by more bytes than its Content-Length declares, when
+	// Server.VerifyContentLength is set.
+	ErrContentLengthExceeded = errors.New("http: request body longer than its Content-Length")
+
 	errTrailerEOF = errors.New("http: unexpected EOF reading trailer")
 )
 
@@ -49,6 +59,13 @@ type (
 	// TODO : @badu investigate "It is exactly 1 pointer wide to avoid allocations into interfaces."
 	transferBodyReader struct{ transferWriter *transferWriter }
 
+	// countingWriter is an io.Writer that counts the bytes written to
+	// the underlying Writer.
+	countingWriter struct {
+		io.Writer
+		n int64
+	}
+
 	// transferWriter inspects the fields of a user-supplied Request or Response,
 	// sanitizes them without changing the user object and provides methods for
 	// writing the respective header, body and trailer in wire format.
@@ -58,6 +75,8 @@ type (
 		Header           hdr.Header
 		Trailer          hdr.Header
 		bodyReadError    error           // any non-EOF error from reading Body
+		bodyBytes        int64           // body bytes written by WriteBody, without chunk framing
+		bodyHash         hash.Hash       // optional; updated with the body bytes written by WriteBody
 		ByteReadCh       chan readResult // non-nil if probeRequestBody called
 		Method           string
 		TransferEncoding []string
@@ -89,14 +108,16 @@ type (
 	body struct {
 		mu                    sync.Mutex // guards following, and calls to Read and Close
 		reader                io.Reader
-		responseOrRequestIntf interface{}   // non-nil (Response or Request) value means read trailer
+		responseOrRequestIntf interface{}   // non-nil (Response, Request or *hdr.Header) value means read trailer
 		bufReader             *bufio.Reader // underlying wire-format reader for the trailer
 		isClosing             bool          // is the connection to be closed after reading body?
 		doEarlyClose          bool          // whether Close should stop early
 		hasSawEOF             bool
 		isClosed              bool
-		isEarlyClose          bool   // Close called and we didn't read to the end of src
-		onHitEOF              func() // if non-nil, func to call when EOF is Read
+		isEarlyClose          bool        // Close called and we didn't read to the end of src
+		onHitEOF              func()      // if non-nil, func to call when EOF is Read
+		maxTrailerBytes       int64       // if positive, the trailer size limit
+		extraBytes            func() bool // if non-nil, reports whether bytes past the body arrive; see Server.VerifyContentLength
 	}
 
 	// bodyLocked is a io.Reader reading from a *body when its mutex is already held.
@@ -0,0 +1,19 @@
+/*
+ * Copyright (c) 2018 The Go Authors. All rights reserved.
+ * Use of this source code is governed by a BSD-style license that can be found in the LICENSE file.
+ */
+
+package util
+
+import "os"
+
+func (b *spooledBody) Close() error {
+	err := b.body.Close()
+	if ferr := b.file.Close(); err == nil {
+		err = ferr
+	}
+	if rerr := os.Remove(b.file.Name()); err == nil {
+		err = rerr
+	}
+	return err
+}
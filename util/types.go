@@ -10,6 +10,7 @@ import (
 	"io"
 	"io/ioutil"
 	"log"
+	"os"
 	"strings"
 	"sync"
 	"time"
@@ -44,6 +45,16 @@ type (
 	// error from reading the dummy body.
 	failureToReadBody struct{}
 
+	// spooledBody is the Body DumpResponseTo leaves on a response: it reads
+	// again the bytes spooled to a temporary file while dumping, then
+	// whatever the dump didn't consume from the original body. Close
+	// closes the original body and removes the file.
+	spooledBody struct {
+		io.Reader
+		file *os.File
+		body io.ReadCloser
+	}
+
 	// ReverseProxy is an HTTP Handler that takes an incoming request and
 	// sends it to another server, proxying the response back to the
 	// client.
@@ -138,4 +149,18 @@ var (
 		hdr.UpgradeHeader,
 	}
 	doubleCRLF = []byte("\r\n\r\n")
+
+	// DefaultRedactedHeaders are the headers whose values
+	// DumpRequestOutRedacted masks when given a nil list: the credentials
+	// and cookies the Client only forwards on redirects to the same domain,
+	// and the proxy credentials.
+	DefaultRedactedHeaders = []string{
+		hdr.Authorization,
+		hdr.WWWAuthenticate,
+		hdr.CookieHeader,
+		"Cookie2",
+		ProxyAuthorization,
+	}
+
+	redactedValue = []byte("REDACTED")
 )
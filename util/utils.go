@@ -125,6 +125,59 @@ func DumpRequestOut(r *Request, body bool) ([]byte, error) {
 	return dump, nil
 }
 
+// DumpRequestOutRedacted is like DumpRequestOut but replaces the values of
+// the redact headers with REDACTED, leaving the header lines in place, so
+// the dump can be logged. A nil redact uses DefaultRedactedHeaders.
+// The headers of r are not modified.
+func DumpRequestOutRedacted(r *Request, body bool, redact []string) ([]byte, error) {
+	dump, err := DumpRequestOut(r, body)
+	if err != nil {
+		return nil, err
+	}
+	if redact == nil {
+		redact = DefaultRedactedHeaders
+	}
+	return redactHeaders(dump, redact), nil
+}
+
+// redactHeaders replaces the values of the redact header lines in the
+// header section of dump, which ends at the first empty line.
+func redactHeaders(dump []byte, redact []string) []byte {
+	if len(redact) == 0 {
+		return dump
+	}
+	end := bytes.Index(dump, doubleCRLF)
+	if end < 0 {
+		return dump
+	}
+	var buf bytes.Buffer
+	buf.Grow(len(dump))
+	lines := bytes.SplitAfter(dump[:end+2], CrLf)
+	for i, line := range lines {
+		colon := bytes.IndexByte(line, ':')
+		if i == 0 || colon < 0 || !containsHeader(redact, string(line[:colon])) {
+			buf.Write(line)
+			continue
+		}
+		buf.Write(line[:colon+1])
+		buf.WriteByte(' ')
+		buf.Write(redactedValue)
+		buf.Write(CrLf)
+	}
+	buf.Write(dump[end+2:])
+	return buf.Bytes()
+}
+
+// containsHeader reports whether keys holds key, ignoring case.
+func containsHeader(keys []string, key string) bool {
+	for _, k := range keys {
+		if strings.EqualFold(k, key) {
+			return true
+		}
+	}
+	return false
+}
+
 // DumpRequest returns the given request in its HTTP/1.x wire
 // representation. It should only be used by servers to debug client
 // requests. The returned representation is an approximation only;
@@ -250,6 +303,45 @@ func DumpResponse(resp *Response, body bool) ([]byte, error) {
 	return b.Bytes(), nil
 }
 
+// DumpResponseTo is like DumpResponse but streams the dump to w instead of
+// returning it, so dumping a large body doesn't hold it in memory. When body
+// is true, the body is spooled to a temporary file while being dumped and
+// resp.Body is replaced by a reader of the same content, which removes the
+// file on Close.
+func DumpResponseTo(w io.Writer, resp *Response, body bool) error {
+	save := resp.Body
+	savecl := resp.ContentLength
+	defer func() {
+		resp.ContentLength = savecl
+	}()
+
+	if !body || resp.Body == nil {
+		if !body && resp.ContentLength != 0 {
+			resp.Body = failureToReadBody{}
+		} else {
+			resp.Body = emptyBody
+		}
+		err := resp.Write(w)
+		resp.Body = save
+		if err == errNoBody {
+			err = nil
+		}
+		return err
+	}
+
+	file, err := ioutil.TempFile("", "dump-")
+	if err != nil {
+		return err
+	}
+	resp.Body = ioutil.NopCloser(io.TeeReader(save, file))
+	err = resp.Write(w)
+	if _, serr := file.Seek(0, io.SeekStart); err == nil {
+		err = serr
+	}
+	resp.Body = &spooledBody{Reader: io.MultiReader(file, save), file: file, body: save}
+	return err
+}
+
 func singleJoiningSlash(a, b string) string {
 	aslash := len(a) >= 1 && a[len(a)-1:] == "/" // @comment : was `strings.HasSuffix(a, "/")`
 	bslash := len(b) >= 1 && b[:1] == "/"        //@comment : was `strings.HasPrefix(b, "/")`
@@ -145,6 +145,20 @@ func parseBasicAuth(auth string) (string, string, bool) {
 	return cs[:s], cs[s+1:], true
 }
 
+// parseBearerAuth parses an HTTP Bearer Authentication string.
+// "Bearer mF_9.B5f-4.1JqM" returns ("mF_9.B5f-4.1JqM", true).
+func parseBearerAuth(auth string) (string, bool) {
+	const prefix = "Bearer "
+	if len(auth) < len(prefix) || !strings.EqualFold(auth[:len(prefix)], prefix) {
+		return "", false
+	}
+	token := strings.TrimSpace(auth[len(prefix):])
+	if token == "" {
+		return "", false
+	}
+	return token, true
+}
+
 // parseRequestLine parses "GET /foo HTTP/1.1" into its three parts.
 // returns method, requestURI, proto string, ok bool
 func parseRequestLine(line string) (string, string, string, bool) {
@@ -161,21 +175,25 @@ func newHeaderReader(br *bufio.Reader) *hdr.HeaderReader {
 	// @comment : getting Reader from the pool
 	if v := headerReaderPool.Get(); v != nil {
 		tr := v.(*hdr.HeaderReader)
-		tr.R = br
+		tr.Reset(br)
 		return tr
 	}
 	return hdr.NewHeaderReader(br)
 }
 
 func putHeaderReader(r *hdr.HeaderReader) {
-	r.R = nil
+	r.Reset(nil)
 	headerReaderPool.Put(r)
 }
 
-func readRequest(b *bufio.Reader, deleteHostHeader bool) (*Request, error) {
+// maxHeaderBytes, if positive, limits the size of the request line and header
+// keepRaw sets Request.RawHeaders, which costs a copy of every header field
+func readRequest(b *bufio.Reader, deleteHostHeader, rejectBareLF, keepRaw bool, maxHeaderBytes int64) (*Request, error) {
 	var err error
 	var req *Request
 	tp := newHeaderReader(b)
+	tp.RejectBareLF = rejectBareLF
+	tp.MaxBytes = maxHeaderBytes
 	req = new(Request)
 
 	// First line: GET /index.html HTTP/1.0
@@ -228,7 +246,12 @@ func readRequest(b *bufio.Reader, deleteHostHeader bool) (*Request, error) {
 	}
 
 	// Subsequent lines: Key: value.
-	mimeHeader, err := tp.ReadHeader()
+	var mimeHeader hdr.Header
+	if keepRaw {
+		mimeHeader, req.RawHeaders, err = tp.ReadHeaderRaw()
+	} else {
+		mimeHeader, err = tp.ReadHeader()
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -317,3 +340,87 @@ func parsePostForm(r *Request) (url.Values, error) {
 	}
 	return vs, err
 }
+
+// parseHeaderFields splits the serialized header block b into its fields, keeping their order.
+func parseHeaderFields(b []byte) []hdr.KV {
+	var fields []hdr.KV
+	for _, line := range strings.Split(string(b), "\r\n") {
+		i := strings.IndexByte(line, ':')
+		if i < 0 {
+			continue
+		}
+		fields = append(fields, hdr.KV{Key: line[:i], Value: hdr.TrimString(line[i+1:])})
+	}
+	return fields
+}
+
+// splitCurlArgs splits a command line into its arguments the way a POSIX
+// shell would for the simple cases: words are separated by whitespace,
+// single quotes keep their content verbatim, double quotes allow
+// backslash escapes of '"', '\\', '$' and '`', and a backslash outside
+// quotes escapes the next character (a line continuation if a newline).
+func splitCurlArgs(cmd string) ([]string, error) {
+	var (
+		args  []string
+		cur   []byte
+		inArg bool
+	)
+	for i := 0; i < len(cmd); i++ {
+		c := cmd[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			if inArg {
+				args = append(args, string(cur))
+				cur, inArg = cur[:0], false
+			}
+		case c == '\\':
+			if i+1 == len(cmd) {
+				return nil, errors.New("http: curl command ends with a backslash")
+			}
+			i++
+			if cmd[i] == '\n' {
+				continue
+			}
+			cur, inArg = append(cur, cmd[i]), true
+		case c == '\'':
+			j := strings.IndexByte(cmd[i+1:], '\'')
+			if j < 0 {
+				return nil, errors.New("http: unterminated quote in curl command")
+			}
+			cur, inArg = append(cur, cmd[i+1:i+1+j]...), true
+			i += j + 1
+		case c == '"':
+			inArg = true
+			for i++; ; i++ {
+				if i == len(cmd) {
+					return nil, errors.New("http: unterminated quote in curl command")
+				}
+				if cmd[i] == '"' {
+					break
+				}
+				if cmd[i] == '\\' && i+1 < len(cmd) && strings.IndexByte("\"\\$`", cmd[i+1]) >= 0 {
+					i++
+				}
+				cur = append(cur, cmd[i])
+			}
+		default:
+			cur, inArg = append(cur, c), true
+		}
+	}
+	if inArg {
+		args = append(args, string(cur))
+	}
+	return args, nil
+}
+
+// cloneURLValues returns a deep copy of v, or nil if v is nil.
+func cloneURLValues(v url.Values) url.Values {
+	if v == nil {
+		return nil
+	}
+	v2 := make(url.Values, len(v))
+	for k, vv := range v {
+		v2[k] = append([]string(nil), vv...)
+	}
+	return v2
+}
@@ -7,6 +7,10 @@ package http
 
 import (
 	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha1"
+	"encoding/base64"
 	"fmt"
 	"io"
 	"net"
@@ -17,6 +21,7 @@ import (
 	"time"
 
 	"github.com/badu/http/hdr"
+	"golang.org/x/net/http2"
 )
 
 func srcIsRegularFile(src io.Reader) (bool, error) {
@@ -125,6 +130,23 @@ func http1ServerSupportsRequest(req *Request) bool {
 	return false
 }
 
+// acceptsTrailers reports whether the TE header of a request lists
+// "trailers", meaning the client is willing to accept trailer fields.
+func acceptsTrailers(h hdr.Header) bool {
+	found := false
+	for _, v := range h[hdr.TEHeader] {
+		foreachHeaderElement(v, func(e string) {
+			if i := strings.IndexByte(e, ';'); i != -1 {
+				e = e[:i]
+			}
+			if strings.EqualFold(hdr.TrimString(e), "trailers") {
+				found = true
+			}
+		})
+	}
+	return found
+}
+
 // foreachHeaderElement splits v according to the "#rule" construction
 // in RFC 2616 section 2.1 and calls fn for each non-empty element.
 func foreachHeaderElement(v string, fn func(string)) {
@@ -210,6 +232,16 @@ func registerOnHitEOF(rc io.ReadCloser, fn func()) {
 	}
 }
 
+// limitTrailer sets the trailer size limit of the chunked body rc.
+func limitTrailer(rc io.ReadCloser, n int64) {
+	switch v := rc.(type) {
+	case *expectContinueReader:
+		limitTrailer(v.readCloser, n)
+	case *body:
+		v.maxTrailerBytes = n
+	}
+}
+
 // requestBodyRemains reports whether future calls to Read
 // on rc might yield more data.
 func requestBodyRemains(rc io.ReadCloser) bool {
@@ -260,3 +292,117 @@ func strSliceContains(ss []string, s string) bool {
 	}
 	return false
 }
+
+// negotiateEncoding picks, among the encodings of an Accept-Encoding
+// header value for which has reports true, the one with the highest
+// quality value, ties going to the first one listed. It returns "" if
+// none is acceptable. The returned encoding is lower-cased.
+func negotiateEncoding(acceptEncoding string, has func(encoding string) bool) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params := part, ""
+		if i := strings.IndexByte(part, ';'); i >= 0 {
+			name, params = part[:i], part[i+1:]
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || !has(name) {
+			continue
+		}
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			param = strings.TrimSpace(param)
+			if len(param) > 2 && (param[0] == 'q' || param[0] == 'Q') && param[1] == '=' {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if q > bestQ {
+			best, bestQ = name, q
+		}
+	}
+	return best
+}
+
+// newGzipWriter is the encoder of the responses written through WrapGzip.
+func newGzipWriter(w io.Writer) io.WriteCloser {
+	return gzip.NewWriter(w)
+}
+
+// isCompressedContentType reports whether a body of the media type ct is
+// already compressed, so that gzip would not shrink it.
+func isCompressedContentType(ct string) bool {
+	if i := strings.IndexByte(ct, ';'); i >= 0 {
+		ct = ct[:i]
+	}
+	ct = strings.ToLower(strings.TrimSpace(ct))
+	switch {
+	case ct == "image/svg+xml":
+		return false
+	case strings.HasPrefix(ct, "image/"), strings.HasPrefix(ct, "audio/"), strings.HasPrefix(ct, "video/"):
+		return true
+	}
+	switch ct {
+	case "application/gzip", "application/x-gzip", "application/zip", "application/x-bzip2",
+		"application/x-xz", "application/x-7z-compressed", "application/x-rar-compressed",
+		"application/zstd", "font/woff", "font/woff2":
+		return true
+	}
+	return false
+}
+
+// writeEventLines writes each line of s, whatever its line break, to buf
+// as a field starting with prefix.
+func writeEventLines(buf *bytes.Buffer, prefix, s string) {
+	s = strings.Replace(s, "\r\n", "\n", -1)
+	s = strings.Replace(s, "\r", "\n", -1)
+	for _, line := range strings.Split(s, "\n") {
+		buf.WriteString(prefix)
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+}
+
+// websocketAccept returns the Sec-WebSocket-Accept value answering the
+// Sec-WebSocket-Key value key.
+func websocketAccept(key string) string {
+	sum := sha1.Sum([]byte(key + "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// h2cUpgradeSettings reports whether req asks to upgrade the connection
+// to cleartext HTTP/2, in a way the server can honor, and returns the
+// client's settings carried by its HTTP2-Settings header.
+func h2cUpgradeSettings(req *Request) ([]http2.Setting, bool) {
+	if !req.ProtoAtLeast(1, 1) || req.Method == CONNECT || requestBodyRemains(req.Body) {
+		return nil, false
+	}
+	conn := req.Header.Get(hdr.Connection)
+	if !hasToken(conn, "upgrade") || !hasToken(conn, "http2-settings") {
+		return nil, false
+	}
+	if !hasToken(req.Header.Get(hdr.UpgradeHeader), "h2c") {
+		return nil, false
+	}
+	values := req.Header[hdr.Http2Settings]
+	if len(values) != 1 {
+		return nil, false
+	}
+	// token68 of the base64url encoding, which should have no padding
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(values[0], "="))
+	if err != nil || len(payload)%6 != 0 {
+		return nil, false
+	}
+	settings := make([]http2.Setting, 0, len(payload)/6)
+	for ; len(payload) > 0; payload = payload[6:] {
+		s := http2.Setting{
+			ID:  http2.SettingID(uint16(payload[0])<<8 | uint16(payload[1])),
+			Val: uint32(payload[2])<<24 | uint32(payload[3])<<16 | uint32(payload[4])<<8 | uint32(payload[5]),
+		}
+		if s.Valid() != nil {
+			return nil, false
+		}
+		settings = append(settings, s)
+	}
+	return settings, true
+}
@@ -421,20 +421,23 @@ func fixTrailer(header hdr.Header, te []string) (hdr.Header, error) {
 	return trailer, nil
 }
 
-func seeUpcomingDoubleCRLF(r *bufio.Reader) bool {
+// upcomingDoubleCRLF returns the number of bytes up to and including
+// the next double CRLF buffered by r, or -1 if there is none before
+// r's buffer is full.
+func upcomingDoubleCRLF(r *bufio.Reader) int {
 	for peekSize := 4; ; peekSize++ {
 		// This loop stops when Peek returns an error,
 		// which it does when r's buffer has been filled.
 		buf, err := r.Peek(peekSize)
 		//@comment : was `if bytes.HasSuffix(buf, doubleCRLF) {`
 		if len(buf) >= 4 && equal(buf[len(buf)-4:], DoubleCrLf) {
-			return true
+			return len(buf)
 		}
 		if err != nil {
 			break
 		}
 	}
-	return false
+	return -1
 }
 
 func mergeSetHeader(dst *hdr.Header, src hdr.Header) {